@@ -2,6 +2,7 @@ package content
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/ReanGD/go-web-search/database"
 	"github.com/jinzhu/gorm"
@@ -9,15 +10,19 @@ import (
 
 func createTables(db *gorm.DB, values ...interface{}) error {
 	for _, value := range values {
+		var err error
 		if !db.HasTable(value) {
-			err := db.CreateTable(value).Error
-			if err != nil {
-				errClose := db.Close()
-				if errClose != nil {
-					fmt.Printf("%s", errClose)
-				}
-				return err
+			err = db.CreateTable(value).Error
+		} else {
+			// add new columns to tables from previous versions
+			err = db.AutoMigrate(value).Error
+		}
+		if err != nil {
+			errClose := db.Close()
+			if errClose != nil {
+				fmt.Printf("%s", errClose)
 			}
+			return err
 		}
 	}
 	return nil
@@ -28,12 +33,18 @@ type DBrw struct {
 	*gorm.DB
 	// map[Content.Hash]Content.URL
 	hashes map[string]int64
+	// lock - serialize access from db worker and frontier
+	lock sync.Mutex
 }
 
 // GetDBrw - create/open content.db
 func GetDBrw() (*DBrw, error) {
-	db, err := gorm.Open("sqlite3", "file:content.db?cache=shared")
-	// db, err := gorm.Open("sqlite3", "content.db")
+	return openDBrw("file:content.db?cache=shared")
+}
+
+// openDBrw - create/open content database by sqlite data source
+func openDBrw(dataSource string) (*DBrw, error) {
+	db, err := gorm.Open("sqlite3", dataSource)
 	if err != nil {
 		return nil, err
 	}
@@ -44,7 +55,9 @@ func GetDBrw() (*DBrw, error) {
 	db.SetLogger(defaultLogger)
 	db.LogMode(false)
 
-	err = createTables(db, &database.Host{}, &database.Content{}, &database.Meta{}, &Link{}, &URL{})
+	err = createTables(db, &database.Host{}, &database.Content{}, &database.Meta{}, &Link{}, &URL{},
+		&database.SitemapHint{}, &database.RobotsHistory{}, &database.Cookie{},
+		&database.Redirect{}, &database.Rejected{}, &database.Trap{})
 	if err != nil {
 		errClose := db.Close()
 		if errClose != nil {
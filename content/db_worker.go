@@ -11,10 +11,18 @@ import (
 	"github.com/jinzhu/gorm"
 )
 
+// DBOperation - write operation, that is executed by DBWorker in its transaction
+type DBOperation func(tr *DBrw) error
+
 // DBWorker - worker for save data to db
 type DBWorker struct {
 	DB   *DBrw
 	ChDB <-chan *proxy.PageData
+	// ChOps - optional, write operations of crawler (cookies, traps), not closed by sender,
+	// operations sent before ChDB is closed are executed
+	ChOps <-chan DBOperation
+	// OnSaved - optional, called after each processed batch of pages (even if transaction failed)
+	OnSaved func(batch []*proxy.PageData)
 }
 
 func (w *DBWorker) getURLIDByStr(tr *DBrw, urlStr string) (sql.NullInt64, error) {
@@ -29,43 +37,73 @@ func (w *DBWorker) getURLIDByStr(tr *DBrw, urlStr string) (sql.NullInt64, error)
 	}
 }
 
-func (w *DBWorker) markURLLoaded(tr *DBrw, id sql.NullInt64, urlStr string, hostID sql.NullInt64) (int64, error) {
+func (w *DBWorker) markURLLoaded(tr *DBrw, id sql.NullInt64, urlStr string, hostID sql.NullInt64, depth int) (int64, error) {
 	var errID int64
 	var urlRec URL
 	if !id.Valid {
 		urlRec = URL{
 			URL:    urlStr,
 			HostID: hostID,
-			Loaded: true}
+			Loaded: true,
+			Depth:  depth}
 		err := tr.Create(&urlRec).Error
 		if err != nil {
 			return errID, fmt.Errorf("add new 'URL' record for URL %s, message: %s", urlStr, err)
 		}
 		return urlRec.ID, nil
 	}
-	err := tr.Model(&urlRec).Where("id = ?", id.Int64).Update("Loaded", true).Error
+	err := tr.Model(&urlRec).Where("id = ?", id.Int64).
+		Updates(map[string]interface{}{"loaded": true, "attempts": 0, "next_retry": nil}).Error
 	if err != nil {
 		return errID, fmt.Errorf("update 'URL' table with URL %s, message: %s", urlStr, err)
 	}
 	return id.Int64, nil
 }
 
-func (w *DBWorker) insertURLIfNotExists(tr *DBrw, urlStr string, hostID sql.NullInt64) (int64, error) {
+// insertURLIfNotExists - add URL with initial priority, inLinks - count of known links to new URL,
+// depth of existing URL is decreased to min value and priority of not loaded URL is raised for it
+func (w *DBWorker) insertURLIfNotExists(tr *DBrw, urlStr string, hostID sql.NullInt64, depth int, inLinks int) (int64, error) {
 	var rec URL
 	err := tr.Where("url = ?", urlStr).First(&rec).Error
 	if err == gorm.ErrRecordNotFound {
-		rec = URL{URL: urlStr, HostID: hostID, Loaded: false}
+		rec = URL{URL: urlStr, HostID: hostID, Loaded: false, Depth: depth,
+			Priority: initialPriority(depth, inLinks, sql.NullFloat64{Valid: false})}
 		err = tr.Create(&rec).Error
 		if err != nil {
 			return rec.ID, fmt.Errorf("add new 'URL' record for URL %s, message: %s", urlStr, err)
 		}
 	} else if err != nil {
 		return rec.ID, fmt.Errorf("find in 'URL' table for URL %s, message: %s", urlStr, err)
+	} else if rec.Depth > depth {
+		updates := map[string]interface{}{"depth": depth}
+		if !rec.Loaded {
+			updates["priority"] = rec.Priority + priorityDepthWeight*float64(rec.Depth-depth)
+		}
+		err = tr.Model(&URL{}).Where("id = ?", rec.ID).Updates(updates).Error
+		if err != nil {
+			return rec.ID, fmt.Errorf("update depth in 'URL' table with URL %s, message: %s", urlStr, err)
+		}
 	}
 
 	return rec.ID, nil
 }
 
+func (w *DBWorker) insertRejectedIfNotExists(tr *DBrw, item *proxy.RejectedURL, referer int64) error {
+	urlStr := item.GetURL()
+	var rec database.Rejected
+	err := tr.Where("url = ?", urlStr).First(&rec).Error
+	if err == gorm.ErrRecordNotFound {
+		err = tr.Create(item.GetTable(referer)).Error
+		if err != nil {
+			return fmt.Errorf("add new 'Rejected' record for URL %s, message: %s", urlStr, err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("find in 'Rejected' table for URL %s, message: %s", urlStr, err)
+	}
+
+	return nil
+}
+
 func (w *DBWorker) insertLinkIfNotExists(tr *DBrw, master int64, slave int64) error {
 	var rec Link
 	err := tr.Where("master = ? and slave = ?", master, slave).First(&rec).Error
@@ -84,88 +122,271 @@ func (w *DBWorker) insertLinkIfNotExists(tr *DBrw, master int64, slave int64) er
 	return nil
 }
 
-func (w *DBWorker) saveMeta(tr *DBrw, meta *proxy.Meta, origin sql.NullInt64) error {
+func (w *DBWorker) createMeta(tr *DBrw, meta *proxy.Meta, urlID int64, origin sql.NullInt64) error {
+	urlStr := meta.GetURL()
+	if !origin.Valid {
+		hash := meta.GetHash()
+		if len(hash) != 0 {
+			origin = tr.FindOrigin(hash)
+		}
+	}
+	meta.SetOrigin(origin)
+
+	if meta.GetState() == database.StateSuccess {
+		content := meta.GetContent()
+		if content == nil {
+			return fmt.Errorf("field 'content' is nil")
+		}
+		err := tr.Create(content.GetContent(urlID)).Error
+		if err != nil {
+			return fmt.Errorf("add new 'Content' record for URL %s, message: %s", urlStr, err)
+		}
+	}
+
+	err := tr.Create(meta.GetMeta(urlID)).Error
+	if err != nil {
+		return fmt.Errorf("add new 'Meta' record for URL %s, message: %s", urlStr, err)
+	}
+	hash := meta.GetHash()
+	if len(hash) != 0 {
+		tr.AddHash(hash, urlID)
+	}
+
+	return nil
+}
+
+// updateContent - replace content of page after recrawl,
+// origin is found by hash of new content, if it is not set by redirect or canonical URL
+func (w *DBWorker) updateContent(tr *DBrw, meta *proxy.Meta, urlID int64, origin sql.NullInt64) error {
+	urlStr := meta.GetURL()
+	var contentRec database.Content
+	err := tr.Where("url = ?", urlID).First(&contentRec).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return fmt.Errorf("find in 'Content' table for URL %s, message: %s", urlStr, err)
+	} else if err == nil {
+		tr.RemoveHash(contentRec.Hash, urlID)
+		err = tr.Where("url = ?", urlID).Delete(database.Content{}).Error
+		if err != nil {
+			return fmt.Errorf("delete 'Content' record for URL %s, message: %s", urlStr, err)
+		}
+	}
+
+	hash := meta.GetHash()
+	if !origin.Valid && len(hash) != 0 {
+		if found := tr.FindOrigin(hash); found.Valid && found.Int64 != urlID {
+			origin = found
+		}
+	}
+	meta.SetOrigin(origin)
+	if meta.GetState() != database.StateSuccess {
+		return nil
+	}
+
+	content := meta.GetContent()
+	if content == nil {
+		return fmt.Errorf("field 'content' is nil")
+	}
+	err = tr.Create(content.GetContent(urlID)).Error
+	if err != nil {
+		return fmt.Errorf("add new 'Content' record for URL %s, message: %s", urlStr, err)
+	}
+	if !tr.FindOrigin(hash).Valid {
+		tr.AddHash(hash, urlID)
+	}
+
+	return nil
+}
+
+// updateMeta - update meta and content after recrawl
+func (w *DBWorker) updateMeta(tr *DBrw, meta *proxy.Meta, urlID int64, origin sql.NullInt64) error {
+	urlStr := meta.GetURL()
+	fields := meta.GetScheduleFields()
+	if !meta.IsNotModified() {
+		err := w.updateContent(tr, meta, urlID, origin)
+		if err != nil {
+			return err
+		}
+		fields = meta.GetUpdateFields()
+	}
+
+	err := tr.Model(&database.Meta{}).Where("url = ?", urlID).Updates(fields).Error
+	if err != nil {
+		return fmt.Errorf("update 'Meta' record for URL %s, message: %s", urlStr, err)
+	}
+
+	return nil
+}
+
+// saveRedirect - replace redirect hop of URL
+// target - URL ID of redirect target
+func (w *DBWorker) saveRedirect(tr *DBrw, meta *proxy.Meta, urlID int64, target sql.NullInt64) error {
+	urlStr := meta.GetURL()
+	err := tr.Where("url = ?", urlID).Delete(database.Redirect{}).Error
+	if err != nil {
+		return fmt.Errorf("delete 'Redirect' record for URL %s, message: %s", urlStr, err)
+	}
+
+	redirect := meta.GetRedirect(urlID, target)
+	if redirect == nil {
+		return nil
+	}
+	err = tr.Create(redirect).Error
+	if err != nil {
+		return fmt.Errorf("add new 'Redirect' record for URL %s, message: %s", urlStr, err)
+	}
+
+	return nil
+}
+
+// saveCanonical - save canonical URL of page
+// returns ID of canonical URL, if page is dublicate of canonical page
+func (w *DBWorker) saveCanonical(tr *DBrw, meta *proxy.Meta, urlID int64) (sql.NullInt64, error) {
+	notFound := sql.NullInt64{Valid: false}
+	canonical, hostID := meta.GetCanonical()
+	if canonical == "" {
+		meta.SetCanonicalID(notFound)
+		return notFound, nil
+	}
+	if canonical == meta.GetURL() {
+		meta.SetCanonicalID(sql.NullInt64{Int64: urlID, Valid: true})
+		return notFound, nil
+	}
+
+	canonicalID, err := w.insertURLIfNotExists(tr, canonical, hostID, meta.GetDepth(), 0)
+	if err != nil {
+		return notFound, err
+	}
+	meta.SetCanonicalID(sql.NullInt64{Int64: canonicalID, Valid: true})
+
+	var metaRec database.Meta
+	err = tr.Where("url = ?", canonicalID).First(&metaRec).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return notFound, fmt.Errorf("find in 'Meta' table for URL %s, message: %s", canonical, err)
+	}
+	// canonical page is dublicate of this page, so this page is origin
+	if err == nil && metaRec.Origin.Valid && metaRec.Origin.Int64 == urlID {
+		return notFound, nil
+	}
+
+	return sql.NullInt64{Int64: canonicalID, Valid: true}, nil
+}
+
+// saveMeta - save meta and all metas of redirect chain
+// target - URL ID of redirect target for URL
+func (w *DBWorker) saveMeta(tr *DBrw, meta *proxy.Meta, target sql.NullInt64) error {
 	hostID := meta.GetHostID()
 	urlStr := meta.GetURL()
 	urlNullID, err := w.getURLIDByStr(tr, urlStr)
 	if err != nil {
 		return err
 	}
-	urlID, err := w.markURLLoaded(tr, urlNullID, urlStr, hostID)
+	urlID, err := w.markURLLoaded(tr, urlNullID, urlStr, hostID, meta.GetDepth())
 	if err != nil {
 		return err
 	}
-	if origin.Valid {
-		err = w.insertLinkIfNotExists(tr, urlID, origin.Int64)
+	if target.Valid {
+		err = w.insertLinkIfNotExists(tr, urlID, target.Int64)
 		if err != nil {
 			return err
 		}
 	}
 
+	// temporary redirect does not make URL dublicate of target
+	origin := target
+	if meta.IsRedirect() && !meta.IsPermanentRedirect() {
+		origin = sql.NullInt64{Valid: false}
+	}
+	canonical, err := w.saveCanonical(tr, meta, urlID)
+	if err != nil {
+		return err
+	}
+	if !origin.Valid {
+		origin = canonical
+	}
+
+	saved := true
 	var metaRec database.Meta
 	err = tr.Where("url = ?", urlID).First(&metaRec).Error
 	if err == gorm.ErrRecordNotFound {
-		if !origin.Valid {
-			hash := meta.GetHash()
-			if len(hash) != 0 {
-				origin = tr.FindOrigin(hash)
-			}
-		}
-		meta.SetOrigin(origin)
+		err = w.createMeta(tr, meta, urlID, origin)
+	} else if err != nil {
+		err = fmt.Errorf("find in 'Meta' table for URL %s, message: %s", urlStr, err)
+	} else if meta.IsRecrawl() {
+		err = w.updateMeta(tr, meta, urlID, origin)
+	} else {
+		saved = false
+	}
+	if err == nil && saved {
+		err = w.saveRedirect(tr, meta, urlID, target)
+	}
+	if err != nil {
+		return err
+	}
 
-		if meta.GetState() == database.StateSuccess {
-			content := meta.GetContent()
-			if content == nil {
-				return fmt.Errorf("field 'content' is nil")
-			}
-			err = tr.Create(content.GetContent(urlID)).Error
-			if err != nil {
-				return fmt.Errorf("add new 'Content' record for URL %s, message: %s", urlStr, err)
-			}
-		}
+	if meta.GetReferer() != nil {
+		return w.saveMeta(tr, meta.GetReferer(), sql.NullInt64{Int64: urlID, Valid: true})
+	}
 
-		err = tr.Create(meta.GetMeta(urlID)).Error
-		if err != nil {
-			return fmt.Errorf("add new 'Meta' record for URL %s, message: %s", urlStr, err)
-		}
-		hash := meta.GetHash()
-		if len(hash) != 0 {
-			tr.AddHash(hash, urlID)
-		}
+	return nil
+}
 
-		if meta.GetReferer() != nil {
-			err = w.saveMeta(tr, meta.GetReferer(), sql.NullInt64{Int64: urlID, Valid: true})
-			if err != nil {
-				return err
-			}
-		}
-	} else if err != nil {
-		return fmt.Errorf("find in 'Meta' table for URL %s, message: %s", urlStr, err)
-	} else {
-		if meta.GetReferer() != nil {
-			err = w.saveMeta(tr, meta.GetReferer(), sql.NullInt64{Int64: urlID, Valid: true})
-			if err != nil {
-				return err
-			}
-		}
+func (w *DBWorker) markURLRetry(tr *DBrw, id int64, meta *proxy.Meta) error {
+	attempts, nextRetry := meta.GetRetry()
+	err := tr.Model(&URL{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"attempts": attempts, "next_retry": nextRetry}).Error
+	if err != nil {
+		return fmt.Errorf("update retry in 'URL' table with URL %s, message: %s", meta.GetURL(), err)
 	}
 
 	return nil
 }
 
+// getParentURLID - get ID of requested URL, it is unknown for pages without task (import from archive),
+// then ID of first URL of redirect chain is used
+func (w *DBWorker) getParentURLID(tr *DBrw, data *proxy.PageData) (int64, error) {
+	if data.GetParentURL() != 0 {
+		return data.GetParentURL(), nil
+	}
+	root := data.GetMeta()
+	for root.GetReferer() != nil {
+		root = root.GetReferer()
+	}
+	id, err := w.getURLIDByStr(tr, root.GetURL())
+	if err != nil {
+		return 0, err
+	}
+
+	return id.Int64, nil
+}
+
 func (w *DBWorker) savePageData(tr *DBrw, data *proxy.PageData) error {
+	if data.GetMeta().NeedRetry() {
+		return w.markURLRetry(tr, data.GetParentURL(), data.GetMeta())
+	}
+
 	err := w.saveMeta(tr, data.GetMeta(), sql.NullInt64{Valid: false})
 	if err != nil {
 		return err
 	}
+	parentID, err := w.getParentURLID(tr, data)
+	if err != nil {
+		return err
+	}
 
 	var id int64
+	depth := data.GetMeta().GetDepth() + 1
 	for urlStr, hostID := range data.GetURLs() {
-		id, err = w.insertURLIfNotExists(tr, urlStr, hostID)
+		id, err = w.insertURLIfNotExists(tr, urlStr, hostID, depth, 1)
 		if err != nil {
 			return err
 		}
-		err = w.insertLinkIfNotExists(tr, data.GetParentURL(), id)
+		err = w.insertLinkIfNotExists(tr, parentID, id)
+		if err != nil {
+			return err
+		}
+	}
+	for _, item := range data.GetRejected() {
+		err = w.insertRejectedIfNotExists(tr, item, parentID)
 		if err != nil {
 			return err
 		}
@@ -174,20 +395,68 @@ func (w *DBWorker) savePageData(tr *DBrw, data *proxy.PageData) error {
 	return nil
 }
 
+// readOps - read operations without waiting
+func (w *DBWorker) readOps(ops []DBOperation) []DBOperation {
+	for {
+		select {
+		case op := <-w.ChOps:
+			ops = append(ops, op)
+		default:
+			return ops
+		}
+	}
+}
+
+func (w *DBWorker) readBatch() ([]*proxy.PageData, []DBOperation, bool) {
+	var batch []*proxy.PageData
+	var ops []DBOperation
+	select {
+	case data, more := <-w.ChDB:
+		if !more {
+			return nil, w.readOps(ops), false
+		}
+		batch = append(batch, data)
+	case op := <-w.ChOps:
+		ops = append(ops, op)
+	}
+
+	for len(batch)+len(ops) < 100 {
+		select {
+		case data, more := <-w.ChDB:
+			if !more {
+				return batch, w.readOps(ops), false
+			}
+			batch = append(batch, data)
+		case op := <-w.ChOps:
+			ops = append(ops, op)
+		default:
+			return batch, ops, true
+		}
+	}
+
+	return batch, ops, true
+}
+
 // Start - run db write worker
 func (w *DBWorker) Start(wgParent *sync.WaitGroup) {
 	defer wgParent.Done()
 
-	finish := false
-	for !finish {
+	for more := true; more; {
+		var batch []*proxy.PageData
+		var ops []DBOperation
+		batch, ops, more = w.readBatch()
+		if len(batch) == 0 && len(ops) == 0 {
+			continue
+		}
+
 		err := w.DB.Transaction(func(tr *DBrw) error {
-			for i := 0; i != 100; i++ {
-				data, more := <-w.ChDB
-				if !more {
-					finish = true
-					break
+			for _, op := range ops {
+				err := op(tr)
+				if err != nil {
+					return err
 				}
-
+			}
+			for _, data := range batch {
 				err := w.savePageData(tr, data)
 				if err != nil {
 					return err
@@ -199,5 +468,8 @@ func (w *DBWorker) Start(wgParent *sync.WaitGroup) {
 		if err != nil {
 			log.Printf("ERROR: %s", err)
 		}
+		if w.OnSaved != nil && len(batch) != 0 {
+			w.OnSaved(batch)
+		}
 	}
 }
@@ -0,0 +1,402 @@
+package content
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ReanGD/go-web-search/database"
+	"github.com/ReanGD/go-web-search/proxy"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// helperOpenDB - open content database in temporary directory, it is removed by close function
+func helperOpenDB() (*DBrw, func()) {
+	dir, err := ioutil.TempDir("", "content")
+	So(err, ShouldBeNil)
+	db, err := openDBrw(filepath.Join(dir, "content.db"))
+	So(err, ShouldBeNil)
+
+	return db, func() {
+		So(db.Close(), ShouldBeNil)
+		So(os.RemoveAll(dir), ShouldBeNil)
+	}
+}
+
+func helperAddHost(db *DBrw, name string) int64 {
+	host := database.Host{Name: name, RobotsStatusCode: 200}
+	So(db.Create(&host).Error, ShouldBeNil)
+
+	return host.ID
+}
+
+func helperAddURL(db *DBrw, rec URL) int64 {
+	So(db.Create(&rec).Error, ShouldBeNil)
+
+	return rec.ID
+}
+
+func helperGetURL(db *DBrw, urlStr string) URL {
+	var rec URL
+	So(db.Where("url = ?", urlStr).First(&rec).Error, ShouldBeNil)
+
+	return rec
+}
+
+// helperNewPage - loaded page with links to urls
+func helperNewPage(hostID int64, urlStr string, parentURL int64, urls ...string) *proxy.PageData {
+	meta := proxy.NewMeta(sql.NullInt64{Int64: hostID, Valid: true}, urlStr, nil)
+	meta.SetStatusCode(200)
+	meta.SetContent(proxy.NewContent([]byte("body of "+urlStr), "title"))
+	links := make(map[string]sql.NullInt64, len(urls))
+	for _, link := range urls {
+		links[link] = sql.NullInt64{Int64: hostID, Valid: true}
+	}
+	data := proxy.NewPageData(meta, links)
+	data.SetParentURL(parentURL)
+
+	return data
+}
+
+// helperRunWorker - run DBWorker until all pages are saved, returns batches passed to OnSaved
+func helperRunWorker(db *DBrw, pages []*proxy.PageData, ops []DBOperation) [][]*proxy.PageData {
+	chDB := make(chan *proxy.PageData, len(pages))
+	chOps := make(chan DBOperation, len(ops))
+	for _, data := range pages {
+		chDB <- data
+	}
+	for _, op := range ops {
+		chOps <- op
+	}
+	close(chDB)
+
+	var batches [][]*proxy.PageData
+	var wg sync.WaitGroup
+	wg.Add(1)
+	worker := DBWorker{DB: db, ChDB: chDB, ChOps: chOps, OnSaved: func(batch []*proxy.PageData) {
+		batches = append(batches, batch)
+	}}
+	worker.Start(&wg)
+	wg.Wait()
+
+	return batches
+}
+
+// TestDBWorker ...
+func TestDBWorker(t *testing.T) {
+	Convey("Pages and operations are saved in one batch", t, func() {
+		db, closeDB := helperOpenDB()
+		defer closeDB()
+		hostID := helperAddHost(db, "host")
+		rootID := helperAddURL(db, URL{URL: "http://host/", HostID: sql.NullInt64{Int64: hostID, Valid: true}})
+
+		pages := []*proxy.PageData{
+			helperNewPage(hostID, "http://host/", rootID, "http://host/a", "http://host/b"),
+			helperNewPage(hostID, "http://host/c", 0, "http://host/a")}
+		ops := []DBOperation{SaveTrapOp(proxy.NewTrap(hostID, "/calendar/", database.TrapQueryVariants, 3, "http://host/calendar/1"))}
+		batches := helperRunWorker(db, pages, ops)
+
+		So(len(batches), ShouldEqual, 1)
+		So(len(batches[0]), ShouldEqual, 2)
+
+		So(helperGetURL(db, "http://host/").Loaded, ShouldBeTrue)
+		So(helperGetURL(db, "http://host/c").Loaded, ShouldBeTrue)
+		a := helperGetURL(db, "http://host/a")
+		So(a.Loaded, ShouldBeFalse)
+		So(a.Depth, ShouldEqual, 1)
+		So(helperGetURL(db, "http://host/b").Loaded, ShouldBeFalse)
+
+		var links []Link
+		So(db.Where("slave = ?", a.ID).Find(&links).Error, ShouldBeNil)
+		So(len(links), ShouldEqual, 2)
+
+		var metaCnt int
+		So(db.Model(&database.Meta{}).Count(&metaCnt).Error, ShouldBeNil)
+		So(metaCnt, ShouldEqual, 2)
+
+		traps, err := db.GetTraps()
+		So(err, ShouldBeNil)
+		So(len(traps), ShouldEqual, 1)
+		So(traps[0].GetTable().Pattern, ShouldEqual, "/calendar/")
+	})
+
+	Convey("Operations without pages are executed, OnSaved is not called", t, func() {
+		db, closeDB := helperOpenDB()
+		defer closeDB()
+		hostID := helperAddHost(db, "host")
+
+		ops := []DBOperation{SaveTrapOp(proxy.NewTrap(hostID, "/a/", database.TrapQueryVariants, 1, "http://host/a/1"))}
+		batches := helperRunWorker(db, nil, ops)
+
+		So(len(batches), ShouldEqual, 0)
+		traps, err := db.GetTraps()
+		So(err, ShouldBeNil)
+		So(len(traps), ShouldEqual, 1)
+	})
+
+	Convey("Batch is limited to 100 items", t, func() {
+		db, closeDB := helperOpenDB()
+		defer closeDB()
+		hostID := helperAddHost(db, "host")
+
+		var pages []*proxy.PageData
+		for i := 0; i != 150; i++ {
+			pages = append(pages, helperNewPage(hostID, fmt.Sprintf("http://host/%d", i), 0))
+		}
+		batches := helperRunWorker(db, pages, nil)
+
+		So(len(batches), ShouldEqual, 2)
+		So(len(batches[0]), ShouldEqual, 100)
+		So(len(batches[1]), ShouldEqual, 50)
+
+		var cnt int
+		So(db.Model(&URL{}).Where("loaded = ?", true).Count(&cnt).Error, ShouldBeNil)
+		So(cnt, ShouldEqual, 150)
+	})
+
+	Convey("Failed batch is rolled back, OnSaved is called", t, func() {
+		db, closeDB := helperOpenDB()
+		defer closeDB()
+		hostID := helperAddHost(db, "host")
+
+		failed := func(tr *DBrw) error {
+			return sql.ErrNoRows
+		}
+		pages := []*proxy.PageData{helperNewPage(hostID, "http://host/", 0, "http://host/a")}
+		batches := helperRunWorker(db, pages, []DBOperation{failed})
+
+		So(len(batches), ShouldEqual, 1)
+		var cnt int
+		So(db.Model(&URL{}).Count(&cnt).Error, ShouldBeNil)
+		So(cnt, ShouldEqual, 0)
+	})
+}
+
+// TestGetNewURLs ...
+func TestGetNewURLs(t *testing.T) {
+	Convey("Not loaded URLs of host in order of priority", t, func() {
+		db, closeDB := helperOpenDB()
+		defer closeDB()
+		hostID := sql.NullInt64{Int64: helperAddHost(db, "host"), Valid: true}
+		otherID := sql.NullInt64{Int64: helperAddHost(db, "other"), Valid: true}
+		now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		before := now.Add(-time.Minute)
+		after := now.Add(time.Minute)
+
+		helperAddURL(db, URL{URL: "http://host/low", HostID: hostID, Priority: 1})
+		helperAddURL(db, URL{URL: "http://host/high", HostID: hostID, Priority: 5})
+		helperAddURL(db, URL{URL: "http://host/loaded", HostID: hostID, Loaded: true, Priority: 10})
+		helperAddURL(db, URL{URL: "http://host/retry", HostID: hostID, Attempts: 1, NextRetry: &before, Priority: 2})
+		helperAddURL(db, URL{URL: "http://host/wait", HostID: hostID, Attempts: 1, NextRetry: &after, Priority: 10})
+		helperAddURL(db, URL{URL: "http://other/", HostID: otherID, Priority: 10})
+		canonicalID := helperAddURL(db, URL{URL: "http://host/canonical", HostID: hostID, Priority: 0})
+		pageID := helperAddURL(db, URL{URL: "http://host/page", HostID: hostID, Loaded: true})
+		So(db.Create(&database.Meta{URL: pageID, State: database.StateSuccess,
+			Canonical: sql.NullInt64{Int64: canonicalID, Valid: true}}).Error, ShouldBeNil)
+
+		tasks, err := db.GetNewURLs(hostID.Int64, 10, now)
+		So(err, ShouldBeNil)
+		var urls []string
+		for _, task := range tasks {
+			urls = append(urls, task.URL)
+		}
+		So(urls, ShouldResemble, []string{"http://host/canonical", "http://host/high", "http://host/retry", "http://host/low"})
+		So(tasks[2].Attempts, ShouldEqual, 1)
+
+		tasks, err = db.GetNewURLs(hostID.Int64, 2, now)
+		So(err, ShouldBeNil)
+		So(len(tasks), ShouldEqual, 2)
+
+		tasks, err = db.GetNewURLs(hostID.Int64, 10, after)
+		So(err, ShouldBeNil)
+		So(len(tasks), ShouldEqual, 5)
+	})
+}
+
+// TestRetryPersistence ...
+func TestRetryPersistence(t *testing.T) {
+	Convey("Attempts and next retry are stored and reset after successful load", t, func() {
+		db, closeDB := helperOpenDB()
+		defer closeDB()
+		hostID := helperAddHost(db, "host")
+		id := helperAddURL(db, URL{URL: "http://host/", HostID: sql.NullInt64{Int64: hostID, Valid: true}})
+		now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		nextRetry := now.Add(10 * time.Minute)
+
+		data := helperNewPage(hostID, "http://host/", id, "http://host/a")
+		data.GetMeta().SetRetry(2, nextRetry)
+		helperRunWorker(db, []*proxy.PageData{data}, nil)
+
+		rec := helperGetURL(db, "http://host/")
+		So(rec.Loaded, ShouldBeFalse)
+		So(rec.Attempts, ShouldEqual, 2)
+		So(rec.NextRetry, ShouldNotBeNil)
+		So(rec.NextRetry.Equal(nextRetry), ShouldBeTrue)
+		var cnt int
+		So(db.Model(&database.Meta{}).Count(&cnt).Error, ShouldBeNil)
+		So(cnt, ShouldEqual, 0)
+		So(db.Model(&URL{}).Where("url = ?", "http://host/a").Count(&cnt).Error, ShouldBeNil)
+		So(cnt, ShouldEqual, 0)
+
+		tasks, err := db.GetNewURLs(hostID, 10, now)
+		So(err, ShouldBeNil)
+		So(len(tasks), ShouldEqual, 0)
+		tasks, err = db.GetNewURLs(hostID, 10, nextRetry)
+		So(err, ShouldBeNil)
+		So(len(tasks), ShouldEqual, 1)
+		So(tasks[0].Attempts, ShouldEqual, 2)
+
+		helperRunWorker(db, []*proxy.PageData{helperNewPage(hostID, "http://host/", id)}, nil)
+
+		rec = helperGetURL(db, "http://host/")
+		So(rec.Loaded, ShouldBeTrue)
+		So(rec.Attempts, ShouldEqual, 0)
+		So(rec.NextRetry, ShouldBeNil)
+	})
+}
+
+func helperSaveMeta(db *DBrw, meta *proxy.Meta) {
+	w := DBWorker{DB: db}
+	err := db.Transaction(func(tr *DBrw) error {
+		return w.saveMeta(tr, meta, sql.NullInt64{Valid: false})
+	})
+	So(err, ShouldBeNil)
+}
+
+func helperGetMeta(db *DBrw, urlStr string) database.Meta {
+	var rec database.Meta
+	So(db.Where("url = ?", helperGetURL(db, urlStr).ID).First(&rec).Error, ShouldBeNil)
+
+	return rec
+}
+
+func helperHasContent(db *DBrw, urlStr string) bool {
+	var cnt int
+	So(db.Model(&database.Content{}).Where("url = ?", helperGetURL(db, urlStr).ID).Count(&cnt).Error, ShouldBeNil)
+
+	return cnt != 0
+}
+
+// TestSaveMeta ...
+func TestSaveMeta(t *testing.T) {
+	Convey("Page with canonical URL is dublicate of canonical page", t, func() {
+		db, closeDB := helperOpenDB()
+		defer closeDB()
+		hostID := sql.NullInt64{Int64: helperAddHost(db, "host"), Valid: true}
+
+		meta := helperNewPage(hostID.Int64, "http://host/page?sort=1", 0).GetMeta()
+		meta.SetCanonical("http://host/page", hostID)
+		helperSaveMeta(db, meta)
+
+		canonical := helperGetURL(db, "http://host/page")
+		So(canonical.Loaded, ShouldBeFalse)
+		rec := helperGetMeta(db, "http://host/page?sort=1")
+		So(rec.State, ShouldEqual, database.StateDublicate)
+		So(rec.Origin, ShouldResemble, sql.NullInt64{Int64: canonical.ID, Valid: true})
+		So(rec.Canonical, ShouldResemble, sql.NullInt64{Int64: canonical.ID, Valid: true})
+		So(helperHasContent(db, "http://host/page?sort=1"), ShouldBeFalse)
+	})
+
+	Convey("Page with canonical URL to itself is not dublicate", t, func() {
+		db, closeDB := helperOpenDB()
+		defer closeDB()
+		hostID := sql.NullInt64{Int64: helperAddHost(db, "host"), Valid: true}
+
+		meta := helperNewPage(hostID.Int64, "http://host/page", 0).GetMeta()
+		meta.SetCanonical("http://host/page", hostID)
+		helperSaveMeta(db, meta)
+
+		page := helperGetURL(db, "http://host/page")
+		rec := helperGetMeta(db, "http://host/page")
+		So(rec.State, ShouldEqual, database.StateSuccess)
+		So(rec.Origin.Valid, ShouldBeFalse)
+		So(rec.Canonical, ShouldResemble, sql.NullInt64{Int64: page.ID, Valid: true})
+		So(helperHasContent(db, "http://host/page"), ShouldBeTrue)
+	})
+
+	Convey("Page is origin for canonical page, that is its dublicate", t, func() {
+		db, closeDB := helperOpenDB()
+		defer closeDB()
+		hostID := sql.NullInt64{Int64: helperAddHost(db, "host"), Valid: true}
+
+		first := helperNewPage(hostID.Int64, "http://host/a", 0).GetMeta()
+		first.SetCanonical("http://host/b", hostID)
+		helperSaveMeta(db, first)
+		second := helperNewPage(hostID.Int64, "http://host/b", 0).GetMeta()
+		second.SetCanonical("http://host/a", hostID)
+		helperSaveMeta(db, second)
+
+		a := helperGetURL(db, "http://host/a")
+		b := helperGetURL(db, "http://host/b")
+		So(b.Loaded, ShouldBeTrue)
+		So(helperGetMeta(db, "http://host/a").Origin, ShouldResemble, sql.NullInt64{Int64: b.ID, Valid: true})
+		rec := helperGetMeta(db, "http://host/b")
+		So(rec.State, ShouldEqual, database.StateSuccess)
+		So(rec.Origin.Valid, ShouldBeFalse)
+		So(rec.Canonical, ShouldResemble, sql.NullInt64{Int64: a.ID, Valid: true})
+		So(helperHasContent(db, "http://host/b"), ShouldBeTrue)
+	})
+
+	Convey("Permanent redirect makes URL dublicate of target", t, func() {
+		db, closeDB := helperOpenDB()
+		defer closeDB()
+		hostID := sql.NullInt64{Int64: helperAddHost(db, "host"), Valid: true}
+
+		source := proxy.NewMeta(hostID, "http://host/old", nil)
+		source.SetRedirect(301, "/new", 0)
+		target := proxy.NewMeta(hostID, "http://host/new", source)
+		target.SetStatusCode(200)
+		target.SetContent(proxy.NewContent([]byte("body"), "title"))
+		helperSaveMeta(db, target)
+
+		old := helperGetURL(db, "http://host/old")
+		newURL := helperGetURL(db, "http://host/new")
+		So(old.Loaded, ShouldBeTrue)
+		So(newURL.Loaded, ShouldBeTrue)
+		rec := helperGetMeta(db, "http://host/old")
+		So(rec.State, ShouldEqual, database.StateDublicate)
+		So(rec.Origin, ShouldResemble, sql.NullInt64{Int64: newURL.ID, Valid: true})
+		So(rec.RedirectCnt, ShouldEqual, 1)
+		So(helperGetMeta(db, "http://host/new").State, ShouldEqual, database.StateSuccess)
+
+		var redirect database.Redirect
+		So(db.Where("url = ?", old.ID).First(&redirect).Error, ShouldBeNil)
+		So(redirect.Target, ShouldResemble, sql.NullInt64{Int64: newURL.ID, Valid: true})
+		So(redirect.StatusCode, ShouldEqual, 301)
+		So(redirect.Location, ShouldEqual, "/new")
+
+		var links []Link
+		So(db.Where("master = ?", old.ID).Find(&links).Error, ShouldBeNil)
+		So(links, ShouldResemble, []Link{{Master: old.ID, Slave: newURL.ID}})
+	})
+
+	Convey("Temporary redirect does not make URL dublicate of target", t, func() {
+		db, closeDB := helperOpenDB()
+		defer closeDB()
+		hostID := sql.NullInt64{Int64: helperAddHost(db, "host"), Valid: true}
+
+		source := proxy.NewMeta(hostID, "http://host/old", nil)
+		source.SetRedirect(302, "/new", 0)
+		target := proxy.NewMeta(hostID, "http://host/new", source)
+		target.SetStatusCode(200)
+		target.SetContent(proxy.NewContent([]byte("body"), "title"))
+		helperSaveMeta(db, target)
+
+		old := helperGetURL(db, "http://host/old")
+		newURL := helperGetURL(db, "http://host/new")
+		rec := helperGetMeta(db, "http://host/old")
+		So(rec.State, ShouldEqual, database.StateRedirect)
+		So(rec.Origin.Valid, ShouldBeFalse)
+
+		var redirect database.Redirect
+		So(db.Where("url = ?", old.ID).First(&redirect).Error, ShouldBeNil)
+		So(redirect.Target, ShouldResemble, sql.NullInt64{Int64: newURL.ID, Valid: true})
+		So(redirect.StatusCode, ShouldEqual, 302)
+	})
+}
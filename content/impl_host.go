@@ -1,8 +1,11 @@
 package content
 
 import (
+	"bytes"
 	"database/sql"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/ReanGD/go-web-search/database"
 	"github.com/ReanGD/go-web-search/proxy"
@@ -20,13 +23,41 @@ func (db *DBrw) GetHosts() (map[int64]*proxy.Host, error) {
 	}
 
 	for _, host := range hosts {
-		result[host.ID] = proxy.NewHost(host.Name, host.RobotsStatusCode, host.RobotsData)
+		item := proxy.NewHost(host.Name, host.RobotsStatusCode, host.RobotsData)
+		if host.Scheme != "" {
+			item.SetOrigin(host.Scheme, host.Port)
+		}
+		if host.RobotsFetchedAt != nil {
+			item.SetRobotsFetchedAt(*host.RobotsFetchedAt)
+		}
+		result[host.ID] = item
 	}
 
 	return result, nil
 }
 
-// AddHost - add new host
+// attachHostURLs - set host for URLs, that were saved before host was added (links from other hosts)
+func (db *DBrw) attachHostURLs(hostID int64, hostName string) error {
+	where := make([]string, 0, 8)
+	args := make([]interface{}, 0, 8)
+	for _, scheme := range []string{"http://", "https://"} {
+		for _, prefix := range []string{"", "www."} {
+			root := scheme + prefix + hostName
+			where = append(where, "url = ? or url like ? or url like ?")
+			args = append(args, root, root+"/%", root+"?%")
+		}
+	}
+
+	err := db.Model(&URL{}).Where("host_id is null").Where(strings.Join(where, " or "), args...).
+		Update("host_id", hostID).Error
+	if err != nil {
+		return fmt.Errorf("attach URLs to host %s, message: %s", hostName, err)
+	}
+
+	return nil
+}
+
+// AddHost - add new host, URLs of host saved before are attached to it
 func (db *DBrw) AddHost(host *proxy.Host, baseURL string) (int64, error) {
 	var id int64
 	err := db.Transaction(func(tr *DBrw) error {
@@ -38,8 +69,18 @@ func (db *DBrw) AddHost(host *proxy.Host, baseURL string) (int64, error) {
 
 		id = tblHost.ID
 
+		err = tr.Create(host.GetRobotsHistory(id)).Error
+		if err != nil {
+			return fmt.Errorf("add new 'RobotsHistory' record for host %s, message: %s", host.GetName(), err)
+		}
+
+		err = tr.attachHostURLs(id, host.GetName())
+		if err != nil {
+			return err
+		}
+
 		var dbItem URL
-		err = tr.Where("id = ?", baseURL).First(&dbItem).Error
+		err = tr.Where("url = ?", baseURL).First(&dbItem).Error
 		if err == gorm.ErrRecordNotFound {
 			newItem := &URL{
 				URL:    baseURL,
@@ -60,3 +101,255 @@ func (db *DBrw) AddHost(host *proxy.Host, baseURL string) (int64, error) {
 
 	return id, err
 }
+
+// UpdateRobotsTxt - save new download of robots.txt, new version is added to history
+func (db *DBrw) UpdateRobotsTxt(hostID int64, host *proxy.Host) error {
+	return db.Transaction(func(tr *DBrw) error {
+		var dbItem database.Host
+		err := tr.Where("id = ?", hostID).First(&dbItem).Error
+		if err != nil {
+			return fmt.Errorf("find in 'Host' table for host %s, message: %s", host.GetName(), err)
+		}
+
+		tblHost := host.GetTable()
+		if dbItem.RobotsStatusCode != tblHost.RobotsStatusCode || !bytes.Equal(dbItem.RobotsData, tblHost.RobotsData) {
+			err = tr.Create(host.GetRobotsHistory(hostID)).Error
+			if err != nil {
+				return fmt.Errorf("add new 'RobotsHistory' record for host %s, message: %s", host.GetName(), err)
+			}
+		}
+
+		err = tr.Model(&database.Host{}).Where("id = ?", hostID).Updates(map[string]interface{}{
+			"robots_status_code": tblHost.RobotsStatusCode,
+			"robots_data":        tblHost.RobotsData,
+			"robots_fetched_at":  tblHost.RobotsFetchedAt}).Error
+		if err != nil {
+			return fmt.Errorf("update 'Host' record for host %s, message: %s", host.GetName(), err)
+		}
+
+		return nil
+	})
+}
+
+// GetHostURLs - get first cnt URLs of host from table 'URL'
+func (db *DBrw) GetHostURLs(hostID int64, cnt int) ([]string, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	var urls []string
+	err := db.Model(&URL{}).Where("host_id = ?", hostID).Order("id").Limit(cnt).Pluck("url", &urls).Error
+	if err != nil {
+		return nil, fmt.Errorf("Get URLs for host %d from db, message: %s", hostID, err)
+	}
+
+	return urls, nil
+}
+
+// GetCookies - get rows from table 'Cookie' for host
+func (db *DBrw) GetCookies(hostID int64) ([]*proxy.Cookie, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	var rows []database.Cookie
+	err := db.Where("host_id = ?", hostID).Find(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("Get cookies for host %d from db, message: %s", hostID, err)
+	}
+
+	result := make([]*proxy.Cookie, 0, len(rows))
+	for i := range rows {
+		result = append(result, proxy.NewCookieFromTable(&rows[i]))
+	}
+
+	return result, nil
+}
+
+func (db *DBrw) saveCookie(tr *DBrw, hostID int64, item *proxy.Cookie, now time.Time) error {
+	row := item.GetTable(hostID)
+	where := tr.Model(&database.Cookie{}).Where("host_id = ? and name = ? and domain = ? and path = ?",
+		hostID, row.Name, row.Domain, row.Path)
+	if item.IsExpired(now) {
+		err := where.Delete(&database.Cookie{}).Error
+		if err != nil {
+			return fmt.Errorf("delete 'Cookie' record %s for host %d, message: %s", row.Name, hostID, err)
+		}
+		return nil
+	}
+
+	var dbItem database.Cookie
+	err := where.First(&dbItem).Error
+	if err == gorm.ErrRecordNotFound {
+		err = tr.Create(row).Error
+		if err != nil {
+			return fmt.Errorf("add new 'Cookie' record %s for host %d, message: %s", row.Name, hostID, err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("find in 'Cookie' table %s for host %d, message: %s", row.Name, hostID, err)
+	} else {
+		err = tr.Model(&database.Cookie{}).Where("id = ?", dbItem.ID).Updates(map[string]interface{}{
+			"url":       row.URL,
+			"value":     row.Value,
+			"expires":   row.Expires,
+			"secure":    row.Secure,
+			"http_only": row.HTTPOnly}).Error
+		if err != nil {
+			return fmt.Errorf("update 'Cookie' record %s for host %d, message: %s", row.Name, hostID, err)
+		}
+	}
+
+	return nil
+}
+
+// SaveCookiesOp - operation for DBWorker, that adds, updates or deletes (expired) cookies of host,
+// now - current time by clock of crawler
+func SaveCookiesOp(hostID int64, cookies []*proxy.Cookie, now time.Time) DBOperation {
+	return func(tr *DBrw) error {
+		for _, item := range cookies {
+			err := tr.saveCookie(tr, hostID, item, now)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// SaveCookies - add, update or delete (expired) cookies of host, now - current time by clock of crawler
+func (db *DBrw) SaveCookies(hostID int64, cookies []*proxy.Cookie, now time.Time) error {
+	return db.Transaction(SaveCookiesOp(hostID, cookies, now))
+}
+
+func (db *DBrw) addSitemapURL(tr *DBrw, item *proxy.SitemapURL) error {
+	urlStr := item.GetURL()
+	var urlRec URL
+	err := tr.Where("url = ?", urlStr).First(&urlRec).Error
+	if err == gorm.ErrRecordNotFound {
+		sitemapPriority := sql.NullFloat64{Float64: item.GetPriority(), Valid: true}
+		urlRec = URL{URL: urlStr, HostID: item.GetHostID(), Loaded: false,
+			Priority: initialPriority(0, 0, sitemapPriority)}
+		err = tr.Create(&urlRec).Error
+		if err != nil {
+			return fmt.Errorf("add new 'URL' record for URL %s, message: %s", urlStr, err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("find in 'URL' table for URL %s, message: %s", urlStr, err)
+	}
+
+	hint := item.GetHint(urlRec.ID)
+	var hintRec database.SitemapHint
+	err = tr.Where("url = ?", urlRec.ID).First(&hintRec).Error
+	if err == gorm.ErrRecordNotFound {
+		err = tr.Create(hint).Error
+		if err != nil {
+			return fmt.Errorf("add new 'SitemapHint' record for URL %s, message: %s", urlStr, err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("find in 'SitemapHint' table for URL %s, message: %s", urlStr, err)
+	} else {
+		err = tr.Model(&database.SitemapHint{}).Where("url = ?", urlRec.ID).Updates(map[string]interface{}{
+			"last_mod":    hint.LastMod,
+			"priority":    hint.Priority,
+			"change_freq": hint.ChangeFreq}).Error
+		if err != nil {
+			return fmt.Errorf("update 'SitemapHint' record for URL %s, message: %s", urlStr, err)
+		}
+	}
+
+	// page changed after download by <lastmod> is recrawled as soon as possible
+	if hint.LastMod != nil {
+		err = tr.Model(&database.Meta{}).
+			Where("url = ? and fetched_at < ? and next_fetch_at > ?", urlRec.ID, *hint.LastMod, *hint.LastMod).
+			Update("next_fetch_at", *hint.LastMod).Error
+		if err != nil {
+			return fmt.Errorf("update next fetch time in 'Meta' table for URL %s, message: %s", urlStr, err)
+		}
+	}
+
+	return nil
+}
+
+// AddSitemapURLs - add URLs from sitemap with hints, loaded pages with newer <lastmod> are scheduled for recrawl
+func (db *DBrw) AddSitemapURLs(urls []*proxy.SitemapURL) error {
+	return db.Transaction(func(tr *DBrw) error {
+		for _, item := range urls {
+			err := db.addSitemapURL(tr, item)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetTraps - get rows from table 'Trap'
+func (db *DBrw) GetTraps() ([]*proxy.Trap, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	var rows []database.Trap
+	err := db.Order("host_id, id").Find(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("Get traps from db, message: %s", err)
+	}
+
+	result := make([]*proxy.Trap, 0, len(rows))
+	for i := range rows {
+		result = append(result, proxy.NewTrapFromTable(&rows[i]))
+	}
+
+	return result, nil
+}
+
+// SaveTrapOp - operation for DBWorker, that adds quarantined pattern of host or updates its hits
+func SaveTrapOp(trap *proxy.Trap) DBOperation {
+	return func(tr *DBrw) error {
+		row := trap.GetTable()
+		var dbItem database.Trap
+		err := tr.Where("host_id = ? and pattern = ?", row.HostID, row.Pattern).First(&dbItem).Error
+		if err == gorm.ErrRecordNotFound {
+			err = tr.Create(row).Error
+			if err != nil {
+				return fmt.Errorf("add new 'Trap' record %s for host %d, message: %s", row.Pattern, row.HostID, err)
+			}
+		} else if err != nil {
+			return fmt.Errorf("find in 'Trap' table %s for host %d, message: %s", row.Pattern, row.HostID, err)
+		} else if row.Hits > dbItem.Hits {
+			err = tr.Model(&database.Trap{}).Where("id = ?", dbItem.ID).Update("hits", row.Hits).Error
+			if err != nil {
+				return fmt.Errorf("update 'Trap' record %s for host %d, message: %s", row.Pattern, row.HostID, err)
+			}
+		}
+
+		return nil
+	}
+}
+
+// SaveTrap - add quarantined pattern of host or update its hits
+func (db *DBrw) SaveTrap(trap *proxy.Trap) error {
+	return db.Transaction(SaveTrapOp(trap))
+}
+
+// GetContentHashes - get map[URL]hash of content for loaded pages of host, dublicates have hash of origin
+func (db *DBrw) GetContentHashes(hostID int64) (map[string]string, error) {
+	var rows []struct {
+		URL  string
+		Hash string
+	}
+	err := db.Table("url").
+		Select("url.url, content.hash").
+		Joins("join meta on meta.url = url.id").
+		Joins("join content on content.url = (case when meta.state = ? then meta.origin else url.id end)",
+			database.StateDublicate).
+		Where("url.host_id = ? and meta.state in (?, ?)", hostID, database.StateSuccess, database.StateDublicate).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("Get content hashes for host %d from db, message: %s", hostID, err)
+	}
+
+	result := make(map[string]string, len(rows))
+	for _, row := range rows {
+		result[row.URL] = row.Hash
+	}
+
+	return result, nil
+}
@@ -0,0 +1,32 @@
+package content
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ReanGD/go-web-search/proxy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// TestSaveCookies ...
+func TestSaveCookies(t *testing.T) {
+	Convey("Expiration of cookies is checked by clock of crawler", t, func() {
+		db, closeDB := helperOpenDB()
+		defer closeDB()
+		hostID := helperAddHost(db, "host")
+		now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		cookie := proxy.NewCookie("http://host/", &http.Cookie{Name: "sid", Value: "1", Expires: now.Add(time.Hour)})
+
+		So(db.SaveCookies(hostID, []*proxy.Cookie{cookie}, now), ShouldBeNil)
+		cookies, err := db.GetCookies(hostID)
+		So(err, ShouldBeNil)
+		So(len(cookies), ShouldEqual, 1)
+		So(cookies[0].GetCookie().Value, ShouldEqual, "1")
+
+		So(db.SaveCookies(hostID, []*proxy.Cookie{cookie}, now.Add(2*time.Hour)), ShouldBeNil)
+		cookies, err = db.GetCookies(hostID)
+		So(err, ShouldBeNil)
+		So(len(cookies), ShouldEqual, 0)
+	})
+}
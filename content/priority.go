@@ -0,0 +1,94 @@
+package content
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+)
+
+const (
+	// priorityInLinksWeight - weight of log(1 + count of links to URL)
+	priorityInLinksWeight = 1.0
+	// prioritySitemapWeight - weight of <priority> from sitemap (0.0 - 1.0)
+	prioritySitemapWeight = 2.0
+	// priorityDepthWeight - penalty for every level of click depth
+	priorityDepthWeight = 0.5
+	// priorityRankWeight - weight of log(1 + PageRank), average PageRank is 1
+	priorityRankWeight = 1.0
+	// updateBatchSize - count of URLs updated by one statement
+	updateBatchSize = 300
+)
+
+// PriorityScore - priority of URL in frontier (greater - earlier)
+func PriorityScore(f PriorityFactors) float64 {
+	score := priorityInLinksWeight*math.Log1p(float64(f.InLinks)) -
+		priorityDepthWeight*float64(f.Depth) +
+		priorityRankWeight*math.Log1p(f.Rank)
+	if f.SitemapPriority.Valid {
+		score += prioritySitemapWeight * f.SitemapPriority.Float64
+	}
+
+	return score
+}
+
+// initialPriority - priority of new URL by known factors, inLinks - count of links to URL
+func initialPriority(depth int, inLinks int, sitemapPriority sql.NullFloat64) float64 {
+	return PriorityScore(PriorityFactors{Depth: depth, InLinks: inLinks, SitemapPriority: sitemapPriority})
+}
+
+// columnBatches - split IDs of map[URL.ID]value to batches of updateBatchSize
+func columnBatches(values map[int64]float64) [][]int64 {
+	ids := make([]int64, 0, len(values))
+	for id := range values {
+		ids = append(ids, id)
+	}
+
+	var batches [][]int64
+	for start := 0; start < len(ids); start += updateBatchSize {
+		end := start + updateBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		batches = append(batches, ids[start:end])
+	}
+
+	return batches
+}
+
+// updateColumnBatch - set column of URLs from batch by map[URL.ID]value by one statement,
+// it is executed in transaction of caller
+func (db *DBrw) updateColumnBatch(column string, batch []int64, values map[int64]float64) error {
+	args := make([]interface{}, 0, 3*len(batch))
+	for _, id := range batch {
+		args = append(args, id, values[id])
+	}
+	for _, id := range batch {
+		args = append(args, id)
+	}
+	query := fmt.Sprintf("update url set %s = case id%s end where id in (?%s)", column,
+		strings.Repeat(" when ? then ?", len(batch)), strings.Repeat(", ?", len(batch)-1))
+
+	err := db.Exec(query, args...).Error
+	if err != nil {
+		return fmt.Errorf("update %s of %d URLs, message: %s", column, len(batch), err)
+	}
+
+	return nil
+}
+
+// updateColumn - set column of URLs by map[URL.ID]value, every batch is saved in own transaction,
+// so frontier and db worker are not blocked by whole update
+func (db *DBrw) updateColumn(column string, values map[int64]float64) error {
+	for _, batch := range columnBatches(values) {
+		batch := batch
+		err := db.Transaction(func(tr *DBrw) error {
+			return tr.updateColumnBatch(column, batch, values)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
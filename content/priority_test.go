@@ -0,0 +1,127 @@
+package content
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/ReanGD/go-web-search/database"
+	"github.com/ReanGD/go-web-search/proxy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func helperGetColumn(db *DBrw, column string) map[string]float64 {
+	var urls []URL
+	So(db.Order("id").Find(&urls).Error, ShouldBeNil)
+	result := make(map[string]float64, len(urls))
+	for _, item := range urls {
+		if column == "rank" {
+			result[item.URL] = item.Rank
+		} else {
+			result[item.URL] = item.Priority
+		}
+	}
+
+	return result
+}
+
+// TestInsertPriority ...
+func TestInsertPriority(t *testing.T) {
+	Convey("New URL gets initial priority, known URL is raised by lower depth", t, func() {
+		db, closeDB := helperOpenDB()
+		defer closeDB()
+		hostID := helperAddHost(db, "host")
+		helperAddURL(db, URL{URL: "http://host/deep", HostID: sql.NullInt64{Int64: hostID, Valid: true},
+			Depth: 3, Priority: initialPriority(3, 1, sql.NullFloat64{Valid: false})})
+
+		helperRunWorker(db, []*proxy.PageData{
+			helperNewPage(hostID, "http://host/", 0, "http://host/new", "http://host/deep")}, nil)
+
+		priorities := helperGetColumn(db, "priority")
+		So(priorities["http://host/new"], ShouldAlmostEqual, initialPriority(1, 1, sql.NullFloat64{Valid: false}))
+		So(priorities["http://host/deep"], ShouldAlmostEqual,
+			initialPriority(3, 1, sql.NullFloat64{Valid: false})+2*priorityDepthWeight)
+		So(helperGetURL(db, "http://host/deep").Depth, ShouldEqual, 1)
+	})
+}
+
+// TestPriorityFactors ...
+func TestPriorityFactors(t *testing.T) {
+	Convey("Factors of not loaded URLs", t, func() {
+		db, closeDB := helperOpenDB()
+		defer closeDB()
+		hostID := sql.NullInt64{Int64: helperAddHost(db, "host"), Valid: true}
+		rootID := helperAddURL(db, URL{URL: "http://host/", HostID: hostID, Loaded: true})
+		pageID := helperAddURL(db, URL{URL: "http://host/page", HostID: hostID, Loaded: true})
+		aID := helperAddURL(db, URL{URL: "http://host/a", HostID: hostID, Depth: 1, Rank: 1.5})
+		bID := helperAddURL(db, URL{URL: "http://host/b", HostID: hostID, Depth: 2})
+		So(db.Create(&Link{Master: rootID, Slave: aID}).Error, ShouldBeNil)
+		So(db.Create(&Link{Master: pageID, Slave: aID}).Error, ShouldBeNil)
+		So(db.Create(&Link{Master: rootID, Slave: pageID}).Error, ShouldBeNil)
+		So(db.Create(&database.SitemapHint{URL: bID, Priority: 0.8}).Error, ShouldBeNil)
+
+		factors, err := db.GetPriorityFactors()
+		So(err, ShouldBeNil)
+		So(len(factors), ShouldEqual, 2)
+		byID := make(map[int64]PriorityFactors, len(factors))
+		for _, item := range factors {
+			byID[item.ID] = item
+		}
+		So(byID[aID], ShouldResemble, PriorityFactors{ID: aID, Depth: 1, Rank: 1.5, InLinks: 2,
+			SitemapPriority: sql.NullFloat64{Valid: false}})
+		So(byID[bID], ShouldResemble, PriorityFactors{ID: bID, Depth: 2, Rank: 0, InLinks: 0,
+			SitemapPriority: sql.NullFloat64{Float64: 0.8, Valid: true}})
+	})
+}
+
+// TestUpdateColumn ...
+func TestUpdateColumn(t *testing.T) {
+	Convey("Priorities are updated by batches", t, func() {
+		db, closeDB := helperOpenDB()
+		defer closeDB()
+		hostID := sql.NullInt64{Int64: helperAddHost(db, "host"), Valid: true}
+		cnt := 2*updateBatchSize + 1
+		priorities := make(map[int64]float64, cnt)
+		for i := 0; i != cnt; i++ {
+			id := helperAddURL(db, URL{URL: fmt.Sprintf("http://host/%d", i), HostID: hostID, Priority: 1})
+			priorities[id] = float64(i)
+		}
+		helperAddURL(db, URL{URL: "http://host/other", HostID: hostID, Priority: 1})
+
+		So(db.UpdatePriorities(priorities), ShouldBeNil)
+
+		result := helperGetColumn(db, "priority")
+		for i := 0; i != cnt; i++ {
+			So(result[fmt.Sprintf("http://host/%d", i)], ShouldEqual, float64(i))
+		}
+		So(result["http://host/other"], ShouldEqual, 1)
+	})
+
+	Convey("Ranks are replaced, rank of URL without links is reset", t, func() {
+		db, closeDB := helperOpenDB()
+		defer closeDB()
+		hostID := sql.NullInt64{Int64: helperAddHost(db, "host"), Valid: true}
+		aID := helperAddURL(db, URL{URL: "http://host/a", HostID: hostID, Rank: 2})
+		bID := helperAddURL(db, URL{URL: "http://host/b", HostID: hostID, Rank: 3})
+		helperAddURL(db, URL{URL: "http://host/c", HostID: hostID, Rank: 4})
+
+		So(db.UpdateRanks(map[int64]float64{aID: 0.5, bID: 1.5}), ShouldBeNil)
+
+		So(helperGetColumn(db, "rank"), ShouldResemble,
+			map[string]float64{"http://host/a": 0.5, "http://host/b": 1.5, "http://host/c": 0})
+	})
+
+	Convey("Ranks are reset and updated in one transaction", t, func() {
+		db, closeDB := helperOpenDB()
+		defer closeDB()
+		hostID := sql.NullInt64{Int64: helperAddHost(db, "host"), Valid: true}
+		aID := helperAddURL(db, URL{URL: "http://host/a", HostID: hostID, Rank: 2})
+		helperAddURL(db, URL{URL: "http://host/b", HostID: hostID, Rank: 3})
+		So(db.Exec("create trigger fail_rank before update of rank on url when new.rank = 7 "+
+			"begin select raise(abort, 'fail'); end").Error, ShouldBeNil)
+
+		So(db.UpdateRanks(map[int64]float64{aID: 7}), ShouldNotBeNil)
+
+		So(helperGetColumn(db, "rank"), ShouldResemble, map[string]float64{"http://host/a": 2, "http://host/b": 3})
+	})
+}
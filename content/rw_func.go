@@ -3,10 +3,14 @@ package content
 import (
 	"database/sql"
 	"fmt"
+	"time"
 )
 
 // Transaction - execute fn in transaction
 func (db *DBrw) Transaction(fn func(*DBrw) error) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
 	tr := db.DB.Begin()
 	if tr.Error != nil {
 		return fmt.Errorf("create transaction, message: %s", tr.Error)
@@ -31,15 +35,47 @@ func (db *DBrw) Transaction(fn func(*DBrw) error) error {
 	return nil
 }
 
-// GetNewURLs - get URLs for downloads for host
-func (db *DBrw) GetNewURLs(hostID int64, cnt int) ([]URL, error) {
-	var urls []URL
-	err := db.Where("host_id = ? and loaded = ?", hostID, false).Limit(cnt).Find(&urls).Error
+// GetNewURLs - get URLs for downloads for host, now - current time by clock of crawler
+// canonical URLs of loaded pages are first, then URLs in order of priority
+func (db *DBrw) GetNewURLs(hostID int64, cnt int, now time.Time) ([]Task, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	var tasks []Task
+	err := db.Table("url").
+		Select("url.*, sitemap_hint.change_freq").
+		Joins("left join sitemap_hint on sitemap_hint.url = url.id").
+		Where("url.host_id = ? and url.loaded = ?", hostID, false).
+		Where("url.next_retry is null or url.next_retry <= ?", now).
+		Order("exists (select 1 from meta where meta.canonical = url.id) desc").
+		Order("url.priority desc").Order("url.id").
+		Limit(cnt).Scan(&tasks).Error
+	if err != nil {
+		return tasks, fmt.Errorf("find not loaded pages in 'URL' table for host %d, message: %s", hostID, err)
+	}
+
+	return tasks, nil
+}
+
+// GetRecrawlURLs - get loaded URLs for host with expired recrawl time, now - current time by clock of crawler
+func (db *DBrw) GetRecrawlURLs(hostID int64, cnt int, now time.Time) ([]Task, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	var tasks []Task
+	err := db.Table("url").
+		Select("url.*, meta.etag, meta.last_modified, meta.recrawl_interval, content.hash, sitemap_hint.change_freq").
+		Joins("join meta on meta.url = url.id").
+		Joins("left join content on content.url = url.id").
+		Joins("left join sitemap_hint on sitemap_hint.url = url.id").
+		Where("url.host_id = ? and url.loaded = ? and meta.next_fetch_at <= ?", hostID, true, now).
+		Where("url.next_retry is null or url.next_retry <= ?", now).
+		Order("meta.next_fetch_at").Limit(cnt).Scan(&tasks).Error
 	if err != nil {
-		return urls, fmt.Errorf("find not loaded pages in 'URL' table for host %d, message: %s", hostID, err)
+		return tasks, fmt.Errorf("find pages for recrawl in 'URL' table for host %d, message: %s", hostID, err)
 	}
 
-	return urls, nil
+	return tasks, nil
 }
 
 // FindOrigin - find origin url id in table 'URL'
@@ -55,3 +91,71 @@ func (db *DBrw) FindOrigin(hash string) sql.NullInt64 {
 func (db *DBrw) AddHash(hash string, urlID int64) {
 	db.hashes[hash] = urlID
 }
+
+// RemoveHash - remove hash from hash storage, if it belongs to urlID
+func (db *DBrw) RemoveHash(hash string, urlID int64) {
+	if id, exists := db.hashes[hash]; exists && id == urlID {
+		delete(db.hashes, hash)
+	}
+}
+
+// GetPriorityFactors - get data for priority calculation of not loaded URLs
+func (db *DBrw) GetPriorityFactors() ([]PriorityFactors, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	var result []PriorityFactors
+	err := db.Table("url").
+		Select("url.id, url.depth, url.rank, sitemap_hint.priority as sitemap_priority, "+
+			"(select count(*) from link where link.slave = url.id) as in_links").
+		Joins("left join sitemap_hint on sitemap_hint.url = url.id").
+		Where("url.loaded = ?", false).
+		Scan(&result).Error
+	if err != nil {
+		return result, fmt.Errorf("find not loaded pages in 'URL' table for priority, message: %s", err)
+	}
+
+	return result, nil
+}
+
+// UpdatePriorities - save priorities of URLs, map[URL.ID]priority
+func (db *DBrw) UpdatePriorities(priorities map[int64]float64) error {
+	return db.updateColumn("priority", priorities)
+}
+
+// GetLinks - get next cnt rows from table 'Link' after link in order of master and slave,
+// so all links are read by parts without long lock of db
+func (db *DBrw) GetLinks(after Link, cnt int) ([]Link, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	var links []Link
+	err := db.Where("master > ? or (master = ? and slave > ?)", after.Master, after.Master, after.Slave).
+		Order("master, slave").
+		Limit(cnt).
+		Find(&links).Error
+	if err != nil {
+		return links, fmt.Errorf("get links from 'Link' table, message: %s", err)
+	}
+
+	return links, nil
+}
+
+// UpdateRanks - save PageRank of URLs, map[URL.ID]rank, rank of URLs without links is reset,
+// reset and update are done in one transaction, so readers never see reset ranks
+func (db *DBrw) UpdateRanks(ranks map[int64]float64) error {
+	return db.Transaction(func(tr *DBrw) error {
+		err := tr.Model(&URL{}).Where("rank != 0").Update("rank", 0).Error
+		if err != nil {
+			return fmt.Errorf("reset rank of URLs, message: %s", err)
+		}
+		for _, batch := range columnBatches(ranks) {
+			err = tr.updateColumnBatch("rank", batch, ranks)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
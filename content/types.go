@@ -1,6 +1,9 @@
 package content
 
-import "database/sql"
+import (
+	"database/sql"
+	"time"
+)
 
 // Link - links between pages
 type Link struct {
@@ -9,9 +12,54 @@ type Link struct {
 }
 
 // URL - struct for save all URLs in db
+// Attempts - count of failed download attempts with transient error
+// NextRetry - time of next download attempt (nil - as soon as possible)
+// Depth - min click depth from seed (seed URLs and URLs from sitemap have depth 0)
+// Priority - download order of not loaded URLs for host (greater - earlier)
+// Rank - PageRank of URL multiplied by count of URLs (average value is 1)
 type URL struct {
-	ID     int64         `gorm:"primary_key;not null"`
-	URL    string        `gorm:"size:2048;not null;unique_index"`
-	HostID sql.NullInt64 `gorm:"type:integer REFERENCES host(id);index"`
-	Loaded bool          `gorm:"not null;index"`
+	ID        int64         `gorm:"primary_key;not null"`
+	URL       string        `gorm:"size:2048;not null;unique_index"`
+	HostID    sql.NullInt64 `gorm:"type:integer REFERENCES host(id);index"`
+	Loaded    bool          `gorm:"not null;index"`
+	Attempts  int           `gorm:"not null;default:0"`
+	NextRetry *time.Time
+	Depth     int     `gorm:"not null;default:0"`
+	Priority  float64 `gorm:"not null;default:0;index"`
+	Rank      float64 `gorm:"not null;default:0"`
+}
+
+// PriorityFactors - data for calculation of URL priority
+// InLinks - count of links to URL
+// SitemapPriority - value of <priority> from sitemap (NULL - URL not found in sitemap)
+type PriorityFactors struct {
+	ID              int64
+	Depth           int
+	Rank            float64
+	InLinks         int
+	SitemapPriority sql.NullFloat64
+}
+
+// Task - URL for download with data from previous download
+// ID, URL, HostID, Loaded, Attempts, Depth - fields from URL
+// ETag, LastModified, RecrawlInterval - fields from database.Meta (empty for new URLs)
+// Hash - hash of previous content (empty for new URLs)
+// ChangeFreq - field from database.SitemapHint (empty if URL not found in sitemap)
+type Task struct {
+	ID              int64
+	URL             string
+	HostID          sql.NullInt64
+	Loaded          bool
+	Attempts        int
+	Depth           int
+	ETag            string `gorm:"column:etag"`
+	LastModified    string
+	RecrawlInterval int64
+	Hash            string
+	ChangeFreq      string
+}
+
+// IsRecrawl - URL was loaded before
+func (t *Task) IsRecrawl() bool {
+	return t.Loaded
 }
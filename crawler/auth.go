@@ -0,0 +1,141 @@
+package crawler
+
+import (
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/ReanGD/go-web-search/werrors"
+	"github.com/uber-go/zap"
+)
+
+// loginRetryDelay - delay before next attempt of failed login
+const loginRetryDelay = time.Minute
+
+// HostAuth - authentication settings for host
+type HostAuth struct {
+	// Username, Password - credentials for basic auth
+	Username string
+	Password string
+	// BearerToken - token for header "Authorization: Bearer <token>"
+	BearerToken string
+	// LoginURL - URL for POST of login form before crawling of host ("" - without login)
+	LoginURL string
+	// LoginForm - fields of login form
+	LoginForm url.Values
+	// AllowInsecureLogin - allow to send login form to http:// URL (credentials are sent without encryption)
+	AllowInsecureLogin bool
+}
+
+// authManager - apply authentication settings to requests
+type authManager struct {
+	mu sync.Mutex
+	// auths - map[hostName]settings
+	auths map[string]*HostAuth
+	// loggedIn - map[hostName]true, if login was successful and session is not expired
+	loggedIn map[string]bool
+	// nextLogin - map[hostName]time of next attempt after failed login
+	nextLogin map[string]time.Time
+}
+
+func newAuthManager(auths map[string]*HostAuth) (*authManager, error) {
+	result := &authManager{
+		auths:     make(map[string]*HostAuth, len(auths)),
+		loggedIn:  make(map[string]bool),
+		nextLogin: make(map[string]time.Time)}
+	for hostName, auth := range auths {
+		if auth.LoginURL != "" {
+			loginURL, err := url.Parse(auth.LoginURL)
+			if err != nil {
+				return nil, werrors.NewFields(ErrLoginURL,
+					zap.String("details", err.Error()),
+					zap.String("url", auth.LoginURL))
+			}
+			if loginURL.Scheme != "https" && !auth.AllowInsecureLogin {
+				return nil, werrors.NewFields(ErrLoginURL,
+					zap.String("details", "login form is sent only by https, see HostAuth.AllowInsecureLogin"),
+					zap.String("url", auth.LoginURL))
+			}
+		}
+		result.auths[NormalizeHostName(hostName)] = auth
+	}
+
+	return result, nil
+}
+
+func (a *authManager) get(hostName string) (string, *HostAuth) {
+	hostName = NormalizeHostName(hostName)
+	return hostName, a.auths[hostName]
+}
+
+// Apply - set header Authorization for host of request
+// header is removed for other hosts, so credentials are not sent after redirect to another host
+func (a *authManager) Apply(request *http.Request) {
+	request.Header.Del("Authorization")
+	_, auth := a.get(urlHostName(request.URL))
+	if auth == nil {
+		return
+	}
+
+	if auth.BearerToken != "" {
+		request.Header.Set("Authorization", "Bearer "+auth.BearerToken)
+	} else if auth.Username != "" {
+		request.SetBasicAuth(auth.Username, auth.Password)
+	}
+}
+
+// NeedLogin - check that host needs login: login is not done or session is expired,
+// failed login is repeated after loginRetryDelay
+func (a *authManager) NeedLogin(hostName string, now time.Time) (*HostAuth, bool) {
+	hostName, auth := a.get(hostName)
+	if auth == nil || auth.LoginURL == "" {
+		return nil, false
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.loggedIn[hostName] || now.Before(a.nextLogin[hostName]) {
+		return nil, false
+	}
+
+	return auth, true
+}
+
+// SetLoginResult - save result of login for host
+func (a *authManager) SetLoginResult(hostName string, ok bool, now time.Time) {
+	hostName = NormalizeHostName(hostName)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.loggedIn[hostName] = ok
+	if ok {
+		delete(a.nextLogin, hostName)
+	} else {
+		a.nextLogin[hostName] = now.Add(loginRetryDelay)
+	}
+}
+
+// CheckSession - reset login of host, if response shows, that session is expired:
+// status code is 401 or 403, or request is redirected to login URL
+func (a *authManager) CheckSession(hostName string, statusCode int, finalURL *url.URL) {
+	hostName, auth := a.get(hostName)
+	if auth == nil || auth.LoginURL == "" {
+		return
+	}
+
+	expired := statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden
+	if !expired && finalURL != nil {
+		loginURL, err := url.Parse(auth.LoginURL)
+		expired = err == nil && urlHostName(loginURL) == urlHostName(finalURL) &&
+			loginURL.Path == finalURL.Path
+	}
+	if !expired {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.loggedIn, hostName)
+}
@@ -0,0 +1,154 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// TestAuthApply ...
+func TestAuthApply(t *testing.T) {
+	Convey("Authorization header by host", t, func() {
+		a, err := newAuthManager(map[string]*HostAuth{
+			"www.basic": {Username: "user", Password: "password"},
+			"bearer":    {BearerToken: "token"}})
+		So(err, ShouldBeNil)
+
+		request, err := http.NewRequest("GET", "http://basic/page", nil)
+		So(err, ShouldBeNil)
+		a.Apply(request)
+		username, password, ok := request.BasicAuth()
+		So(ok, ShouldBeTrue)
+		So(username, ShouldEqual, "user")
+		So(password, ShouldEqual, "password")
+
+		request, err = http.NewRequest("GET", "http://www.bearer/page", nil)
+		So(err, ShouldBeNil)
+		a.Apply(request)
+		So(request.Header.Get("Authorization"), ShouldEqual, "Bearer token")
+
+		request, err = http.NewRequest("GET", "http://other/page", nil)
+		So(err, ShouldBeNil)
+		request.Header.Set("Authorization", "Bearer token")
+		a.Apply(request)
+		So(request.Header.Get("Authorization"), ShouldEqual, "")
+	})
+
+	Convey("Login form is not sent without https", t, func() {
+		_, err := newAuthManager(map[string]*HostAuth{"host": {LoginURL: "http://host/login"}})
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, ErrLoginURL)
+
+		_, err = newAuthManager(map[string]*HostAuth{"host": {LoginURL: "http://host/login", AllowInsecureLogin: true}})
+		So(err, ShouldBeNil)
+		_, err = newAuthManager(map[string]*HostAuth{"host": {LoginURL: "https://host/login"}})
+		So(err, ShouldBeNil)
+	})
+}
+
+func helperLoginManager(ts *httptest.Server, auth *HostAuth, now *time.Time) (*hostsManager, string) {
+	parsedURL, err := url.Parse(ts.URL)
+	So(err, ShouldBeNil)
+	auth.LoginURL = ts.URL + "/login"
+	auth.AllowInsecureLogin = true
+	a, err := newAuthManager(map[string]*HostAuth{parsedURL.Host: auth})
+	So(err, ShouldBeNil)
+	h := &hostsManager{
+		hosts: map[string]int64{parsedURL.Host: 1},
+		auth:  a,
+		now:   func() time.Time { return *now }}
+
+	return h, parsedURL.Host
+}
+
+// TestLogin ...
+func TestLogin(t *testing.T) {
+	Convey("Login form is sent once and session cookie is saved", t, func() {
+		cnt := 0
+		var method string
+		var form url.Values
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cnt++
+			method = r.Method
+			_ = r.ParseForm()
+			form = r.PostForm
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "id", MaxAge: 3600})
+		}))
+		defer ts.Close()
+
+		loginForm := url.Values{"login": {"user"}, "password": {"secret"}}
+		now := time.Now()
+		h, hostName := helperLoginManager(ts, &HostAuth{LoginForm: loginForm}, &now)
+		db := &fakeDbHost{}
+		jar := newCookieJar(h, db)
+		h.client = &http.Client{Jar: jar}
+
+		So(h.Login(hostName), ShouldBeNil)
+		So(h.Login(hostName), ShouldBeNil)
+		So(cnt, ShouldEqual, 1)
+		So(method, ShouldEqual, "POST")
+		So(form, ShouldResemble, loginForm)
+		So(len(db.cookies), ShouldEqual, 1)
+		So(db.cookies[0].GetCookie().Name, ShouldEqual, "session")
+		So(db.cookies[0].GetCookie().Expires.IsZero(), ShouldBeFalse)
+		So(len(jar.Cookies(&url.URL{Scheme: "http", Host: hostName, Path: "/"})), ShouldEqual, 1)
+	})
+
+	Convey("Login error", t, func() {
+		cnt := 0
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cnt++
+			http.Error(w, "forbidden", 403)
+		}))
+		defer ts.Close()
+
+		now := time.Now()
+		h, hostName := helperLoginManager(ts, &HostAuth{}, &now)
+		err := h.Login(hostName)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, ErrLogin)
+
+		// failed login is repeated after delay
+		So(h.Login(hostName), ShouldBeNil)
+		So(cnt, ShouldEqual, 1)
+		now = now.Add(loginRetryDelay)
+		So(h.Login(hostName), ShouldNotBeNil)
+		So(cnt, ShouldEqual, 2)
+	})
+
+	Convey("Login is repeated after session is expired", t, func() {
+		cnt := 0
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/login":
+				if r.Method == "POST" {
+					cnt++
+				}
+			case "/private":
+				http.Error(w, "unauthorized", 401)
+			default:
+				http.Redirect(w, r, "/login?next=/page", http.StatusFound)
+			}
+		}))
+		defer ts.Close()
+
+		now := time.Now()
+		h, hostName := helperLoginManager(ts, &HostAuth{}, &now)
+		So(h.Login(hostName), ShouldBeNil)
+		So(h.Login(hostName), ShouldBeNil)
+		So(cnt, ShouldEqual, 1)
+
+		for i, path := range []string{"/private", "/page"} {
+			response, err := http.Get(ts.URL + path)
+			So(err, ShouldBeNil)
+			So(response.Body.Close(), ShouldBeNil)
+			h.CheckSession(hostName, response)
+			So(h.Login(hostName), ShouldBeNil)
+			So(cnt, ShouldEqual, i+2)
+		}
+	})
+}
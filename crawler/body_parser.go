@@ -4,7 +4,7 @@ package crawler
 import (
 	"bufio"
 	"bytes"
-	"compress/gzip"
+	"errors"
 	"io"
 	"io/ioutil"
 
@@ -17,33 +17,161 @@ import (
 	"golang.org/x/text/transform"
 )
 
-func readBody(contentEncoding string, body io.Reader) ([]byte, error) {
-	var err error
+// bodyLimits - limits of response body size (0 - unlimited)
+type bodyLimits struct {
+	// maxSize - max count of bytes read from connection
+	maxSize int64
+	// maxDecodedSize - max count of bytes after Content-Encoding decoding
+	maxDecodedSize int64
+	// truncate - oversized body is truncated to limit, otherwise it is error
+	truncate bool
+}
+
+func newBodyLimits(cfg *Config) *bodyLimits {
+	return &bodyLimits{
+		maxSize:        cfg.MaxBodySize,
+		maxDecodedSize: cfg.MaxDecodedBodySize,
+		truncate:       cfg.TruncateBody}
+}
+
+// bodySize - byte counts of read body
+type bodySize struct {
+	// read - count of bytes read from connection
+	read int64
+	// decoded - count of bytes after decoding (and truncation)
+	decoded int64
+	// truncated - body was truncated by limits
+	truncated bool
+}
+
+type countingReader struct {
+	reader io.Reader
+	cnt    int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.cnt += int64(n)
+	return n, err
+}
+
+// errReadOverflow - body is read until limit, it is returned by overflowReader instead of io.EOF
+var errReadOverflow = errors.New("body size limit is reached")
+
+// overflowReader - reader with limit, returns errReadOverflow if limit is reached
+// decoders fail with this error on cut off stream, so it is separated from real read and decode errors
+type overflowReader struct {
+	reader io.Reader
+	left   int64
+}
+
+func (r *overflowReader) Read(p []byte) (int, error) {
+	if r.left <= 0 {
+		return 0, errReadOverflow
+	}
+	if int64(len(p)) > r.left {
+		p = p[:r.left]
+	}
+	n, err := r.reader.Read(p)
+	r.left -= int64(n)
+
+	return n, err
+}
+
+func readLimitReader(reader io.Reader, limit int64) io.Reader {
+	if limit <= 0 {
+		return reader
+	}
+	// one extra byte for detection of overflow
+	return &overflowReader{reader: reader, left: limit + 1}
+}
+
+func limitReader(reader io.Reader, limit int64) io.Reader {
+	if limit <= 0 {
+		return reader
+	}
+	// one extra byte for detection of overflow
+	return io.LimitReader(reader, limit+1)
+}
+
+// readBody - read and decode body, limits can be nil
+func readBody(contentEncoding string, body io.Reader, limits *bodyLimits) ([]byte, bodySize, error) {
 	result := []byte{}
-	if contentEncoding == "gzip" {
-		reader, err := gzip.NewReader(body)
-		if err != nil {
-			return result, werrors.NewDetails(ErrReadGZipResponse, err)
-		}
-		result, err = ioutil.ReadAll(reader)
-		if err == nil {
-			err = reader.Close()
-		} else {
-			_ = reader.Close()
-		}
-		if err != nil {
-			return result, werrors.NewDetails(ErrReadGZipResponse, err)
+	size := bodySize{}
+	if limits == nil {
+		limits = &bodyLimits{}
+	}
+	bodyDecoders, unknown := findDecoders(contentEncoding)
+	if unknown != "" {
+		return result, size, werrors.NewFields(ErrUnknownContentEncoding, zap.String("encoding", unknown))
+	}
+
+	readers := make([]io.ReadCloser, 0, len(bodyDecoders))
+	closeReaders := func() error {
+		var err error
+		for i := len(readers) - 1; i >= 0; i-- {
+			errClose := readers[i].Close()
+			if err == nil {
+				err = errClose
+			}
 		}
-	} else if contentEncoding == "identity" || contentEncoding == "" {
-		result, err = ioutil.ReadAll(body)
+		return err
+	}
+
+	counter := &countingReader{reader: body}
+	reader := readLimitReader(counter, limits.maxSize)
+	for _, info := range bodyDecoders {
+		decodeReader, err := info.decoder(reader)
 		if err != nil {
-			return result, werrors.NewDetails(ErrReadResponse, err)
+			_ = closeReaders()
+			size.read = counter.cnt
+			return result, size, werrors.NewDetails(info.errMsg, err)
 		}
+		readers = append(readers, decodeReader)
+		reader = decodeReader
+	}
+
+	result, err := ioutil.ReadAll(limitReader(reader, limits.maxDecodedSize))
+	if err == nil {
+		err = closeReaders()
 	} else {
-		return result, werrors.NewFields(ErrUnknownContentEncoding, zap.String("encoding", contentEncoding))
+		_ = closeReaders()
+	}
+
+	size.read = counter.cnt
+	readOverflow := limits.maxSize > 0 && counter.cnt > limits.maxSize
+	decodedOverflow := limits.maxDecodedSize > 0 && int64(len(result)) > limits.maxDecodedSize
+	if readOverflow {
+		size.read = limits.maxSize
+		if len(bodyDecoders) == 0 && int64(len(result)) > limits.maxSize {
+			result = result[:limits.maxSize]
+		}
+	}
+	if err == errReadOverflow {
+		// stream is cut off, decoded prefix is available
+		err = nil
+	}
+	if decodedOverflow {
+		result = result[:limits.maxDecodedSize]
+	}
+	size.decoded = int64(len(result))
+	size.truncated = readOverflow || decodedOverflow
+
+	if err != nil {
+		if len(bodyDecoders) == 0 {
+			return result, size, werrors.NewDetails(ErrReadResponse, err)
+		}
+		return result, size, werrors.NewDetails(bodyDecoders[len(bodyDecoders)-1].errMsg, err)
+	}
+	if size.truncated && !limits.truncate {
+		return result, size, werrors.NewEx(zap.WarnLevel, ErrBodyTooLarge,
+			zap.Int64("read_size", size.read),
+			zap.Int64("decoded_size", size.decoded),
+			zap.Int64("max_size", limits.maxSize),
+			zap.Int64("max_decoded_size", limits.maxDecodedSize))
 	}
 
-	return result, nil
+	return result, size, nil
 }
 
 func isHTML(content []byte) bool {
@@ -2,7 +2,9 @@ package crawler
 
 import (
 	"bytes"
+	"compress/flate"
 	"compress/gzip"
+	"compress/zlib"
 	"errors"
 	"io/ioutil"
 	"os"
@@ -10,6 +12,8 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
 	"golang.org/x/net/html"
 
 	. "github.com/smartystreets/goconvey/convey"
@@ -35,14 +39,14 @@ func TestReadBody(t *testing.T) {
 		So(err, ShouldBeNil)
 
 		body := bytes.NewReader(buf.Bytes())
-		result, err := readBody("gzip", body)
+		result, _, err := readBody("gzip", body, nil)
 		So(err, ShouldBeNil)
 		So(string(result), ShouldEqual, string(msg))
 	})
 
 	Convey("gzip body open error", t, func() {
 		body := bytes.NewReader([]byte("raw body"))
-		_, err := readBody("gzip", body)
+		_, _, err := readBody("gzip", body, nil)
 		So(err.Error(), ShouldEqual, ErrReadGZipResponse)
 	})
 
@@ -55,14 +59,14 @@ func TestReadBody(t *testing.T) {
 		So(err, ShouldBeNil)
 
 		body := bytes.NewReader(buf.Bytes()[:10])
-		_, err = readBody("gzip", body)
+		_, _, err = readBody("gzip", body, nil)
 		So(err.Error(), ShouldEqual, ErrReadGZipResponse)
 	})
 
 	Convey("raw body", t, func() {
 		data := []byte("test body")
 		body := bytes.NewReader(data)
-		result, err := readBody("identity", body)
+		result, _, err := readBody("identity", body, nil)
 		So(err, ShouldBeNil)
 		So(string(result), ShouldEqual, string(data))
 	})
@@ -70,19 +74,177 @@ func TestReadBody(t *testing.T) {
 	Convey("raw body with empty content-encoding", t, func() {
 		data := []byte("test body")
 		body := bytes.NewReader(data)
-		result, err := readBody("identity", body)
+		result, _, err := readBody("identity", body, nil)
 		So(err, ShouldBeNil)
 		So(string(result), ShouldEqual, string(data))
 	})
 
 	Convey("raw body error", t, func() {
-		_, err := readBody("identity", errReader{})
+		_, _, err := readBody("identity", errReader{}, nil)
 		So(err.Error(), ShouldEqual, ErrReadResponse)
 	})
 
 	Convey("unknown body error", t, func() {
-		_, err := readBody("unknown", errReader{})
+		_, _, err := readBody("unknown", errReader{}, nil)
 		So(err.Error(), ShouldEqual, ErrUnknownContentEncoding)
+
+		_, _, err = readBody("gzip, unknown", errReader{}, nil)
+		So(err.Error(), ShouldEqual, ErrUnknownContentEncoding)
+	})
+
+	Convey("br body", t, func() {
+		msg := []byte("raw body")
+		var buf bytes.Buffer
+		w := brotli.NewWriter(&buf)
+		_, err := w.Write(msg)
+		So(err, ShouldBeNil)
+		So(w.Close(), ShouldBeNil)
+
+		result, _, err := readBody("br", bytes.NewReader(buf.Bytes()), nil)
+		So(err, ShouldBeNil)
+		So(string(result), ShouldEqual, string(msg))
+	})
+
+	Convey("zstd body", t, func() {
+		msg := []byte("raw body")
+		var buf bytes.Buffer
+		w, err := zstd.NewWriter(&buf)
+		So(err, ShouldBeNil)
+		_, err = w.Write(msg)
+		So(err, ShouldBeNil)
+		So(w.Close(), ShouldBeNil)
+
+		result, _, err := readBody("zstd", bytes.NewReader(buf.Bytes()), nil)
+		So(err, ShouldBeNil)
+		So(string(result), ShouldEqual, string(msg))
+	})
+
+	Convey("deflate body in zlib and raw formats", t, func() {
+		msg := []byte("raw body")
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		_, err := zw.Write(msg)
+		So(err, ShouldBeNil)
+		So(zw.Close(), ShouldBeNil)
+
+		result, _, err := readBody("deflate", bytes.NewReader(buf.Bytes()), nil)
+		So(err, ShouldBeNil)
+		So(string(result), ShouldEqual, string(msg))
+
+		buf.Reset()
+		fw, err := flate.NewWriter(&buf, flate.DefaultCompression)
+		So(err, ShouldBeNil)
+		_, err = fw.Write(msg)
+		So(err, ShouldBeNil)
+		So(fw.Close(), ShouldBeNil)
+
+		result, _, err = readBody("Deflate", bytes.NewReader(buf.Bytes()), nil)
+		So(err, ShouldBeNil)
+		So(string(result), ShouldEqual, string(msg))
+	})
+
+	Convey("stacked encodings", t, func() {
+		msg := []byte("raw body")
+		var gzipBuf bytes.Buffer
+		gw := gzip.NewWriter(&gzipBuf)
+		_, err := gw.Write(msg)
+		So(err, ShouldBeNil)
+		So(gw.Close(), ShouldBeNil)
+
+		var buf bytes.Buffer
+		bw := brotli.NewWriter(&buf)
+		_, err = bw.Write(gzipBuf.Bytes())
+		So(err, ShouldBeNil)
+		So(bw.Close(), ShouldBeNil)
+
+		result, _, err := readBody("x-gzip, identity, br", bytes.NewReader(buf.Bytes()), nil)
+		So(err, ShouldBeNil)
+		So(string(result), ShouldEqual, string(msg))
+	})
+
+	Convey("decode error", t, func() {
+		_, _, err := readBody("zstd", bytes.NewReader([]byte("raw body")), nil)
+		So(err.Error(), ShouldEqual, ErrDecodeResponse)
+	})
+}
+
+// TestReadBodyLimits ...
+func TestReadBodyLimits(t *testing.T) {
+	helperGZipBody := func(data []byte) []byte {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		_, err := w.Write(data)
+		So(err, ShouldBeNil)
+		So(w.Close(), ShouldBeNil)
+		return buf.Bytes()
+	}
+
+	Convey("Body in limits", t, func() {
+		limits := &bodyLimits{maxSize: 100, maxDecodedSize: 100}
+		result, size, err := readBody("gzip", bytes.NewReader(helperGZipBody([]byte("raw body"))), limits)
+		So(err, ShouldBeNil)
+		So(string(result), ShouldEqual, "raw body")
+		So(size.decoded, ShouldEqual, 8)
+		So(size.read, ShouldBeGreaterThan, 8)
+		So(size.truncated, ShouldBeFalse)
+	})
+
+	Convey("Raw body is truncated", t, func() {
+		limits := &bodyLimits{maxSize: 4, truncate: true}
+		result, size, err := readBody("", bytes.NewReader([]byte("raw body")), limits)
+		So(err, ShouldBeNil)
+		So(string(result), ShouldEqual, "raw ")
+		So(size, ShouldResemble, bodySize{read: 4, decoded: 4, truncated: true})
+	})
+
+	Convey("Decoded body is truncated (gzip bomb)", t, func() {
+		limits := &bodyLimits{maxSize: 4096, maxDecodedSize: 1000, truncate: true}
+		body := helperGZipBody(bytes.Repeat([]byte("a"), 1024*1024))
+		So(len(body), ShouldBeLessThan, 4096)
+		result, size, err := readBody("gzip", bytes.NewReader(body), limits)
+		So(err, ShouldBeNil)
+		So(len(result), ShouldEqual, 1000)
+		So(size.decoded, ShouldEqual, 1000)
+		So(size.truncated, ShouldBeTrue)
+	})
+
+	Convey("Compressed body is truncated", t, func() {
+		data := make([]byte, 64*1024)
+		for i := range data {
+			data[i] = byte(i * 7919 % 251)
+		}
+		body := helperGZipBody(data)
+		limits := &bodyLimits{maxSize: int64(len(body) / 2), truncate: true}
+		result, size, err := readBody("gzip", bytes.NewReader(body), limits)
+		So(err, ShouldBeNil)
+		So(size.read, ShouldEqual, limits.maxSize)
+		So(size.truncated, ShouldBeTrue)
+		So(len(result), ShouldBeLessThan, len(data))
+		So(result, ShouldResemble, data[:len(result)])
+	})
+
+	Convey("Decode error is kept for oversized body", t, func() {
+		data := make([]byte, 64*1024)
+		for i := range data {
+			data[i] = byte(i * 7919 % 251)
+		}
+		body := helperGZipBody(data)
+		for i := 20; i < len(body)/2; i++ {
+			body[i] = 0xff
+		}
+		limits := &bodyLimits{maxSize: int64(len(body) - 10), truncate: true}
+		_, size, err := readBody("gzip", bytes.NewReader(body), limits)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, ErrReadGZipResponse)
+		So(size.truncated, ShouldBeTrue)
+	})
+
+	Convey("Oversized body without truncation", t, func() {
+		limits := &bodyLimits{maxSize: 4}
+		_, size, err := readBody("", bytes.NewReader([]byte("raw body")), limits)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, ErrBodyTooLarge)
+		So(size.truncated, ShouldBeTrue)
 	})
 }
 
@@ -0,0 +1,176 @@
+package crawler
+
+import "time"
+
+// Config - crawler settings
+type Config struct {
+	// BaseHosts - hosts for crawling
+	BaseHosts []string
+	// PageBudget - max count of downloaded pages per run (0 - unlimited)
+	PageBudget int
+	// FrontierBatch - count of URLs loaded from db for one host per query
+	FrontierBatch int
+	// FrontierRefillWait - wait before next query to db, if queue for host is empty
+	FrontierRefillWait time.Duration
+	// MinDelay - min delay between requests to one host
+	MinDelay time.Duration
+	// MaxDelay - max delay between requests to one host (except robots.txt Crawl-delay and Retry-After)
+	MaxDelay time.Duration
+	// LatencyFactor - delay is not less than average response latency multiplied by factor
+	LatencyFactor float64
+	// RetryMaxAttempts - max count of download attempts for URL with transient errors
+	RetryMaxAttempts int
+	// RetryBaseDelay - delay before second download attempt, doubled for every next attempt
+	RetryBaseDelay time.Duration
+	// RetryMaxDelay - max delay between download attempts
+	RetryMaxDelay time.Duration
+	// RecrawlInitInterval - interval between first download and first recrawl of page
+	RecrawlInitInterval time.Duration
+	// RecrawlMinInterval - min interval between recrawls of page
+	RecrawlMinInterval time.Duration
+	// RecrawlMaxInterval - max interval between recrawls of page
+	RecrawlMaxInterval time.Duration
+	// SitemapMaxFiles - max count of sitemap files loaded for new host (0 - sitemaps are disabled)
+	SitemapMaxFiles int
+	// MaxBodySize - max count of bytes read from response body (0 - unlimited)
+	MaxBodySize int64
+	// MaxDecodedBodySize - max size of response body after Content-Encoding decoding (0 - unlimited)
+	MaxDecodedBodySize int64
+	// TruncateBody - oversized body is truncated to limit and indexed, otherwise page gets StateTooLarge
+	TruncateBody bool
+	// Proxy - proxy for all requests: http://[user:password@]host:port or socks5://[user:password@]host:port
+	// ("" - direct connection)
+	Proxy string
+	// HostProxies - map[hostName]proxy URL, overrides Proxy for host ("direct" - direct connection)
+	HostProxies map[string]string
+	// HostAuth - map[hostName]authentication settings
+	HostAuth map[string]*HostAuth
+	// Identity - user agent, robots.txt token and headers of crawler
+	Identity *Identity
+	// RobotsTxtTTL - lifetime of downloaded robots.txt, after that it is downloaded again (0 - unlimited)
+	RobotsTxtTTL time.Duration
+	// RobotsTxtCheckInterval - interval of checks for expired robots.txt while crawling
+	RobotsTxtCheckInterval time.Duration
+	// DialTimeout - timeout of TCP connection to server (or proxy)
+	DialTimeout time.Duration
+	// TLSHandshakeTimeout - timeout of TLS handshake
+	TLSHandshakeTimeout time.Duration
+	// ResponseHeaderTimeout - timeout of waiting for response headers after request is sent (time to first byte)
+	ResponseHeaderTimeout time.Duration
+	// RequestTimeout - timeout of whole request include redirects and body reading (0 - unlimited)
+	RequestTimeout time.Duration
+	// BodyIdleTimeout - max time without new data while body is read (0 - unlimited)
+	BodyIdleTimeout time.Duration
+	// KeepAlive - interval of TCP keep-alive probes for open connections
+	KeepAlive time.Duration
+	// MaxIdleConns - max count of idle connections in pool for all hosts
+	MaxIdleConns int
+	// MaxIdleConnsPerHost - max count of idle connections in pool for one host
+	MaxIdleConnsPerHost int
+	// IdleConnTimeout - idle connection is closed after timeout
+	IdleConnTimeout time.Duration
+	// EnableHTTP2 - use HTTP/2 for https hosts, if server supports it
+	EnableHTTP2 bool
+	// MetaRefreshMaxDelay - <meta http-equiv="refresh"> with delay not greater than value is followed
+	// like HTTP redirect, with greater delay target is saved as plain link
+	MetaRefreshMaxDelay time.Duration
+	// HostRules - map[hostName]include/exclude URL patterns and limits of crawling
+	HostRules map[string]*HostRules
+	// TrapMaxPathRepeats - URL with path segment repeated more times is crawler trap (0 - check disabled)
+	TrapMaxPathRepeats int
+	// TrapMaxQueryVariants - path template with more distinct sets or orderings of query parameter names
+	// is crawler trap (0 - check disabled)
+	TrapMaxQueryVariants int
+	// TrapMaxSameContent - path template with more distinct URLs of same content is crawler trap
+	// (0 - check disabled)
+	TrapMaxSameContent int
+	// QueryPolicies - map[hostName]policy of query parameters, applied by normalization of found URLs
+	// (hosts without policy - default tracking and session parameters are removed)
+	QueryPolicies map[string]*QueryPolicy
+	// DiscoveryMaxHosts - max count of hosts from links, that are added for crawling per run
+	// (0 - discovery is disabled, only BaseHosts are crawled)
+	DiscoveryMaxHosts int
+	// DiscoveryAllow - discovered hosts for crawling: host name or domain suffix rule
+	// ("*.ixbt.com" - all subdomains of ixbt.com), empty - all hosts
+	DiscoveryAllow []string
+	// DiscoveryDeny - discovered hosts, that are not crawled, has priority over DiscoveryAllow
+	DiscoveryDeny []string
+	// PriorityUpdateInterval - interval of recalculation of URL priorities for frontier
+	// (0 - priorities are not updated, URLs are downloaded in order of addition)
+	PriorityUpdateInterval time.Duration
+	// PageRankInterval - interval of PageRank recalculation for URL priorities (0 - PageRank is disabled)
+	PageRankInterval time.Duration
+	// PageRankIterations - count of iterations of PageRank calculation
+	PageRankIterations int
+	// FetchMode - source of HTTP responses: network, network with record of exchanges or replay of records
+	FetchMode FetchMode
+	// FetchDir - directory of recorded exchanges for FetchRecord and FetchReplay modes
+	FetchDir string
+	// Clock - current time for crawler (nil - system clock), fake clock makes replay reproducible
+	Clock func() time.Time
+	// WarcDir - directory for WARC files with raw HTTP exchanges ("" - WARC output is disabled)
+	WarcDir string
+	// WarcPrefix - prefix of WARC file names
+	WarcPrefix string
+	// WarcMaxFileSize - new WARC file is started, when size of current file exceeds limit (0 - unlimited)
+	WarcMaxFileSize int64
+}
+
+// now - clock of crawler
+func (c *Config) now() func() time.Time {
+	if c.Clock == nil {
+		return time.Now
+	}
+
+	return c.Clock
+}
+
+// NewConfig - create Config with default values
+func NewConfig(baseHosts []string, pageBudget int) *Config {
+	return &Config{
+		BaseHosts:              baseHosts,
+		PageBudget:             pageBudget,
+		FrontierBatch:          100,
+		FrontierRefillWait:     10 * time.Second,
+		MinDelay:               time.Second,
+		MaxDelay:               time.Minute,
+		LatencyFactor:          2,
+		RetryMaxAttempts:       5,
+		RetryBaseDelay:         time.Minute,
+		RetryMaxDelay:          6 * time.Hour,
+		RecrawlInitInterval:    24 * time.Hour,
+		RecrawlMinInterval:     time.Hour,
+		RecrawlMaxInterval:     30 * 24 * time.Hour,
+		SitemapMaxFiles:        20,
+		MaxBodySize:            10 * 1024 * 1024,
+		MaxDecodedBodySize:     20 * 1024 * 1024,
+		TruncateBody:           true,
+		HostProxies:            make(map[string]string),
+		HostAuth:               make(map[string]*HostAuth),
+		Identity:               NewIdentity(),
+		RobotsTxtTTL:           24 * time.Hour,
+		RobotsTxtCheckInterval: 10 * time.Minute,
+		DialTimeout:            10 * time.Second,
+		TLSHandshakeTimeout:    10 * time.Second,
+		ResponseHeaderTimeout:  30 * time.Second,
+		RequestTimeout:         2 * time.Minute,
+		BodyIdleTimeout:        30 * time.Second,
+		KeepAlive:              30 * time.Second,
+		MaxIdleConns:           100,
+		MaxIdleConnsPerHost:    2,
+		IdleConnTimeout:        90 * time.Second,
+		EnableHTTP2:            true,
+		MetaRefreshMaxDelay:    5 * time.Second,
+		HostRules:              make(map[string]*HostRules),
+		TrapMaxPathRepeats:     3,
+		TrapMaxQueryVariants:   200,
+		TrapMaxSameContent:     20,
+		QueryPolicies:          make(map[string]*QueryPolicy),
+		PriorityUpdateInterval: 10 * time.Minute,
+		PageRankInterval:       time.Hour,
+		PageRankIterations:     20,
+		FetchMode:              FetchLive,
+		FetchDir:               "exchanges",
+		WarcPrefix:             "gws",
+		WarcMaxFileSize:        1024 * 1024 * 1024}
+}
@@ -13,6 +13,10 @@ const (
 	ErrHTMLParse = "HTML parse error"
 	// ErrReadGZipResponse - Can't read response body as gzip archive
 	ErrReadGZipResponse = "Read response body as a gzip archive error"
+	// ErrDecodeResponse - Can't decode response body by Content-Encoding
+	ErrDecodeResponse = "Decode response body by Content-Encoding error"
+	// ErrBodyTooLarge - Response body size exceeds limit
+	ErrBodyTooLarge = "Response body size exceeds limit"
 	// ErrReadResponse - Can't read response body archive
 	ErrReadResponse = "Read response body error"
 	// ErrUnknownContentEncoding - Unknown http header Content-Encoding
@@ -39,14 +43,36 @@ const (
 	ErrCreateRobotsTxtFromDb = "Create robots.txt from db data"
 	// ErrCreateRobotsTxtFromURL - Error create robots.txt from url
 	ErrCreateRobotsTxtFromURL = "Create robots.txt from url"
+	// ErrLogin - Error send login form
+	ErrLogin = "Send login form"
+	// ErrLoginURL - Error wrong or insecure login URL in config
+	ErrLoginURL = "Wrong login URL"
+	// ErrParseProxyURL - Error parse proxy URL from config
+	ErrParseProxyURL = "Parse proxy URL"
+	// ErrParseSitemap - Error parse sitemap xml
+	ErrParseSitemap = "Parse sitemap"
+	// ErrParseURLPattern - Error parse URL pattern of host rules from config
+	ErrParseURLPattern = "Parse URL pattern"
+	// ErrRecordExchange - Error save HTTP exchange in record mode of fetcher
+	ErrRecordExchange = "Record HTTP exchange"
+	// ErrReplayExchange - Error load saved HTTP exchange in replay mode of fetcher
+	ErrReplayExchange = "Replay HTTP exchange"
+	// ErrReadWarc - Error read WARC record
+	ErrReadWarc = "Read WARC record"
+	// ErrWriteWarc - Error write WARC record
+	ErrWriteWarc = "Write WARC record"
 	// WarnPageNotIndexed - Page not indexed
 	WarnPageNotIndexed = "Page not indexed (meta tag noindex)"
+	// WarnBodyTruncated - Response body truncated by size limit
+	WarnBodyTruncated = "Response body truncated by size limit"
 	// InfoUnsupportedMimeFormat - Unsupported mime format
 	InfoUnsupportedMimeFormat = "Unsupported mime format"
 	// DbgRequestDuration - Request duration
 	DbgRequestDuration = "Request duration"
 	// DbgBodyProcessingDuration - Body processing duration
 	DbgBodyProcessingDuration = "Body processing duration"
+	// DbgBodyReadSize - Body size before processing
+	DbgBodyReadSize = "Body read size"
 	// DbgBodySize - Body size after processing
 	DbgBodySize = "Body size"
 )
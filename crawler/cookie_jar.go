@@ -0,0 +1,114 @@
+package crawler
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/ReanGD/go-web-search/proxy"
+	"golang.org/x/net/publicsuffix"
+)
+
+// cookieJar - separate cookie jar for every crawled host, cookies of crawled hosts are saved to db
+// cookies of external hosts are kept in memory only
+type cookieJar struct {
+	mu      sync.Mutex
+	hostMng *hostsManager
+	db      proxy.DbHost
+	// jars - map[hostID]jar, key 0 - jar for external hosts
+	jars map[int64]*cookiejar.Jar
+}
+
+func newCookieJar(hostMng *hostsManager, db proxy.DbHost) *cookieJar {
+	return &cookieJar{
+		hostMng: hostMng,
+		db:      db,
+		jars:    make(map[int64]*cookiejar.Jar)}
+}
+
+func (j *cookieJar) findJar(key int64) (*cookiejar.Jar, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	jar, ok := j.jars[key]
+	return jar, ok
+}
+
+// getJar - get jar of host, saved cookies are loaded from db without lock of j.mu
+func (j *cookieJar) getJar(hostID sql.NullInt64) *cookiejar.Jar {
+	key := int64(0)
+	if hostID.Valid {
+		key = hostID.Int64
+	}
+	if jar, ok := j.findJar(key); ok {
+		return jar
+	}
+
+	jar, _ := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	if hostID.Valid && j.db != nil {
+		cookies, err := j.db.GetCookies(hostID.Int64)
+		if err != nil {
+			log.Printf("ERROR: Load cookies for host %d, message: %s", hostID.Int64, err)
+		}
+		for _, item := range cookies {
+			u, err := url.Parse(item.GetURL())
+			if err == nil {
+				jar.SetCookies(u, []*http.Cookie{item.GetCookie()})
+			}
+		}
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	// jar can be created by another goroutine while cookies were loaded
+	if existing, ok := j.jars[key]; ok {
+		return existing
+	}
+	j.jars[key] = jar
+
+	return jar
+}
+
+// cookieForSave - copy of cookie with absolute expiration time (Max-Age is converted to Expires)
+func cookieForSave(cookie *http.Cookie, now time.Time) *http.Cookie {
+	result := *cookie
+	if cookie.MaxAge < 0 {
+		result.Expires = time.Unix(1, 0)
+	} else if cookie.MaxAge > 0 {
+		result.Expires = now.Add(time.Duration(cookie.MaxAge) * time.Second)
+	}
+	result.MaxAge = 0
+	result.Raw = ""
+	result.RawExpires = ""
+
+	return &result
+}
+
+// SetCookies - implementation of http.CookieJar
+func (j *cookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	hostID := j.hostMng.ResolveHost(urlHostName(u))
+	j.getJar(hostID).SetCookies(u, cookies)
+	if !hostID.Valid || j.db == nil || len(cookies) == 0 {
+		return
+	}
+
+	now := j.hostMng.Now()
+	urlStr := (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}).String()
+	items := make([]*proxy.Cookie, 0, len(cookies))
+	for _, cookie := range cookies {
+		items = append(items, proxy.NewCookie(urlStr, cookieForSave(cookie, now)))
+	}
+	err := j.db.SaveCookies(hostID.Int64, items, now)
+	if err != nil {
+		log.Printf("ERROR: Save cookies for host %d, message: %s", hostID.Int64, err)
+	}
+}
+
+// Cookies - implementation of http.CookieJar
+func (j *cookieJar) Cookies(u *url.URL) []*http.Cookie {
+	return j.getJar(j.hostMng.ResolveHost(urlHostName(u))).Cookies(u)
+}
@@ -0,0 +1,63 @@
+package crawler
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ReanGD/go-web-search/proxy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// TestCookieJar ...
+func TestCookieJar(t *testing.T) {
+	Convey("Cookies are restored from db", t, func() {
+		h := &hostsManager{hosts: map[string]int64{"host": 1}}
+		db := &fakeDbHost{cookies: []*proxy.Cookie{
+			proxy.NewCookie("http://host/", &http.Cookie{Name: "consent", Value: "yes", Path: "/"})}}
+		jar := newCookieJar(h, db)
+
+		cookies := jar.Cookies(&url.URL{Scheme: "http", Host: "host", Path: "/page"})
+		So(len(cookies), ShouldEqual, 1)
+		So(cookies[0].Name, ShouldEqual, "consent")
+		So(jar.Cookies(&url.URL{Scheme: "http", Host: "other", Path: "/page"}), ShouldBeEmpty)
+	})
+
+	Convey("Cookies of external hosts are not saved", t, func() {
+		h := &hostsManager{hosts: map[string]int64{"host": 1}}
+		db := &fakeDbHost{}
+		jar := newCookieJar(h, db)
+
+		u := &url.URL{Scheme: "http", Host: "external", Path: "/"}
+		jar.SetCookies(u, []*http.Cookie{{Name: "name", Value: "value"}})
+		So(db.cookies, ShouldBeEmpty)
+		So(len(jar.Cookies(u)), ShouldEqual, 1)
+	})
+
+	Convey("Cookies are saved by clock of crawler", t, func() {
+		now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		h := &hostsManager{hosts: map[string]int64{"host": 1}, now: func() time.Time { return now }}
+		db := &fakeDbHost{}
+		jar := newCookieJar(h, db)
+
+		jar.SetCookies(&url.URL{Scheme: "http", Host: "host", Path: "/"}, []*http.Cookie{{Name: "name", Value: "value", MaxAge: 60}})
+		So(len(db.cookies), ShouldEqual, 1)
+		So(db.cookiesSaved, ShouldResemble, now)
+		So(db.cookies[0].GetCookie().Expires, ShouldResemble, now.Add(time.Minute))
+	})
+
+	Convey("Max-Age is converted to expiration time", t, func() {
+		now := time.Now()
+		cookie := cookieForSave(&http.Cookie{Name: "name", MaxAge: 60, Raw: "name=value"}, now)
+		So(cookie.Expires, ShouldResemble, now.Add(time.Minute))
+		So(cookie.MaxAge, ShouldEqual, 0)
+		So(cookie.Raw, ShouldEqual, "")
+
+		cookie = cookieForSave(&http.Cookie{Name: "name", MaxAge: -1}, now)
+		So(proxy.NewCookie("", cookie).IsExpired(now), ShouldBeTrue)
+
+		cookie = cookieForSave(&http.Cookie{Name: "name"}, now)
+		So(proxy.NewCookie("", cookie).IsExpired(now), ShouldBeFalse)
+	})
+}
@@ -11,15 +11,18 @@ import (
 	"github.com/uber-go/zap"
 )
 
+// dbQueueSize - buffer size of channel between host workers and db worker
+const dbQueueSize = 1000
+
 func showTotalTime(msg string, start time.Time) {
 	fmt.Printf("\n%s%v\n", msg, time.Now().Sub(start))
 }
 
-// Run - start download cnt pages
-func Run(logger zap.Logger, baseHosts []string, cnt int) error {
+// Run - crawl until page budget is exhausted or stop channel is closed
+func Run(logger zap.Logger, cfg *Config, stop <-chan struct{}) error {
 	now := time.Now()
 	defer showTotalTime("Total time=", now)
-	if cnt <= 0 || len(baseHosts) == 0 {
+	if cfg.PageBudget < 0 || len(cfg.BaseHosts) == 0 {
 		return nil
 	}
 
@@ -30,22 +33,24 @@ func Run(logger zap.Logger, baseHosts []string, cnt int) error {
 	}
 	defer db.Close()
 
+	// db worker is started before init of workers, it saves cookies of hosts while init
 	workers := new(hostWorkers)
-	err = workers.Init(db, logger, baseHosts, cnt)
-	if err != nil {
-		log.Printf("ERROR: %s", err)
-		return err
-	}
-
 	var wgDB sync.WaitGroup
 	defer wgDB.Wait()
-	chDB := make(chan *proxy.PageData, cnt)
-	dbWorker := content.DBWorker{DB: db, ChDB: chDB}
+	chDB := make(chan *proxy.PageData, dbQueueSize)
+	defer close(chDB)
+	chOps := make(chan content.DBOperation, dbQueueSize)
+	dbWorker := content.DBWorker{DB: db, ChDB: chDB, ChOps: chOps, OnSaved: workers.Saved}
 	wgDB.Add(1)
 	go dbWorker.Start(&wgDB)
 
+	err = workers.Init(db, chOps, logger, cfg, stop)
+	if err != nil {
+		log.Printf("ERROR: %s", err)
+		return err
+	}
+
 	workers.Start(chDB)
-	close(chDB)
 	showTotalTime("Workes time=", now)
 
 	return nil
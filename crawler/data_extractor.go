@@ -31,6 +31,9 @@ func (extractor *dataExtractor) parseRef(node *html.Node) {
 }
 
 func (extractor *dataExtractor) parseLink(node *html.Node) {
+	if hasRel(extractor.getAttrVal(node, "rel"), "canonical") {
+		extractor.meta.SetCanonical(extractor.getAttrVal(node, "href"), false)
+	}
 	if extractor.isEnableLinkParse() {
 		rel := extractor.getAttrValLower(node, "rel")
 		if rel == "next" || rel == "prev" || rel == "previous" {
@@ -45,7 +48,23 @@ func (extractor *dataExtractor) parseFrame(node *html.Node) {
 	}
 }
 
+// parseRefresh - parse <meta http-equiv="refresh">, target is also added as plain link
+func (extractor *dataExtractor) parseRefresh(node *html.Node) {
+	delay, link, ok := parseRefreshContent(extractor.getAttrVal(node, "content"))
+	if !ok {
+		return
+	}
+	extractor.meta.SetRefresh(link, delay)
+	if extractor.isEnableLinkParse() {
+		extractor.meta.AddURL(link)
+	}
+}
+
 func (extractor *dataExtractor) parseMeta(node *html.Node) {
+	if extractor.getAttrValLower(node, "http-equiv") == "refresh" {
+		extractor.parseRefresh(node)
+		return
+	}
 	name := extractor.getAttrValLower(node, "name")
 	if name == "robots" || name == "googlebot" {
 		content := extractor.getAttrValLower(node, "content")
@@ -126,11 +145,13 @@ func (extractor *dataExtractor) parseNode(node *html.Node) error {
 }
 
 // RunDataExtrator - extart URLs and other meta data from page
-func RunDataExtrator(hostMng *hostsManager, node *html.Node, urlStr string) (*HTMLMetadata, error) {
+// depth - click depth of page from seed
+func RunDataExtrator(hostMng *hostsManager, node *html.Node, urlStr string, depth int) (*HTMLMetadata, error) {
 	meta, err := NewHTMLMetadata(hostMng, urlStr)
 	if err != nil {
 		return nil, err
 	}
+	meta.SetDepth(depth)
 
 	extractor := dataExtractor{
 		meta:          meta,
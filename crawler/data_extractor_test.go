@@ -15,7 +15,7 @@ func helperRunDataExtrator(htmlStr string) *HTMLMetadata {
 	So(err, ShouldBeNil)
 
 	hostMng := &hostsManager{hosts: map[string]int64{"testhost1": 1}}
-	meta, err := RunDataExtrator(hostMng, node, "http://testhost1/test/")
+	meta, err := RunDataExtrator(hostMng, node, "http://testhost1/test/", 0)
 	So(err, ShouldBeNil)
 
 	return meta
@@ -97,6 +97,54 @@ func TestURLs(t *testing.T) {
 	})
 }
 
+// TestCanonical ...
+func TestCanonical(t *testing.T) {
+	Convey("First canonical link is used", t, func() {
+		meta := helperRunDataExtrator(`<html><head>
+<link rel="Canonical" href="/Page?b=2&a=1">
+<link rel="canonical" href="/other">
+</head></html>`)
+
+		canonical, hostID := meta.GetCanonical()
+		So(canonical, ShouldEqual, "http://testhost1/Page?a=1&b=2")
+		So(hostID, ShouldResemble, sql.NullInt64{Int64: 1, Valid: true})
+		So(meta.URLs, ShouldBeEmpty)
+	})
+
+	Convey("Canonical link with nofollow", t, func() {
+		meta := helperRunDataExtrator(`<html><head>
+<meta name="robots" content="nofollow">
+<link rel="canonical" href="page">
+</head></html>`)
+
+		canonical, _ := meta.GetCanonical()
+		So(canonical, ShouldEqual, "http://testhost1/test/page")
+	})
+
+	Convey("Canonical link to external host is ignored", t, func() {
+		meta := helperRunDataExtrator(`<html><head>
+<link rel="canonical" href="http://testhost2/page">
+</head></html>`)
+
+		canonical, hostID := meta.GetCanonical()
+		So(canonical, ShouldEqual, "")
+		So(hostID.Valid, ShouldBeFalse)
+	})
+
+	Convey("Header Link has priority", t, func() {
+		meta := helperRunDataExtrator(`<html><head>
+<link rel="canonical" href="/html">
+</head></html>`)
+
+		meta.SetCanonical("", true)
+		canonical, _ := meta.GetCanonical()
+		So(canonical, ShouldEqual, "http://testhost1/html")
+		meta.SetCanonical("/header", true)
+		canonical, _ = meta.GetCanonical()
+		So(canonical, ShouldEqual, "http://testhost1/header")
+	})
+}
+
 // TestParseTitle ...
 func TestParseTitle(t *testing.T) {
 	Convey("Title as url", t, func() {
@@ -201,7 +249,7 @@ func TestErrorDataExtrator(t *testing.T) {
 
 		node.FirstChild.Type = html.ErrorNode
 		hostMng := &hostsManager{}
-		_, err = RunDataExtrator(hostMng, node, "http://testhost1/test/")
+		_, err = RunDataExtrator(hostMng, node, "http://testhost1/test/", 0)
 		So(err, ShouldNotBeNil)
 		So(err.Error(), ShouldEqual, ErrUnexpectedNodeType)
 	})
@@ -211,7 +259,7 @@ func TestErrorDataExtrator(t *testing.T) {
 		So(err, ShouldBeNil)
 
 		hostMng := &hostsManager{}
-		_, err = RunDataExtrator(hostMng, node, "%1")
+		_, err = RunDataExtrator(hostMng, node, "%1", 0)
 		So(err, ShouldNotBeNil)
 		So(err.Error(), ShouldEqual, ErrParseBaseURL)
 	})
@@ -0,0 +1,33 @@
+package crawler
+
+import (
+	"time"
+
+	"github.com/ReanGD/go-web-search/content"
+	"github.com/ReanGD/go-web-search/proxy"
+)
+
+// dbQueue - proxy.DbHost, where writes of workers are sent to DBWorker,
+// so workers are not blocked by own transactions and do not run them inside transaction of DBWorker
+type dbQueue struct {
+	*content.DBrw
+	ops chan<- content.DBOperation
+}
+
+func newDbQueue(db *content.DBrw, ops chan<- content.DBOperation) *dbQueue {
+	return &dbQueue{DBrw: db, ops: ops}
+}
+
+// SaveCookies - add, update or delete (expired) cookies of host by DBWorker
+func (q *dbQueue) SaveCookies(hostID int64, cookies []*proxy.Cookie, now time.Time) error {
+	q.ops <- content.SaveCookiesOp(hostID, cookies, now)
+
+	return nil
+}
+
+// SaveTrap - add quarantined pattern of host or update its hits by DBWorker
+func (q *dbQueue) SaveTrap(trap *proxy.Trap) error {
+	q.ops <- content.SaveTrapOp(trap)
+
+	return nil
+}
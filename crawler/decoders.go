@@ -0,0 +1,133 @@
+package crawler
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Decoder - create reader for body with Content-Encoding
+type Decoder func(body io.Reader) (io.ReadCloser, error)
+
+type decoderInfo struct {
+	name    string
+	quality float64
+	decoder Decoder
+	// errMsg - error message for werrors
+	errMsg string
+}
+
+var decodersMu sync.RWMutex
+
+// decoders - map[Content-Encoding]decoderInfo
+var decoders = map[string]*decoderInfo{
+	"gzip":    {name: "gzip", quality: 1, decoder: newGZipDecoder, errMsg: ErrReadGZipResponse},
+	"br":      {name: "br", quality: 1, decoder: newBrotliDecoder, errMsg: ErrDecodeResponse},
+	"zstd":    {name: "zstd", quality: 0.9, decoder: newZstdDecoder, errMsg: ErrDecodeResponse},
+	"deflate": {name: "deflate", quality: 0.8, decoder: newDeflateDecoder, errMsg: ErrDecodeResponse},
+}
+
+// decoderAliases - obsolete names of Content-Encoding
+var decoderAliases = map[string]string{
+	"x-gzip": "gzip",
+}
+
+func newGZipDecoder(body io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(body)
+}
+
+func newBrotliDecoder(body io.Reader) (io.ReadCloser, error) {
+	return ioutil.NopCloser(brotli.NewReader(body)), nil
+}
+
+func newZstdDecoder(body io.Reader) (io.ReadCloser, error) {
+	reader, err := zstd.NewReader(body, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+
+	return reader.IOReadCloser(), nil
+}
+
+// newDeflateDecoder - "deflate" is zlib format by RFC, but some servers send raw deflate
+func newDeflateDecoder(body io.Reader) (io.ReadCloser, error) {
+	reader := bufio.NewReader(body)
+	header, err := reader.Peek(2)
+	if err == nil && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(reader)
+	}
+
+	return flate.NewReader(reader), nil
+}
+
+// RegisterDecoder - add or replace decoder for Content-Encoding
+// quality - preference of encoding in Accept-Encoding header (0.0 - 1.0)
+func RegisterDecoder(name string, quality float64, decoder Decoder) {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+
+	name = strings.ToLower(name)
+	decoders[name] = &decoderInfo{name: name, quality: quality, decoder: decoder, errMsg: ErrDecodeResponse}
+}
+
+// findDecoders - get decoders for Content-Encoding value in order of decoding
+// result is empty for identity encoding
+func findDecoders(contentEncoding string) ([]*decoderInfo, string) {
+	decodersMu.RLock()
+	defer decodersMu.RUnlock()
+
+	result := make([]*decoderInfo, 0)
+	encodings := strings.Split(contentEncoding, ",")
+	// encodings are listed in the order in which they were applied
+	for i := len(encodings) - 1; i >= 0; i-- {
+		name := strings.ToLower(strings.TrimSpace(encodings[i]))
+		if alias, ok := decoderAliases[name]; ok {
+			name = alias
+		}
+		if name == "" || name == "identity" {
+			continue
+		}
+		info, ok := decoders[name]
+		if !ok {
+			return nil, name
+		}
+		result = append(result, info)
+	}
+
+	return result, ""
+}
+
+// acceptEncoding - get value of Accept-Encoding header for registered decoders
+func acceptEncoding() string {
+	decodersMu.RLock()
+	items := make([]*decoderInfo, 0, len(decoders))
+	for _, info := range decoders {
+		items = append(items, info)
+	}
+	decodersMu.RUnlock()
+
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].quality != items[j].quality {
+			return items[i].quality > items[j].quality
+		}
+		return items[i].name < items[j].name
+	})
+
+	values := make([]string, 0, len(items)+1)
+	for _, info := range items {
+		values = append(values, fmt.Sprintf("%s;q=%.1f", info.name, info.quality))
+	}
+	values = append(values, "identity;q=0.5")
+
+	return strings.Join(values, ",")
+}
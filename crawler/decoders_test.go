@@ -0,0 +1,55 @@
+package crawler
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// TestAcceptEncoding ...
+func TestAcceptEncoding(t *testing.T) {
+	Convey("Accept-Encoding is built from registered decoders", t, func() {
+		So(acceptEncoding(), ShouldEqual, "br;q=1.0,gzip;q=1.0,zstd;q=0.9,deflate;q=0.8,identity;q=0.5")
+	})
+
+	Convey("Register new decoder", t, func() {
+		RegisterDecoder("X-Test", 0.2, func(body io.Reader) (io.ReadCloser, error) {
+			return ioutil.NopCloser(body), nil
+		})
+		defer func() {
+			decodersMu.Lock()
+			delete(decoders, "x-test")
+			decodersMu.Unlock()
+		}()
+
+		So(acceptEncoding(), ShouldEqual, "br;q=1.0,gzip;q=1.0,zstd;q=0.9,deflate;q=0.8,x-test;q=0.2,identity;q=0.5")
+		result, _, err := readBody("x-test", bytes.NewReader([]byte("raw body")), nil)
+		So(err, ShouldBeNil)
+		So(string(result), ShouldEqual, "raw body")
+	})
+}
+
+// TestFindDecoders ...
+func TestFindDecoders(t *testing.T) {
+	Convey("Decoders are in reverse order of encodings", t, func() {
+		result, unknown := findDecoders("gzip, identity, BR")
+		So(unknown, ShouldEqual, "")
+		So(len(result), ShouldEqual, 2)
+		So(result[0].name, ShouldEqual, "br")
+		So(result[1].name, ShouldEqual, "gzip")
+	})
+
+	Convey("Identity encoding", t, func() {
+		result, unknown := findDecoders("")
+		So(unknown, ShouldEqual, "")
+		So(result, ShouldBeEmpty)
+	})
+
+	Convey("Unknown encoding", t, func() {
+		_, unknown := findDecoders("gzip, compress")
+		So(unknown, ShouldEqual, "compress")
+	})
+}
@@ -0,0 +1,112 @@
+package crawler
+
+import (
+	"strings"
+	"sync"
+)
+
+// discoverySuffixPrefix - prefix of domain suffix rule ("*.ixbt.com" - all subdomains of ixbt.com)
+const discoverySuffixPrefix = "*."
+
+// hostMatcher - list of host names and domain suffixes
+type hostMatcher struct {
+	hosts    map[string]struct{}
+	suffixes []string
+}
+
+func newHostMatcher(rules []string) *hostMatcher {
+	result := &hostMatcher{hosts: make(map[string]struct{})}
+	for _, rule := range rules {
+		if strings.HasPrefix(rule, discoverySuffixPrefix) {
+			result.suffixes = append(result.suffixes, "."+hostToASCII(rule[len(discoverySuffixPrefix):]))
+		} else {
+			result.hosts[NormalizeHostName(rule)] = struct{}{}
+		}
+	}
+
+	return result
+}
+
+// Empty - list has no rules
+func (m *hostMatcher) Empty() bool {
+	return len(m.hosts) == 0 && len(m.suffixes) == 0
+}
+
+// Match - check normalized host name
+func (m *hostMatcher) Match(hostName string) bool {
+	if _, ok := m.hosts[hostName]; ok {
+		return true
+	}
+	name, _ := splitHostPort(hostName)
+	for _, suffix := range m.suffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hostDiscovery - select unknown hosts from links for crawling
+type hostDiscovery struct {
+	allow *hostMatcher
+	deny  *hostMatcher
+	// maxHosts - max count of new hosts per run
+	maxHosts int
+	mu       sync.Mutex
+	// checked - set of host names, that were already checked
+	checked map[string]struct{}
+	added   int
+	queue   chan string
+}
+
+// newHostDiscovery - create hostDiscovery, returns nil if discovery is disabled
+func newHostDiscovery(cfg *Config) *hostDiscovery {
+	if cfg.DiscoveryMaxHosts <= 0 {
+		return nil
+	}
+
+	return &hostDiscovery{
+		allow:    newHostMatcher(cfg.DiscoveryAllow),
+		deny:     newHostMatcher(cfg.DiscoveryDeny),
+		maxHosts: cfg.DiscoveryMaxHosts,
+		checked:  make(map[string]struct{}),
+		queue:    make(chan string, cfg.DiscoveryMaxHosts)}
+}
+
+// Allowed - check host name by allow and deny lists (deny has priority, empty allow list - all hosts)
+func (d *hostDiscovery) Allowed(hostName string) bool {
+	if d.deny.Match(hostName) {
+		return false
+	}
+
+	return d.allow.Empty() || d.allow.Match(hostName)
+}
+
+// Offer - offer unknown host from link, allowed host is added to queue while limit is not exhausted
+func (d *hostDiscovery) Offer(hostName string) bool {
+	hostName = NormalizeHostName(hostName)
+	if hostName == "" {
+		return false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.checked[hostName]; ok {
+		return false
+	}
+	d.checked[hostName] = struct{}{}
+	if d.added >= d.maxHosts || !d.Allowed(hostName) {
+		return false
+	}
+	d.added++
+	d.queue <- hostName
+
+	return true
+}
+
+// Queue - channel of discovered hosts for initialization
+func (d *hostDiscovery) Queue() <-chan string {
+	return d.queue
+}
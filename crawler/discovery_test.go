@@ -0,0 +1,106 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/temoto/robotstxt-go"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func helperHostDiscovery(allow []string, deny []string, maxHosts int) *hostDiscovery {
+	cfg := NewConfig(nil, 0)
+	cfg.DiscoveryAllow = allow
+	cfg.DiscoveryDeny = deny
+	cfg.DiscoveryMaxHosts = maxHosts
+
+	return newHostDiscovery(cfg)
+}
+
+// TestHostDiscovery ...
+func TestHostDiscovery(t *testing.T) {
+	Convey("Discovery is disabled by default", t, func() {
+		So(newHostDiscovery(NewConfig(nil, 0)), ShouldBeNil)
+	})
+
+	Convey("Allow and deny lists", t, func() {
+		d := helperHostDiscovery([]string{"*.ixbt.com", "www.Habr.com"}, []string{"forum.ixbt.com"}, 10)
+		So(d.Allowed("news.ixbt.com"), ShouldBeTrue)
+		So(d.Allowed("a.b.ixbt.com:8080"), ShouldBeTrue)
+		So(d.Allowed("habr.com"), ShouldBeTrue)
+		So(d.Allowed("forum.ixbt.com"), ShouldBeFalse)
+		So(d.Allowed("ixbt.com.evil.org"), ShouldBeFalse)
+		So(d.Allowed("other.com"), ShouldBeFalse)
+	})
+
+	Convey("Empty allow list", t, func() {
+		d := helperHostDiscovery(nil, []string{"*.com"}, 10)
+		So(d.Allowed("host.ru"), ShouldBeTrue)
+		So(d.Allowed("host.com"), ShouldBeFalse)
+	})
+
+	Convey("Limit of new hosts", t, func() {
+		d := helperHostDiscovery(nil, nil, 2)
+		So(d.Offer("www.Host1.ru"), ShouldBeTrue)
+		So(d.Offer("host1.ru"), ShouldBeFalse)
+		So(d.Offer("host2.ru"), ShouldBeTrue)
+		So(d.Offer("host3.ru"), ShouldBeFalse)
+		So(<-d.Queue(), ShouldEqual, "host1.ru")
+		So(<-d.Queue(), ShouldEqual, "host2.ru")
+	})
+
+	Convey("Links to unknown hosts are offered", t, func() {
+		hostMng := &hostsManager{
+			hosts:     map[string]int64{"testhost1": 1},
+			discovery: helperHostDiscovery([]string{"*.testhost1"}, nil, 10)}
+		h, err := NewHTMLMetadata(hostMng, "http://testhost1/test/")
+		So(err, ShouldBeNil)
+		h.AddURL("http://sub.testhost1/page")
+		h.AddURL("http://other/page")
+		h.AddURL("/local")
+		So(len(h.URLs), ShouldEqual, 3)
+		So(len(hostMng.discovery.Queue()), ShouldEqual, 1)
+		So(<-hostMng.discovery.Queue(), ShouldEqual, "sub.testhost1")
+	})
+}
+
+// TestAddDiscoveredHost ...
+func TestAddDiscoveredHost(t *testing.T) {
+	Convey("Concurrent add of discovered host", t, func() {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("User-agent: *"))
+		}))
+		defer ts.Close()
+		parsedURL, err := url.Parse(ts.URL)
+		So(err, ShouldBeNil)
+
+		h := &hostsManager{
+			robotsTxt: make(map[int64]*robotstxt.Group),
+			hosts:     make(map[string]int64)}
+		db := &fakeDbHost{}
+
+		var wg sync.WaitGroup
+		ids := make([]int64, 4)
+		errs := make([]error, 4)
+		for i := range ids {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				ids[i], errs[i] = h.AddHost(db, parsedURL.Host)
+			}(i)
+			go h.ResolveHost(parsedURL.Host)
+			go h.GetHosts()
+		}
+		wg.Wait()
+
+		for i := range ids {
+			So(errs[i], ShouldBeNil)
+			So(ids[i], ShouldEqual, 1)
+		}
+		So(h.GetHosts(), ShouldResemble, map[string]int64{parsedURL.Host: 1})
+	})
+}
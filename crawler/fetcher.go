@@ -0,0 +1,188 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ReanGD/go-web-search/werrors"
+	"github.com/uber-go/zap"
+)
+
+// FetchMode - source of HTTP responses for crawler
+type FetchMode uint8
+
+const (
+	// FetchLive - send requests to network
+	FetchLive FetchMode = 0
+	// FetchRecord - send requests to network and save exchanges to Config.FetchDir
+	FetchRecord FetchMode = 1
+	// FetchReplay - serve saved exchanges from Config.FetchDir without network
+	FetchReplay FetchMode = 2
+)
+
+// Fetcher - one HTTP exchange (without redirects) for robots.txt, host resolution, sitemaps and pages,
+// used as transport of http.Client, so redirects, cookies and timeouts are processed by client
+type Fetcher interface {
+	RoundTrip(request *http.Request) (*http.Response, error)
+}
+
+// newFetcher - create fetcher for Config.FetchMode, transport - network transport
+func newFetcher(cfg *Config, transport http.RoundTripper) (Fetcher, error) {
+	switch cfg.FetchMode {
+	case FetchRecord:
+		err := os.MkdirAll(cfg.FetchDir, 0755)
+		if err != nil {
+			return nil, werrors.NewFields(ErrRecordExchange,
+				zap.String("details", err.Error()),
+				zap.String("dir", cfg.FetchDir))
+		}
+		return &recordFetcher{next: transport, store: newExchangeStore(cfg.FetchDir), maxBodySize: cfg.MaxBodySize}, nil
+	case FetchReplay:
+		return &replayFetcher{store: newExchangeStore(cfg.FetchDir)}, nil
+	default:
+		return transport, nil
+	}
+}
+
+// exchangeStore - saved exchanges, one file per response: first line is "METHOD URL",
+// then response in wire format, repeated requests of URL are numbered in order
+type exchangeStore struct {
+	dir string
+	mu  sync.Mutex
+	// counters - map["METHOD URL"]count of served exchanges
+	counters map[string]int
+}
+
+func newExchangeStore(dir string) *exchangeStore {
+	return &exchangeStore{dir: dir, counters: make(map[string]int)}
+}
+
+func exchangeKey(request *http.Request) string {
+	return request.Method + " " + request.URL.String()
+}
+
+func (s *exchangeStore) path(key string, number int) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%x-%d.http", sha1.Sum([]byte(key)), number))
+}
+
+// Save - save response for request, response body is read and replaced by copy
+func (s *exchangeStore) Save(request *http.Request, response *http.Response) error {
+	dump, err := httputil.DumpResponse(response, true)
+	if err != nil {
+		return err
+	}
+	key := exchangeKey(request)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	number := s.counters[key]
+	s.counters[key]++
+
+	return ioutil.WriteFile(s.path(key, number), append([]byte(key+"\n"), dump...), 0644)
+}
+
+// Load - load next saved response for request, last response is repeated if all were served
+func (s *exchangeStore) Load(request *http.Request) (*http.Response, error) {
+	key := exchangeKey(request)
+
+	s.mu.Lock()
+	number := s.counters[key]
+	data, err := ioutil.ReadFile(s.path(key, number))
+	if err == nil {
+		s.counters[key]++
+	} else if os.IsNotExist(err) && number > 0 {
+		data, err = ioutil.ReadFile(s.path(key, number-1))
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(bytes.NewReader(data))
+	_, err = reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	return http.ReadResponse(reader, request)
+}
+
+// recordFetcher - send requests to network and save responses, network errors are not saved
+type recordFetcher struct {
+	next  http.RoundTripper
+	store *exchangeStore
+	// maxBodySize - max count of saved bytes of body (0 - unlimited),
+	// longer body is cut off after one extra byte, so overflow is detected like in live mode
+	maxBodySize int64
+}
+
+// limitBody - read body with limit and replace it by copy, cut off body has unknown length
+func limitBody(response *http.Response, limit int64) error {
+	if limit <= 0 {
+		return nil
+	}
+
+	body, err := ioutil.ReadAll(limitReader(response.Body, limit))
+	errClose := response.Body.Close()
+	if err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return err
+	}
+	if int64(len(body)) > limit {
+		response.ContentLength = -1
+		response.Header.Del("Content-Length")
+	}
+	response.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	return nil
+}
+
+// RoundTrip - implementation of http.RoundTripper
+func (f *recordFetcher) RoundTrip(request *http.Request) (*http.Response, error) {
+	response, err := f.next.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+	err = limitBody(response, f.maxBodySize)
+	if err == nil {
+		err = f.store.Save(request, response)
+	}
+	if err != nil {
+		_ = response.Body.Close()
+		return nil, werrors.NewFields(ErrRecordExchange,
+			zap.String("details", err.Error()),
+			zap.String("url", request.URL.String()))
+	}
+
+	return response, nil
+}
+
+// replayFetcher - serve saved responses, request without saved response gets error (like connect error)
+type replayFetcher struct {
+	store *exchangeStore
+}
+
+// RoundTrip - implementation of http.RoundTripper
+func (f *replayFetcher) RoundTrip(request *http.Request) (*http.Response, error) {
+	if request.Body != nil {
+		_ = request.Body.Close()
+	}
+	response, err := f.store.Load(request)
+	if err != nil {
+		return nil, werrors.NewFields(ErrReplayExchange,
+			zap.String("details", err.Error()),
+			zap.String("url", request.URL.String()))
+	}
+
+	return response, nil
+}
@@ -0,0 +1,168 @@
+package crawler
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ReanGD/go-web-search/content"
+	"github.com/ReanGD/go-web-search/database"
+	"github.com/uber-go/zap"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func helperFetcherConfig(mode FetchMode, dir string) *Config {
+	cfg := NewConfig(nil, 0)
+	cfg.FetchMode = mode
+	cfg.FetchDir = dir
+
+	return cfg
+}
+
+func helperFetchBody(client *http.Client, urlStr string) (int, string) {
+	response, err := client.Get(urlStr)
+	So(err, ShouldBeNil)
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	So(err, ShouldBeNil)
+
+	return response.StatusCode, string(body)
+}
+
+// TestRecordReplay ...
+func TestRecordReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exchanges")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	counter := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("User-agent: *\nDisallow: /private"))
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("main"))
+	})
+	mux.HandleFunc("/counter", func(w http.ResponseWriter, r *http.Request) {
+		counter++
+		_, _ = fmt.Fprintf(w, "count %d", counter)
+	})
+	mux.Handle("/redirect", http.RedirectHandler("/page", http.StatusFound))
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<html><head><title>page</title></head><body>text <a href=\"/link\">link</a></body></html>"))
+	})
+	ts := httptest.NewServer(mux)
+	tsURL := ts.URL
+	parsedURL, err := url.Parse(tsURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("Record exchanges", t, func() {
+		fetcher, err := newFetcher(helperFetcherConfig(FetchRecord, dir), http.DefaultTransport)
+		So(err, ShouldBeNil)
+		client := &http.Client{Transport: fetcher}
+
+		_, body := helperFetchBody(client, tsURL+"/counter")
+		So(body, ShouldEqual, "count 1")
+		_, body = helperFetchBody(client, tsURL+"/counter")
+		So(body, ShouldEqual, "count 2")
+		_, body = helperFetchBody(client, tsURL+"/redirect")
+		So(body, ShouldContainSubstring, "<title>page</title>")
+
+		h := &hostsManager{client: client}
+		So(h.Init(&fakeDbHost{}, []string{parsedURL.Host}), ShouldBeNil)
+	})
+	ts.Close()
+
+	Convey("Replay exchanges without network", t, func() {
+		fetcher, err := newFetcher(helperFetcherConfig(FetchReplay, dir), nil)
+		So(err, ShouldBeNil)
+		client := &http.Client{Transport: fetcher}
+
+		_, body := helperFetchBody(client, tsURL+"/counter")
+		So(body, ShouldEqual, "count 1")
+		_, body = helperFetchBody(client, tsURL+"/counter")
+		So(body, ShouldEqual, "count 2")
+		_, body = helperFetchBody(client, tsURL+"/counter")
+		So(body, ShouldEqual, "count 2")
+
+		_, err = client.Get(tsURL + "/unknown")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, ErrReplayExchange)
+	})
+
+	Convey("Replay crawl with fake clock", t, func() {
+		now := time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC)
+		cfg := helperFetcherConfig(FetchReplay, dir)
+		cfg.Clock = func() time.Time { return now }
+		fetcher, err := newFetcher(cfg, nil)
+		So(err, ShouldBeNil)
+
+		h := &hostsManager{client: &http.Client{Transport: fetcher}, now: cfg.now()}
+		So(h.Init(&fakeDbHost{}, []string{parsedURL.Host}), ShouldBeNil)
+		So(h.GetHosts(), ShouldResemble, map[string]int64{NormalizeHostName(parsedURL.Host): 1})
+		So(h.robotsFetchedAt[1], ShouldResemble, now)
+
+		r := &request{
+			hostMng:    h,
+			politeness: newPoliteness(h, 1, cfg),
+			retry:      newRetryPolicy(cfg),
+			recrawl:    newRecrawlScheduler(cfg),
+			limits:     newBodyLimits(cfg)}
+		r.Init(zap.NewJSON(zap.DebugLevel, zap.Output(zap.AddSync(&bytes.Buffer{}))), fetcher, nil)
+
+		u, err := url.Parse(tsURL + "/redirect")
+		So(err, ShouldBeNil)
+		data, _ := r.Process(u, &content.Task{})
+		So(data.GetMeta().GetState(), ShouldEqual, database.StateSuccess)
+		So(data.GetMeta().GetURL(), ShouldEqual, tsURL+"/page")
+
+		u, err = url.Parse(tsURL + "/private")
+		So(err, ShouldBeNil)
+		data, _ = r.Process(u, &content.Task{})
+		So(data.GetMeta().GetState(), ShouldEqual, database.StateDisabledByRobotsTxt)
+	})
+}
+
+// TestRecordBodyLimit ...
+func TestRecordBodyLimit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exchanges")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(bytes.Repeat([]byte("a"), 100))
+	}))
+	tsURL := ts.URL
+
+	Convey("Oversized body is saved with one extra byte", t, func() {
+		cfg := helperFetcherConfig(FetchRecord, dir)
+		cfg.MaxBodySize = 10
+		fetcher, err := newFetcher(cfg, http.DefaultTransport)
+		So(err, ShouldBeNil)
+		_, body := helperFetchBody(&http.Client{Transport: fetcher}, tsURL+"/big")
+		So(body, ShouldEqual, strings.Repeat("a", 11))
+	})
+	ts.Close()
+
+	Convey("Cut off body is replayed", t, func() {
+		fetcher, err := newFetcher(helperFetcherConfig(FetchReplay, dir), nil)
+		So(err, ShouldBeNil)
+		_, body := helperFetchBody(&http.Client{Transport: fetcher}, tsURL+"/big")
+		So(body, ShouldEqual, strings.Repeat("a", 11))
+	})
+}
@@ -0,0 +1,228 @@
+package crawler
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ReanGD/go-web-search/content"
+	"github.com/ReanGD/go-web-search/proxy"
+)
+
+// dbFrontier - database interface for frontier
+type dbFrontier interface {
+	// GetNewURLs - get not loaded URLs for host, canonical URLs are first, then in order of priority
+	GetNewURLs(hostID int64, cnt int, now time.Time) ([]content.Task, error)
+	// GetRecrawlURLs - get loaded URLs for host with expired recrawl time
+	GetRecrawlURLs(hostID int64, cnt int, now time.Time) ([]content.Task, error)
+}
+
+type hostQueue struct {
+	tasks []content.Task
+}
+
+// frontier - queues of URLs for host workers, refilled from db while crawling
+type frontier struct {
+	mu         sync.Mutex
+	db         dbFrontier
+	budget     int
+	issued     int
+	batchSize  int
+	refillWait time.Duration
+	queues     map[int64]*hostQueue
+	// map[URL.ID]hostID - URLs handed to workers and not yet saved to db
+	inFlight map[int64]int64
+	// skipped - URLs, that can't be processed by worker, they are not queued again
+	// map[URL.ID]hostID
+	skipped map[int64]int64
+	stop    <-chan struct{}
+	now     func() time.Time
+}
+
+type popResult uint8
+
+const (
+	popFound    popResult = 0
+	popEmpty    popResult = 1
+	popFinished popResult = 2
+)
+
+func newFrontier(db dbFrontier, cfg *Config, stop <-chan struct{}) *frontier {
+	return &frontier{
+		db:         db,
+		budget:     cfg.PageBudget,
+		issued:     0,
+		batchSize:  cfg.FrontierBatch,
+		refillWait: cfg.FrontierRefillWait,
+		queues:     make(map[int64]*hostQueue),
+		inFlight:   make(map[int64]int64),
+		skipped:    make(map[int64]int64),
+		stop:       stop,
+		now:        cfg.now()}
+}
+
+func (f *frontier) isStopped() bool {
+	select {
+	case <-f.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (f *frontier) isFinished() bool {
+	return f.isStopped() || (f.budget > 0 && f.issued >= f.budget)
+}
+
+func countHost(ids map[int64]int64, hostID int64) int {
+	cnt := 0
+	for _, id := range ids {
+		if id == hostID {
+			cnt++
+		}
+	}
+
+	return cnt
+}
+
+// load - load URLs for recrawl first, then new URLs, f.mu must not be locked
+func (f *frontier) load(hostID int64, cnt int) ([]content.Task, error) {
+	now := f.now()
+	tasks, err := f.db.GetRecrawlURLs(hostID, cnt, now)
+	if err != nil {
+		return nil, err
+	}
+	newTasks, err := f.db.GetNewURLs(hostID, cnt, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(tasks, newTasks...), nil
+}
+
+// merge - add loaded URLs to queue, that are not in flight, not skipped and not in queue yet, f.mu must be locked
+func (f *frontier) merge(queue *hostQueue, tasks []content.Task) {
+	queued := make(map[int64]struct{}, len(queue.tasks))
+	for _, task := range queue.tasks {
+		queued[task.ID] = struct{}{}
+	}
+	for _, task := range tasks {
+		_, inFlight := f.inFlight[task.ID]
+		_, exists := queued[task.ID]
+		_, skipped := f.skipped[task.ID]
+		if !inFlight && !exists && !skipped && len(queue.tasks) < f.batchSize {
+			queue.tasks = append(queue.tasks, task)
+			queued[task.ID] = struct{}{}
+		}
+	}
+}
+
+func (f *frontier) getQueue(hostID int64) *hostQueue {
+	queue, exists := f.queues[hostID]
+	if !exists {
+		queue = &hostQueue{}
+		f.queues[hostID] = queue
+	}
+
+	return queue
+}
+
+// pop - get URL from queue of host, queue is refilled from db without lock of frontier
+func (f *frontier) pop(hostID int64) (content.Task, popResult) {
+	f.mu.Lock()
+	if f.isFinished() {
+		f.mu.Unlock()
+		return content.Task{}, popFinished
+	}
+	if len(f.getQueue(hostID).tasks) == 0 {
+		// loaded URLs in flight and skipped URLs are not added to queue
+		cnt := f.batchSize + countHost(f.inFlight, hostID) + countHost(f.skipped, hostID)
+		f.mu.Unlock()
+		tasks, err := f.load(hostID, cnt)
+		if err != nil {
+			log.Printf("ERROR: Frontier refill for host %d, message: %s", hostID, err)
+		}
+		f.mu.Lock()
+		f.merge(f.getQueue(hostID), tasks)
+	}
+	defer f.mu.Unlock()
+
+	queue := f.getQueue(hostID)
+	if f.isFinished() {
+		return content.Task{}, popFinished
+	}
+	if len(queue.tasks) == 0 {
+		return content.Task{}, popEmpty
+	}
+
+	task := queue.tasks[0]
+	queue.tasks = queue.tasks[1:]
+	f.issued++
+	f.inFlight[task.ID] = hostID
+
+	return task, popFound
+}
+
+// Finished - the budget is exhausted or crawling is stopped
+func (f *frontier) Finished() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.isFinished()
+}
+
+// Next - get next URL for host, blocks while queue is empty
+// returns false if the budget is exhausted or crawling is stopped
+func (f *frontier) Next(hostID int64) (content.Task, bool) {
+	for {
+		task, result := f.pop(hostID)
+		switch result {
+		case popFound:
+			return task, true
+		case popFinished:
+			return task, false
+		}
+
+		if !f.Wait(f.refillWait) {
+			return content.Task{}, false
+		}
+	}
+}
+
+// Wait - sleep duration, returns false if crawling is stopped
+func (f *frontier) Wait(duration time.Duration) bool {
+	if duration <= 0 {
+		return !f.isStopped()
+	}
+
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-f.stop:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// Skip - release URL, that can't be processed by worker, it is not counted in the budget and not queued again
+func (f *frontier) Skip(id int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if hostID, exists := f.inFlight[id]; exists {
+		delete(f.inFlight, id)
+		f.issued--
+		f.skipped[id] = hostID
+	}
+}
+
+// Saved - release URLs saved to db by DBWorker
+func (f *frontier) Saved(batch []*proxy.PageData) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, data := range batch {
+		delete(f.inFlight, data.GetParentURL())
+	}
+}
@@ -0,0 +1,172 @@
+package crawler
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ReanGD/go-web-search/content"
+	"github.com/ReanGD/go-web-search/proxy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type fakeDbFrontier struct {
+	urls    []content.Task
+	recrawl []content.Task
+	err     string
+	called  int
+	now     time.Time
+}
+
+func (f *fakeDbFrontier) GetNewURLs(hostID int64, cnt int, now time.Time) ([]content.Task, error) {
+	f.called++
+	f.now = now
+	if f.err != "" {
+		return nil, errors.New(f.err)
+	}
+	if len(f.urls) < cnt {
+		cnt = len(f.urls)
+	}
+
+	return f.urls[:cnt], nil
+}
+
+func (f *fakeDbFrontier) GetRecrawlURLs(hostID int64, cnt int, now time.Time) ([]content.Task, error) {
+	f.called++
+	f.now = now
+	if f.err != "" {
+		return nil, errors.New(f.err)
+	}
+	if len(f.recrawl) < cnt {
+		cnt = len(f.recrawl)
+	}
+
+	return f.recrawl[:cnt], nil
+}
+
+func helperNewFrontier(db dbFrontier, budget int) (*frontier, chan struct{}) {
+	cfg := NewConfig([]string{}, budget)
+	cfg.FrontierBatch = 2
+	cfg.FrontierRefillWait = time.Millisecond
+	stop := make(chan struct{})
+
+	return newFrontier(db, cfg, stop), stop
+}
+
+// TestFrontierNext ...
+func TestFrontierNext(t *testing.T) {
+	Convey("URLs are selected by clock of crawler", t, func() {
+		db := &fakeDbFrontier{urls: []content.Task{{ID: 1}}}
+		cfg := NewConfig([]string{}, 0)
+		clock := time.Date(2016, 10, 1, 0, 0, 0, 0, time.UTC)
+		cfg.Clock = func() time.Time { return clock }
+		f := newFrontier(db, cfg, make(chan struct{}))
+
+		_, ok := f.Next(1)
+		So(ok, ShouldBeTrue)
+		So(db.now, ShouldResemble, clock)
+	})
+
+	Convey("Tasks are not repeated while in flight", t, func() {
+		db := &fakeDbFrontier{urls: []content.Task{{ID: 1}, {ID: 2}, {ID: 3}}}
+		f, _ := helperNewFrontier(db, 0)
+
+		task, ok := f.Next(1)
+		So(ok, ShouldBeTrue)
+		So(task.ID, ShouldEqual, 1)
+		task, ok = f.Next(1)
+		So(ok, ShouldBeTrue)
+		So(task.ID, ShouldEqual, 2)
+		task, ok = f.Next(1)
+		So(ok, ShouldBeTrue)
+		So(task.ID, ShouldEqual, 3)
+		So(f.inFlight, ShouldResemble, map[int64]int64{1: 1, 2: 1, 3: 1})
+	})
+
+	Convey("Saved tasks are released", t, func() {
+		db := &fakeDbFrontier{urls: []content.Task{{ID: 1}}}
+		f, _ := helperNewFrontier(db, 0)
+
+		task, ok := f.Next(1)
+		So(ok, ShouldBeTrue)
+		data := proxy.NewPageData(nil, nil)
+		data.SetParentURL(task.ID)
+		f.Saved([]*proxy.PageData{data})
+		So(f.inFlight, ShouldBeEmpty)
+
+		task, ok = f.Next(1)
+		So(ok, ShouldBeTrue)
+		So(task.ID, ShouldEqual, 1)
+	})
+
+	Convey("Skipped tasks are not counted in the budget and not repeated", t, func() {
+		db := &fakeDbFrontier{urls: []content.Task{{ID: 1}, {ID: 2}}}
+		f, _ := helperNewFrontier(db, 1)
+
+		task, ok := f.Next(1)
+		So(ok, ShouldBeTrue)
+		So(task.ID, ShouldEqual, 1)
+		f.Skip(task.ID)
+		So(f.inFlight, ShouldBeEmpty)
+		So(f.issued, ShouldEqual, 0)
+
+		f.queues[1].tasks = nil
+		task, ok = f.Next(1)
+		So(ok, ShouldBeTrue)
+		So(task.ID, ShouldEqual, 2)
+	})
+
+	Convey("Recrawl tasks are first", t, func() {
+		recrawlTask := content.Task{ID: 3, Loaded: true, ETag: "tag"}
+		db := &fakeDbFrontier{urls: []content.Task{{ID: 1}}, recrawl: []content.Task{recrawlTask}}
+		f, _ := helperNewFrontier(db, 0)
+
+		task, ok := f.Next(1)
+		So(ok, ShouldBeTrue)
+		So(task, ShouldResemble, recrawlTask)
+		So(task.IsRecrawl(), ShouldBeTrue)
+		task, ok = f.Next(1)
+		So(ok, ShouldBeTrue)
+		So(task.ID, ShouldEqual, 1)
+		So(task.IsRecrawl(), ShouldBeFalse)
+	})
+
+	Convey("Budget is exhausted", t, func() {
+		db := &fakeDbFrontier{urls: []content.Task{{ID: 1}, {ID: 2}}}
+		f, _ := helperNewFrontier(db, 1)
+
+		_, ok := f.Next(1)
+		So(ok, ShouldBeTrue)
+		_, ok = f.Next(2)
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("Wait new URLs until stop", t, func() {
+		db := &fakeDbFrontier{err: "db error"}
+		f, stop := helperNewFrontier(db, 0)
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			close(stop)
+		}()
+		_, ok := f.Next(1)
+		So(ok, ShouldBeFalse)
+		So(db.called, ShouldBeGreaterThan, 1)
+	})
+}
+
+// TestFrontierWait ...
+func TestFrontierWait(t *testing.T) {
+	Convey("Wait without stop", t, func() {
+		f, _ := helperNewFrontier(&fakeDbFrontier{}, 0)
+		So(f.Wait(time.Millisecond), ShouldBeTrue)
+		So(f.Wait(-time.Millisecond), ShouldBeTrue)
+	})
+
+	Convey("Wait after stop", t, func() {
+		f, stop := helperNewFrontier(&fakeDbFrontier{}, 0)
+		close(stop)
+		So(f.Wait(time.Hour), ShouldBeFalse)
+		So(f.Wait(0), ShouldBeFalse)
+	})
+}
@@ -0,0 +1,59 @@
+package crawler
+
+import (
+	"net"
+	"net/url"
+	"strconv"
+)
+
+// hostOrigin - preferred scheme and port of host
+type hostOrigin struct {
+	scheme string
+	// port - 0 for default port of scheme
+	port int
+}
+
+// hostSchemes - schemes in order of resolve attempts
+var hostSchemes = []string{"https", "http"}
+
+func defaultPort(scheme string) int {
+	if scheme == "https" {
+		return 443
+	}
+
+	return 80
+}
+
+func newHostOrigin(scheme string, port int) hostOrigin {
+	if scheme == "" {
+		scheme = "http"
+	}
+	if port == defaultPort(scheme) {
+		port = 0
+	}
+
+	return hostOrigin{scheme: scheme, port: port}
+}
+
+// originFromURL - get origin of URL
+func originFromURL(u *url.URL) hostOrigin {
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		port = 0
+	}
+
+	return newHostOrigin(u.Scheme, port)
+}
+
+// URL - build normalized URL for host with origin scheme and port
+func (o hostOrigin) URL(hostName string, path string) string {
+	host := hostName
+	if o.port != 0 {
+		if name, _, err := net.SplitHostPort(hostName); err == nil {
+			host = name
+		}
+		host = net.JoinHostPort(host, strconv.Itoa(o.port))
+	}
+
+	return NormalizeURL(&url.URL{Scheme: newHostOrigin(o.scheme, o.port).scheme, Host: host, Path: path})
+}
@@ -0,0 +1,207 @@
+package crawler
+
+import (
+	"bytes"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ReanGD/go-web-search/database"
+	"github.com/ReanGD/go-web-search/werrors"
+	"github.com/uber-go/zap"
+)
+
+const (
+	// rulePrefixGlob - prefix of glob pattern ("*" - any sequence of chars, "?" - any char)
+	rulePrefixGlob = "glob:"
+	// rulePrefixRegexp - prefix of regular expression pattern
+	rulePrefixRegexp = "re:"
+)
+
+// HostRules - URL filter of host
+// patterns are matched with path and query of URL ("/search?q=text"),
+// pattern without prefix is path prefix, "glob:" - glob pattern, "re:" - regular expression
+type HostRules struct {
+	// Include - only URLs matched one of patterns are crawled (empty - all URLs)
+	Include []string
+	// Exclude - URLs matched one of patterns are not crawled, has priority over Include
+	Exclude []string
+	// MaxDepth - max click depth of URL from seed (0 - unlimited)
+	MaxDepth int
+	// MaxPages - max count of URLs of host (0 - unlimited)
+	MaxPages int
+}
+
+type urlPattern struct {
+	source string
+	prefix string
+	re     *regexp.Regexp
+}
+
+func globToRegexp(glob string) string {
+	var buf bytes.Buffer
+	buf.WriteString("^")
+	for _, ch := range glob {
+		switch ch {
+		case '*':
+			buf.WriteString(".*")
+		case '?':
+			buf.WriteString(".")
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	buf.WriteString("$")
+
+	return buf.String()
+}
+
+func newURLPattern(source string) (*urlPattern, error) {
+	result := &urlPattern{source: source}
+	expr := ""
+	switch {
+	case strings.HasPrefix(source, rulePrefixGlob):
+		expr = globToRegexp(source[len(rulePrefixGlob):])
+	case strings.HasPrefix(source, rulePrefixRegexp):
+		expr = source[len(rulePrefixRegexp):]
+	default:
+		result.prefix = source
+		return result, nil
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, werrors.NewFields(ErrParseURLPattern,
+			zap.String("details", err.Error()),
+			zap.String("pattern", source))
+	}
+	result.re = re
+
+	return result, nil
+}
+
+// Match - check that path with query of URL matches pattern
+func (p *urlPattern) Match(target string) bool {
+	if p.re != nil {
+		return p.re.MatchString(target)
+	}
+
+	return strings.HasPrefix(target, p.prefix)
+}
+
+func newURLPatterns(sources []string) ([]*urlPattern, error) {
+	result := make([]*urlPattern, 0, len(sources))
+	for _, source := range sources {
+		pattern, err := newURLPattern(source)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, pattern)
+	}
+
+	return result, nil
+}
+
+// hostRules - compiled HostRules
+type hostRules struct {
+	include  []*urlPattern
+	exclude  []*urlPattern
+	maxDepth int
+	maxPages int
+	// known - URLs of host counted for maxPages, links to host can be found by workers of other hosts
+	mu    sync.Mutex
+	known map[string]struct{}
+}
+
+func newHostRules(cfg *HostRules) (*hostRules, error) {
+	include, err := newURLPatterns(cfg.Include)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := newURLPatterns(cfg.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	return &hostRules{
+		include:  include,
+		exclude:  exclude,
+		maxDepth: cfg.MaxDepth,
+		maxPages: cfg.MaxPages,
+		known:    make(map[string]struct{})}, nil
+}
+
+// newRulesByHost - compile rules from config, result is map[normalized hostName]rules
+func newRulesByHost(cfg map[string]*HostRules) (map[string]*hostRules, error) {
+	result := make(map[string]*hostRules, len(cfg))
+	for hostName, rules := range cfg {
+		compiled, err := newHostRules(rules)
+		if err != nil {
+			return nil, werrors.AddFields(err, zap.String("host", hostName))
+		}
+		result[NormalizeHostName(hostName)] = compiled
+	}
+
+	return result, nil
+}
+
+// AddKnown - add URLs of host from db for maxPages limit
+func (r *hostRules) AddKnown(urls []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, urlStr := range urls {
+		r.known[urlStr] = struct{}{}
+	}
+}
+
+// CheckPages - check limit of URLs count, accepted URL is counted
+// returns false, reason and details if URL is rejected
+func (r *hostRules) CheckPages(urlStr string) (database.RejectReason, string, bool) {
+	if r.maxPages <= 0 {
+		return 0, "", true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.known[urlStr]; ok {
+		return 0, "", true
+	}
+	if len(r.known) >= r.maxPages {
+		return database.RejectMaxPages, strconv.Itoa(r.maxPages), false
+	}
+	r.known[urlStr] = struct{}{}
+
+	return 0, "", true
+}
+
+// CheckFilter - check URL with click depth by patterns and depth limit
+// returns false, reason and details if URL is rejected
+func (r *hostRules) CheckFilter(u *url.URL, depth int) (database.RejectReason, string, bool) {
+	target := u.RequestURI()
+	for _, pattern := range r.exclude {
+		if pattern.Match(target) {
+			return database.RejectExcluded, pattern.source, false
+		}
+	}
+	if len(r.include) != 0 {
+		included := false
+		for _, pattern := range r.include {
+			if pattern.Match(target) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return database.RejectNotIncluded, "", false
+		}
+	}
+	if r.maxDepth > 0 && depth > r.maxDepth {
+		return database.RejectMaxDepth, strconv.Itoa(r.maxDepth), false
+	}
+
+	return 0, "", true
+}
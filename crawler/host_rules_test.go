@@ -0,0 +1,151 @@
+package crawler
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/ReanGD/go-web-search/database"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func helperCheckRules(rules *hostRules, urlStr string, depth int) (database.RejectReason, string, bool) {
+	u, err := url.Parse(urlStr)
+	So(err, ShouldBeNil)
+
+	m := &hostsManager{rules: map[string]*hostRules{urlHostName(u): rules}}
+
+	return m.CheckRules(u, urlStr, depth)
+}
+
+// TestURLPattern ...
+func TestURLPattern(t *testing.T) {
+	Convey("Prefix pattern", t, func() {
+		p, err := newURLPattern("/news/")
+		So(err, ShouldBeNil)
+		So(p.Match("/news/1"), ShouldBeTrue)
+		So(p.Match("/about/news/"), ShouldBeFalse)
+	})
+
+	Convey("Glob pattern", t, func() {
+		p, err := newURLPattern("glob:/*/item?.html")
+		So(err, ShouldBeNil)
+		So(p.Match("/catalog/item1.html"), ShouldBeTrue)
+		So(p.Match("/catalog/item12.html"), ShouldBeFalse)
+		So(p.Match("/catalog/item1xhtml"), ShouldBeFalse)
+	})
+
+	Convey("Regexp pattern", t, func() {
+		p, err := newURLPattern(`re:[?&]sort=`)
+		So(err, ShouldBeNil)
+		So(p.Match("/list?page=1&sort=asc"), ShouldBeTrue)
+		So(p.Match("/list?page=1"), ShouldBeFalse)
+	})
+
+	Convey("Wrong regexp pattern", t, func() {
+		_, err := newURLPattern("re:(")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, ErrParseURLPattern)
+	})
+
+	Convey("Wrong pattern in config", t, func() {
+		_, err := newRulesByHost(map[string]*HostRules{"host": &HostRules{Exclude: []string{"re:["}}})
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, ErrParseURLPattern)
+	})
+}
+
+// TestHostRules ...
+func TestHostRules(t *testing.T) {
+	Convey("Exclude has priority over include", t, func() {
+		rules, err := newHostRules(&HostRules{
+			Include: []string{"/docs/"},
+			Exclude: []string{"glob:/docs/*.pdf"}})
+		So(err, ShouldBeNil)
+
+		_, _, ok := helperCheckRules(rules, "http://host/docs/index.html", 1)
+		So(ok, ShouldBeTrue)
+
+		reason, details, ok := helperCheckRules(rules, "http://host/docs/book.pdf", 1)
+		So(ok, ShouldBeFalse)
+		So(reason, ShouldEqual, database.RejectExcluded)
+		So(details, ShouldEqual, "glob:/docs/*.pdf")
+
+		reason, _, ok = helperCheckRules(rules, "http://host/blog/", 1)
+		So(ok, ShouldBeFalse)
+		So(reason, ShouldEqual, database.RejectNotIncluded)
+	})
+
+	Convey("Max depth", t, func() {
+		rules, err := newHostRules(&HostRules{MaxDepth: 2})
+		So(err, ShouldBeNil)
+
+		_, _, ok := helperCheckRules(rules, "http://host/a", 2)
+		So(ok, ShouldBeTrue)
+
+		reason, details, ok := helperCheckRules(rules, "http://host/b", 3)
+		So(ok, ShouldBeFalse)
+		So(reason, ShouldEqual, database.RejectMaxDepth)
+		So(details, ShouldEqual, "2")
+	})
+
+	Convey("Max pages", t, func() {
+		rules, err := newHostRules(&HostRules{MaxPages: 2})
+		So(err, ShouldBeNil)
+		rules.AddKnown([]string{"http://host/"})
+
+		_, _, ok := helperCheckRules(rules, "http://host/a", 1)
+		So(ok, ShouldBeTrue)
+
+		reason, _, ok := helperCheckRules(rules, "http://host/b", 1)
+		So(ok, ShouldBeFalse)
+		So(reason, ShouldEqual, database.RejectMaxPages)
+
+		// known URL is not counted again
+		_, _, ok = helperCheckRules(rules, "http://host/a", 1)
+		So(ok, ShouldBeTrue)
+	})
+
+	Convey("Preload known URLs from db", t, func() {
+		rules, err := newRulesByHost(map[string]*HostRules{"Host1": &HostRules{MaxPages: 2}})
+		So(err, ShouldBeNil)
+		hostMng := &hostsManager{hosts: map[string]int64{"host1": 1}, rules: rules}
+		db := &fakeDbHost{hostURLs: []string{"http://host1/", "http://host1/a", "http://host1/b"}}
+		So(hostMng.loadKnownURLs(db), ShouldBeNil)
+
+		u, _ := url.Parse("http://host1/c")
+		reason, _, ok := hostMng.CheckRules(u, u.String(), 1)
+		So(ok, ShouldBeFalse)
+		So(reason, ShouldEqual, database.RejectMaxPages)
+	})
+}
+
+// TestAddURLRules ...
+func TestAddURLRules(t *testing.T) {
+	Convey("Rejected links are saved with reason", t, func() {
+		rules, err := newRulesByHost(map[string]*HostRules{"testhost1": &HostRules{
+			Exclude:  []string{"/private/"},
+			MaxDepth: 3}})
+		So(err, ShouldBeNil)
+		hostMng := &hostsManager{hosts: map[string]int64{"testhost1": 1}, rules: rules}
+		h, err := NewHTMLMetadata(hostMng, "http://testhost1/test/")
+		So(err, ShouldBeNil)
+		h.SetDepth(2)
+
+		h.AddURL("/public/")
+		h.AddURL("/private/1")
+		h.AddURL("http://external/private/1")
+		So(len(h.URLs), ShouldEqual, 2)
+		So(len(h.Rejected), ShouldEqual, 1)
+		reason, details := h.Rejected["http://testhost1/private/1"].GetReason()
+		So(reason, ShouldEqual, database.RejectExcluded)
+		So(details, ShouldEqual, "/private/")
+
+		h.SetDepth(3)
+		h.AddURL("/public/2")
+		reason, _ = h.Rejected["http://testhost1/public/2"].GetReason()
+		So(reason, ShouldEqual, database.RejectMaxDepth)
+
+		h.ClearURLs()
+		So(len(h.Rejected), ShouldEqual, 0)
+	})
+}
@@ -3,6 +3,7 @@ package crawler
 import (
 	"fmt"
 	"log"
+	"net/http"
 	"net/url"
 	"sync"
 	"time"
@@ -13,66 +14,192 @@ import (
 )
 
 type hostWorker struct {
-	Request *request
-	Tasks   []content.URL
-	ChDB    chan<- *proxy.PageData
+	HostID   int64
+	Request  *request
+	Frontier *frontier
+	ChDB     chan<- *proxy.PageData
 }
 
 // Run - start worker
 func (w *hostWorker) Start(wgParent *sync.WaitGroup) {
 	defer wgParent.Done()
 
-	cnt := len(w.Tasks)
-	for i := 0; i != cnt; i++ {
-		parsed, err := url.Parse(w.Tasks[i].URL)
+	for {
+		task, ok := w.Frontier.Next(w.HostID)
+		if !ok {
+			return
+		}
+		parsed, err := url.Parse(task.URL)
 		if err != nil {
-			log.Printf("ERROR: Worker query. Parse URL %s, message: %s", w.Tasks[i].URL, err)
+			log.Printf("ERROR: Worker query. Parse URL %s, message: %s", task.URL, err)
+			w.Frontier.Skip(task.ID)
 			continue
 		}
-		result, workDuration := w.Request.Process(parsed)
-		result.SetParentURL(w.Tasks[i].ID)
+		result, workDuration := w.Request.Process(parsed, &task)
+		result.SetParentURL(task.ID)
 		w.ChDB <- result
 		fmt.Printf(".")
-		if result.GetMeta().NeedWaitAfterRequest() && i != cnt-1 {
-			time.Sleep(time.Duration(1000-workDuration) * time.Millisecond)
+		delay := result.GetMeta().NeedWaitAfterRequest(w.Request.politeness)
+		if delay > 0 {
+			if !w.Frontier.Wait(delay - time.Duration(workDuration)*time.Millisecond) {
+				return
+			}
 		}
 	}
 }
 
 type hostWorkers struct {
-	workers []*hostWorker
+	workers       []*hostWorker
+	frontier      *frontier
+	hostMng       *hostsManager
+	db            proxy.DbHost
+	robotsRefresh time.Duration
+	priority      *priorityUpdater
+	// settings for creation of workers (include workers for hosts discovered while crawling)
+	cfg       *Config
+	logger    zap.Logger
+	transport http.RoundTripper
+	jar       http.CookieJar
+	retry     *retryPolicy
+	recrawl   *recrawlScheduler
+	limits    *bodyLimits
+	warc      *warcWriter
+}
+
+func (w *hostWorkers) newWorker(hostName string, hostID int64) *hostWorker {
+	req := &request{
+		hostMng:         w.hostMng,
+		politeness:      newPoliteness(w.hostMng, hostID, w.cfg),
+		retry:           w.retry,
+		recrawl:         w.recrawl,
+		limits:          w.limits,
+		warc:            w.warc,
+		requestTimeout:  w.cfg.RequestTimeout,
+		bodyIdleTimeout: w.cfg.BodyIdleTimeout,
+		refreshMaxDelay: w.cfg.MetaRefreshMaxDelay}
+	worker := &hostWorker{HostID: hostID, Request: req, Frontier: w.frontier}
+	worker.Request.Init(w.logger.With(zap.String("host", DisplayHostName(hostName))), w.transport, w.jar)
+
+	return worker
 }
 
-func (w *hostWorkers) Init(db *content.DBrw, logger zap.Logger, baseHosts []string, cnt int) error {
-	hostMng := &hostsManager{}
-	err := hostMng.Init(db, baseHosts)
+// Init - init hosts and workers
+// chOps - operations for DBWorker, it must be started before Init
+func (w *hostWorkers) Init(db *content.DBrw, chOps chan<- content.DBOperation, logger zap.Logger, cfg *Config,
+	stop <-chan struct{}) error {
+	transport, err := newTransportFactory(cfg)
+	if err != nil {
+		return err
+	}
+	rules, err := newRulesByHost(cfg.HostRules)
+	if err != nil {
+		return err
+	}
+	auth, err := newAuthManager(cfg.HostAuth)
+	if err != nil {
+		return err
+	}
+	queue := newDbQueue(db, chOps)
+	hostMng := &hostsManager{
+		sitemapMaxFiles: cfg.SitemapMaxFiles,
+		robotsTTL:       cfg.RobotsTxtTTL,
+		identity:        cfg.Identity,
+		auth:            auth,
+		rules:           rules,
+		queries:         newQueryPolicies(cfg.QueryPolicies),
+		traps:           newTrapDetector(queue, cfg),
+		discovery:       newHostDiscovery(cfg),
+		now:             cfg.now()}
+	jar := newCookieJar(hostMng, queue)
+	hostMng.client = transport.NewClient()
+	hostMng.client.Jar = jar
+	err = hostMng.Init(db, cfg.BaseHosts)
+	if err != nil {
+		return err
+	}
+	w.hostMng = hostMng
+	w.db = db
+	w.robotsRefresh = cfg.RobotsTxtCheckInterval
+	w.cfg = cfg
+	w.logger = logger
+	w.transport = transport.Transport()
+	w.jar = jar
+	w.retry = newRetryPolicy(cfg)
+	w.recrawl = newRecrawlScheduler(cfg)
+	w.limits = newBodyLimits(cfg)
+	w.warc, err = newWarcWriter(cfg)
 	if err != nil {
 		return err
 	}
+	w.frontier = newFrontier(db, cfg, stop)
+	w.priority = newPriorityUpdater(db, cfg)
 
 	hosts := hostMng.GetHosts()
-	w.workers = make([]*hostWorker, 0)
-	cntPerHost := cnt / len(hosts)
-	if cntPerHost < 1 {
-		cntPerHost = 1
-	}
+	w.workers = make([]*hostWorker, 0, len(hosts))
 	for hostName, hostID := range hosts {
-		worker := &hostWorker{Request: &request{hostMng: hostMng}}
-		worker.Request.Init(logger.With(zap.String("host", hostName)))
-		worker.Tasks, err = db.GetNewURLs(hostID, cntPerHost)
-		if err != nil {
-			return err
-		}
-		w.workers = append(w.workers, worker)
+		w.workers = append(w.workers, w.newWorker(hostName, hostID))
 	}
 
 	return nil
 }
 
+// Saved - callback for DBWorker
+func (w *hostWorkers) Saved(batch []*proxy.PageData) {
+	w.frontier.Saved(batch)
+}
+
+// discover - init hosts discovered while crawling and start workers for them,
+// goroutine holds own slot in wg, so workers are never added to finished wg
+func (w *hostWorkers) discover(chDB chan<- *proxy.PageData, wg *sync.WaitGroup) {
+	defer wg.Done()
+	if w.hostMng.discovery == nil {
+		return
+	}
+
+	for !w.frontier.Finished() {
+		timer := time.NewTimer(w.frontier.refillWait)
+		select {
+		case <-w.frontier.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		case hostName := <-w.hostMng.discovery.Queue():
+			timer.Stop()
+			hostID, err := w.hostMng.AddHost(w.db, hostName)
+			if err != nil {
+				log.Printf("ERROR: Init discovered host %s, message: %s", hostName, err)
+				continue
+			}
+			log.Printf("INFO: Discovered host %s added for crawling", hostName)
+			worker := w.newWorker(hostName, hostID)
+			worker.ChDB = chDB
+			wg.Add(1)
+			go worker.Start(wg)
+		}
+	}
+}
+
 func (w *hostWorkers) Start(chDB chan<- *proxy.PageData) {
+	var wgRefresh sync.WaitGroup
+	defer wgRefresh.Wait()
+	done := make(chan struct{})
+	defer close(done)
+	wgRefresh.Add(1)
+	go w.hostMng.StartRobotsTxtRefresh(w.db, w.robotsRefresh, done, &wgRefresh)
+	wgRefresh.Add(1)
+	go w.priority.Start(done, &wgRefresh)
+
+	defer func() {
+		err := w.warc.Close()
+		if err != nil {
+			log.Printf("ERROR: Close WARC file, message: %s", err)
+		}
+	}()
 	var wg sync.WaitGroup
 	defer wg.Wait()
 
+	wg.Add(1)
+	go w.discover(chDB, &wg)
 	for _, worker := range w.workers {
 		worker.ChDB = chDB
 		wg.Add(1)
@@ -3,10 +3,18 @@ package crawler
 // status: ok
 import (
 	"database/sql"
+	"io"
 	"io/ioutil"
+	"log"
+	"net"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/ReanGD/go-web-search/database"
 	"github.com/ReanGD/go-web-search/proxy"
 	"github.com/ReanGD/go-web-search/werrors"
 	"github.com/temoto/robotstxt-go"
@@ -14,19 +22,227 @@ import (
 )
 
 type hostsManager struct {
+	// mu - guard maps, robots.txt rules are swapped by refresh while workers are running
+	mu        sync.RWMutex
 	robotsTxt map[int64]*robotstxt.Group
-	hosts     map[string]int64
+	// robotsFetchedAt - map[hostID]time of robots.txt download
+	robotsFetchedAt map[int64]time.Time
+	// origins - map[hostID]preferred scheme and port
+	origins map[int64]hostOrigin
+	hosts   map[string]int64
+	// sitemapMaxFiles - max count of sitemap files loaded for host (0 - sitemaps are disabled)
+	sitemapMaxFiles int
+	// robotsTTL - lifetime of downloaded robots.txt (0 - unlimited)
+	robotsTTL time.Duration
+	// identity - user agent and headers for requests (nil - default identity)
+	identity *Identity
+	// client - client with shared transport and cookie jar (nil - http.DefaultClient)
+	client *http.Client
+	// auth - authentication settings of hosts (nil - without authentication)
+	auth *authManager
+	// rules - map[hostName]URL filter of host (nil - all URLs are allowed)
+	rules map[string]*hostRules
+	// queries - map[hostName]query parameters policy of host (hosts without policy - default policy)
+	queries map[string]*queryPolicy
+	// traps - detector of crawler traps (nil - detection disabled)
+	traps *trapDetector
+	// discovery - selection of unknown hosts from links (nil - discovery disabled)
+	discovery *hostDiscovery
+	// initMu - serialize initialization of hosts discovered while crawling
+	initMu sync.Mutex
+	// now - clock of crawler (nil - system clock)
+	now func() time.Time
+}
+
+// Now - current time by clock of crawler
+func (m *hostsManager) Now() time.Time {
+	if m.now == nil {
+		return time.Now()
+	}
+
+	return m.now()
+}
+
+// NormalizeURL - normalize URL, query parameters are removed by policy of URL host
+func (m *hostsManager) NormalizeURL(u *url.URL) string {
+	policy, ok := m.queries[urlHostName(u)]
+	if !ok {
+		policy = defaultQueryPolicy
+	}
+
+	return normalizeURL(u, policy)
+}
+
+func (m *hostsManager) getIdentity() *Identity {
+	if m.identity == nil {
+		return NewIdentity()
+	}
+
+	return m.identity
+}
+
+// RequestHeader - get headers for request to host
+func (m *hostsManager) RequestHeader(hostName string) http.Header {
+	return m.getIdentity().Header(hostName)
+}
+
+// findRobotsGroup - find group of robots.txt for crawler
+func (m *hostsManager) findRobotsGroup(robot *robotstxt.RobotsData) *robotstxt.Group {
+	return robot.FindGroup(m.getIdentity().RobotsToken)
+}
+
+// ApplyAuth - set authentication header for host of request
+func (m *hostsManager) ApplyAuth(request *http.Request) {
+	if m.auth != nil {
+		m.auth.Apply(request)
+	}
+}
+
+func (m *hostsManager) httpDo(method string, rawURL string, body io.Reader, contentType string) (*http.Response, error) {
+	request, err := http.NewRequest(method, rawURL, body)
+	if err != nil {
+		return nil, err
+	}
+	request.Header = m.RequestHeader(urlHostName(request.URL))
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	m.ApplyAuth(request)
+	client := m.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return client.Do(request)
+}
+
+// httpGet - send GET request with crawler identity headers
+func (m *hostsManager) httpGet(rawURL string) (*http.Response, error) {
+	return m.httpDo("GET", rawURL, nil, "")
+}
+
+// Login - send login form of host, if login is not done or session is expired,
+// session cookies are saved in cookie jar
+func (m *hostsManager) Login(hostName string) error {
+	if m.auth == nil {
+		return nil
+	}
+	auth, ok := m.auth.NeedLogin(hostName, m.Now())
+	if !ok {
+		return nil
+	}
+
+	response, err := m.httpDo("POST", auth.LoginURL,
+		strings.NewReader(auth.LoginForm.Encode()), "application/x-www-form-urlencoded")
+	if err == nil {
+		err = response.Body.Close()
+		if response.StatusCode >= 400 {
+			m.auth.SetLoginResult(hostName, false, m.Now())
+			return werrors.NewFields(ErrLogin,
+				zap.Int("status_code", response.StatusCode),
+				zap.String("url", auth.LoginURL))
+		}
+	}
+	if err != nil {
+		m.auth.SetLoginResult(hostName, false, m.Now())
+		return werrors.NewFields(ErrLogin,
+			zap.String("details", err.Error()),
+			zap.String("url", auth.LoginURL))
+	}
+	m.auth.SetLoginResult(hostName, true, m.Now())
+
+	return nil
+}
+
+// CheckSession - login is repeated for host, if response shows, that session is expired
+func (m *hostsManager) CheckSession(hostName string, response *http.Response) {
+	if m.auth == nil {
+		return
+	}
+	var finalURL *url.URL
+	if response.Request != nil {
+		finalURL = response.Request.URL
+	}
+	m.auth.CheckSession(hostName, response.StatusCode, finalURL)
 }
 
 // ResolveHost - find host id
 func (m *hostsManager) ResolveHost(hostName string) sql.NullInt64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	hostID, ok := m.hosts[NormalizeHostName(hostName)]
 	return sql.NullInt64{Int64: hostID, Valid: ok}
 }
 
+func (m *hostsManager) getRobotsTxt(hostID int64) *robotstxt.Group {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.robotsTxt[hostID]
+}
+
+func (m *hostsManager) getOrigin(hostID int64) hostOrigin {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	origin, ok := m.origins[hostID]
+	if !ok {
+		return newHostOrigin("http", 0)
+	}
+
+	return origin
+}
+
+func (m *hostsManager) setOrigin(hostID int64, origin hostOrigin) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.origins == nil {
+		m.origins = make(map[int64]hostOrigin)
+	}
+	m.origins[hostID] = origin
+}
+
+// UpgradeScheme - rewrite http URL to https for hosts with https origin
+// returns true if URL is changed
+func (m *hostsManager) UpgradeScheme(u *url.URL) bool {
+	if u.Scheme != "http" || u.Port() != "" {
+		return false
+	}
+	hostID := m.ResolveHost(urlHostName(u))
+	if !hostID.Valid {
+		return false
+	}
+	origin := m.getOrigin(hostID.Int64)
+	if origin.scheme != "https" {
+		return false
+	}
+
+	u.Scheme = origin.scheme
+	if origin.port != 0 {
+		u.Host = net.JoinHostPort(u.Host, strconv.Itoa(origin.port))
+	}
+
+	return true
+}
+
+// setRobotsTxt - add host or swap robots.txt rules for existing host
+func (m *hostsManager) setRobotsTxt(hostName string, hostID int64, group *robotstxt.Group, fetchedAt time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.robotsFetchedAt == nil {
+		m.robotsFetchedAt = make(map[int64]time.Time)
+	}
+	m.hosts[NormalizeHostName(hostName)] = hostID
+	m.robotsTxt[hostID] = group
+	m.robotsFetchedAt[hostID] = fetchedAt
+}
+
 // CheckURL - check URL by robots.txt
 func (m *hostsManager) CheckURL(u *url.URL) (sql.NullInt64, bool) {
-	hostID := m.ResolveHost(u.Host)
+	hostID := m.ResolveHost(urlHostName(u))
 	if !hostID.Valid {
 		return hostID, false
 	}
@@ -34,12 +250,132 @@ func (m *hostsManager) CheckURL(u *url.URL) (sql.NullInt64, bool) {
 	copyURL := *u
 	copyURL.Scheme = ""
 	copyURL.Host = ""
-	return hostID, m.robotsTxt[hostID.Int64].Test(copyURL.String())
+	return hostID, m.getRobotsTxt(hostID.Int64).Test(copyURL.String())
+}
+
+// CheckRules - check URL with click depth by include/exclude rules, crawler traps and limits of host
+// returns false, reason and details if URL is rejected
+func (m *hostsManager) CheckRules(u *url.URL, urlStr string, depth int) (database.RejectReason, string, bool) {
+	rules, hasRules := m.rules[urlHostName(u)]
+	if hasRules {
+		reason, details, ok := rules.CheckFilter(u, depth)
+		if !ok {
+			return reason, details, false
+		}
+	}
+	if m.traps != nil {
+		hostID := m.ResolveHost(urlHostName(u))
+		if hostID.Valid {
+			if pattern, ok := m.traps.Check(hostID.Int64, u, urlStr); !ok {
+				return database.RejectTrap, pattern, false
+			}
+		}
+	}
+	if hasRules {
+		return rules.CheckPages(urlStr)
+	}
+
+	return 0, "", true
 }
 
-// GetHosts - get list of hosts
+// AddContent - check loaded page for crawler trap by hash of content
+func (m *hostsManager) AddContent(u *url.URL, urlStr string, hash string) {
+	if m.traps == nil {
+		return
+	}
+	hostID := m.ResolveHost(urlHostName(u))
+	if hostID.Valid {
+		m.traps.AddContent(hostID.Int64, u, urlStr, hash)
+	}
+}
+
+// loadKnownURLs - load URLs of hosts with page limit from db
+func (m *hostsManager) loadKnownURLs(db proxy.DbHost) error {
+	for hostName, rules := range m.rules {
+		hostID := m.ResolveHost(hostName)
+		if rules.maxPages <= 0 || !hostID.Valid {
+			continue
+		}
+		urls, err := db.GetHostURLs(hostID.Int64, rules.maxPages)
+		if err != nil {
+			return werrors.AddFields(err, zap.String("host", hostName))
+		}
+		rules.AddKnown(urls)
+	}
+
+	return nil
+}
+
+// GetCrawlDelay - get Crawl-delay from robots.txt for host
+func (m *hostsManager) GetCrawlDelay(hostID int64) time.Duration {
+	group := m.getRobotsTxt(hostID)
+	if group == nil {
+		return 0
+	}
+
+	return group.CrawlDelay
+}
+
+// GetHosts - get copy of map[hostName]hostID
 func (m *hostsManager) GetHosts() map[string]int64 {
-	return m.hosts
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make(map[string]int64, len(m.hosts))
+	for hostName, hostID := range m.hosts {
+		result[hostName] = hostID
+	}
+
+	return result
+}
+
+// Discover - offer unknown host from link for crawling
+func (m *hostsManager) Discover(hostName string) {
+	if m.discovery != nil && !m.ResolveHost(hostName).Valid {
+		m.discovery.Offer(hostName)
+	}
+}
+
+// AddHost - init host discovered while crawling, returns id of host
+func (m *hostsManager) AddHost(db proxy.DbHost, hostName string) (int64, error) {
+	m.initMu.Lock()
+	defer m.initMu.Unlock()
+
+	hostName = NormalizeHostName(hostName)
+	if hostID := m.ResolveHost(hostName); hostID.Valid {
+		return hostID.Int64, nil
+	}
+	err := m.initByHostName(db, hostName)
+	if err != nil {
+		return 0, werrors.AddFields(err, zap.String("host", hostName))
+	}
+
+	return m.ResolveHost(hostName).Int64, nil
+}
+
+// AddArchivedHost - add host with base URL and robots.txt from archive without network requests,
+// returns id of host (known host is not changed)
+func (m *hostsManager) AddArchivedHost(db proxy.DbHost, hostName string, baseURL string,
+	robotsStatusCode int, robotsBody []byte) (int64, error) {
+	m.initMu.Lock()
+	defer m.initMu.Unlock()
+
+	hostName = NormalizeHostName(hostName)
+	if hostID := m.ResolveHost(hostName); hostID.Valid {
+		return hostID.Int64, nil
+	}
+	parsed, err := url.Parse(baseURL)
+	if err != nil {
+		return 0, werrors.NewFields(ErrParseBaseURL,
+			zap.String("details", err.Error()),
+			zap.String("parsed_url", baseURL))
+	}
+	_, err = m.saveHost(db, hostName, baseURL, originFromURL(parsed), robotsStatusCode, robotsBody)
+	if err != nil {
+		return 0, werrors.AddFields(err, zap.String("host", hostName))
+	}
+
+	return m.ResolveHost(hostName).Int64, nil
 }
 
 func (m *hostsManager) initByDb(db proxy.DbHost) error {
@@ -55,16 +391,19 @@ func (m *hostsManager) initByDb(db proxy.DbHost) error {
 				zap.String("host", hostName),
 				zap.String("details", err.Error()))
 		}
-		m.hosts[hostName] = id
-		m.robotsTxt[id] = robot.FindGroup("Googlebot")
+		origin := newHostOrigin(host.GetOrigin())
+		m.setOrigin(id, origin)
+		m.setRobotsTxt(hostName, id, m.findRobotsGroup(robot), host.GetRobotsFetchedAt())
+		// sitemaps are reloaded after restart for new URLs and <lastmod> of loaded pages
+		m.loadSitemaps(db, hostName, origin, robot.Sitemaps)
 	}
 
 	return nil
 }
 
-func (m *hostsManager) resolveURL(hostName string) (string, error) {
-	hostURL := NormalizeURL(&url.URL{Scheme: "http", Host: hostName})
-	response, err := http.Get(hostURL)
+func (m *hostsManager) resolveURLWithScheme(hostName string, scheme string) (string, error) {
+	hostURL := NormalizeURL(&url.URL{Scheme: scheme, Host: hostName})
+	response, err := m.httpGet(hostURL)
 	if err == nil {
 		err = response.Body.Close()
 		if response.StatusCode != 200 {
@@ -82,10 +421,31 @@ func (m *hostsManager) resolveURL(hostName string) (string, error) {
 	return response.Request.URL.String(), nil
 }
 
-func (m *hostsManager) readRobotTxt(hostName string) (int, []byte, error) {
+// resolveURL - find base URL of host, https is tried first
+// returns base URL and origin of base URL
+func (m *hostsManager) resolveURL(hostName string) (string, hostOrigin, error) {
+	var err error
+	for _, scheme := range hostSchemes {
+		var baseURL string
+		baseURL, err = m.resolveURLWithScheme(hostName, scheme)
+		if err == nil {
+			parsed, errParse := url.Parse(baseURL)
+			if errParse != nil {
+				return "", hostOrigin{}, werrors.NewFields(ErrParseBaseURL,
+					zap.String("details", errParse.Error()),
+					zap.String("parsed_url", baseURL))
+			}
+			return baseURL, originFromURL(parsed), nil
+		}
+	}
+
+	return "", hostOrigin{}, err
+}
+
+func (m *hostsManager) readRobotTxt(hostName string, origin hostOrigin) (int, []byte, error) {
 	var body []byte
-	robotsURL := NormalizeURL(&url.URL{Scheme: "http", Host: hostName, Path: "robots.txt"})
-	response, err := http.Get(robotsURL)
+	robotsURL := origin.URL(hostName, "robots.txt")
+	response, err := m.httpGet(robotsURL)
 	if err == nil {
 		body, err = ioutil.ReadAll(response.Body)
 		closeErr := response.Body.Close()
@@ -103,16 +463,99 @@ func (m *hostsManager) readRobotTxt(hostName string) (int, []byte, error) {
 	return response.StatusCode, body, nil
 }
 
+func (m *hostsManager) loadSitemaps(db proxy.DbHost, hostName string, origin hostOrigin, robotsSitemaps []string) {
+	if m.sitemapMaxFiles <= 0 {
+		return
+	}
+
+	sitemaps := make([]string, 0, len(robotsSitemaps)+1)
+	sitemaps = append(sitemaps, robotsSitemaps...)
+	sitemaps = append(sitemaps, origin.URL(hostName, "sitemap.xml"))
+
+	loader := newSitemapLoader(m, m.sitemapMaxFiles)
+	for _, sitemapURL := range sitemaps {
+		err := loader.Load(sitemapURL)
+		if err != nil {
+			log.Printf("WARN: Load sitemap %s, message: %s", sitemapURL, err)
+		}
+	}
+
+	err := db.AddSitemapURLs(loader.GetURLs())
+	if err != nil {
+		log.Printf("ERROR: Save sitemap URLs for host %s, message: %s", hostName, err)
+	}
+}
+
 func (m *hostsManager) initByHostName(db proxy.DbHost, hostName string) error {
-	baseURL, err := m.resolveURL(hostName)
+	baseURL, origin, err := m.resolveURL(hostName)
+	if err != nil {
+		return err
+	}
+
+	statusCode, body, err := m.readRobotTxt(hostName, origin)
 	if err != nil {
 		return err
 	}
 
-	statusCode, body, err := m.readRobotTxt(hostName)
+	robot, err := m.saveHost(db, hostName, baseURL, origin, statusCode, body)
+	if err == nil {
+		m.loadSitemaps(db, hostName, origin, robot.Sitemaps)
+	}
+
+	return err
+}
+
+// saveHost - add host with robots.txt to db and to host manager
+func (m *hostsManager) saveHost(db proxy.DbHost, hostName string, baseURL string, origin hostOrigin,
+	statusCode int, body []byte) (*robotstxt.RobotsData, error) {
+	robot, err := robotstxt.FromStatusAndBytes(statusCode, body)
+	if err != nil {
+		return nil, werrors.NewDetails(ErrCreateRobotsTxtFromURL, err)
+	}
+
+	host := proxy.NewHost(hostName, statusCode, body)
+	host.SetOrigin(origin.scheme, origin.port)
+	host.SetRobotsFetchedAt(m.Now())
+	hostID, err := db.AddHost(host, baseURL)
+	if err != nil {
+		return nil, err
+	}
+	m.setOrigin(hostID, origin)
+	m.setRobotsTxt(hostName, hostID, m.findRobotsGroup(robot), host.GetRobotsFetchedAt())
+
+	return robot, nil
+}
+
+// expiredRobotsTxt - get map[hostID]hostName for hosts with expired robots.txt
+func (m *hostsManager) expiredRobotsTxt(now time.Time) map[int64]string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make(map[int64]string)
+	if m.robotsTTL <= 0 {
+		return result
+	}
+	for hostName, hostID := range m.hosts {
+		if now.Sub(m.robotsFetchedAt[hostID]) >= m.robotsTTL {
+			result[hostID] = hostName
+		}
+	}
+
+	return result
+}
+
+func (m *hostsManager) refreshRobotsTxt(db proxy.DbHost, hostID int64, hostName string) error {
+	origin := m.getOrigin(hostID)
+	statusCode, body, err := m.readRobotTxt(hostName, origin)
 	if err != nil {
 		return err
 	}
+	if statusCode >= 500 {
+		// robots.txt is temporarily unavailable, keep previous rules until next refresh
+		return werrors.NewEx(zap.WarnLevel, ErrStatusCode,
+			zap.Int("status_code", statusCode),
+			zap.String("host", hostName))
+	}
 
 	robot, err := robotstxt.FromStatusAndBytes(statusCode, body)
 	if err != nil {
@@ -120,30 +563,62 @@ func (m *hostsManager) initByHostName(db proxy.DbHost, hostName string) error {
 	}
 
 	host := proxy.NewHost(hostName, statusCode, body)
-	hostID, err := db.AddHost(host, baseURL)
+	host.SetOrigin(origin.scheme, origin.port)
+	host.SetRobotsFetchedAt(m.Now())
+	err = db.UpdateRobotsTxt(hostID, host)
+	if err != nil {
+		return err
+	}
+	m.setRobotsTxt(hostName, hostID, m.findRobotsGroup(robot), host.GetRobotsFetchedAt())
 
-	if err == nil {
-		m.hosts[hostName] = hostID
-		m.robotsTxt[hostID] = robot.FindGroup("Googlebot")
+	return nil
+}
+
+// RefreshRobotsTxt - download again expired robots.txt, rules of hosts are swapped for running workers
+func (m *hostsManager) RefreshRobotsTxt(db proxy.DbHost) {
+	for hostID, hostName := range m.expiredRobotsTxt(m.Now()) {
+		err := m.refreshRobotsTxt(db, hostID, hostName)
+		if err != nil {
+			log.Printf("WARN: Refresh robots.txt for host %s, message: %s", hostName, err)
+		}
 	}
+}
 
-	return err
+// StartRobotsTxtRefresh - check expired robots.txt with interval until stop
+func (m *hostsManager) StartRobotsTxtRefresh(db proxy.DbHost, interval time.Duration, stop <-chan struct{}, wgParent *sync.WaitGroup) {
+	defer wgParent.Done()
+	if interval <= 0 || m.robotsTTL <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			m.RefreshRobotsTxt(db)
+		}
+	}
 }
 
 // Init - init host manager
 func (m *hostsManager) Init(db proxy.DbHost, baseHosts []string) error {
 	m.robotsTxt = make(map[int64]*robotstxt.Group, len(baseHosts))
+	m.robotsFetchedAt = make(map[int64]time.Time, len(baseHosts))
+	m.origins = make(map[int64]hostOrigin, len(baseHosts))
 	m.hosts = make(map[string]int64, len(baseHosts))
 
 	err := m.initByDb(db)
 	if err != nil {
 		return err
 	}
+	m.RefreshRobotsTxt(db)
 
 	for _, hostNameRaw := range baseHosts {
 		hostName := NormalizeHostName(hostNameRaw)
-		_, exists := m.hosts[hostName]
-		if !exists {
+		if !m.ResolveHost(hostName).Valid {
 			err = m.initByHostName(db, hostName)
 			if err != nil {
 				return werrors.AddFields(err, zap.String("host", hostName))
@@ -151,5 +626,12 @@ func (m *hostsManager) Init(db proxy.DbHost, baseHosts []string) error {
 		}
 	}
 
-	return nil
+	if m.traps != nil {
+		err = m.traps.Init()
+		if err != nil {
+			return err
+		}
+	}
+
+	return m.loadKnownURLs(db)
 }
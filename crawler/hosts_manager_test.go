@@ -3,10 +3,12 @@ package crawler
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/ReanGD/go-web-search/proxy"
 	. "github.com/smartystreets/goconvey/convey"
@@ -14,10 +16,18 @@ import (
 )
 
 type fakeDbHost struct {
+	// hostName - name of host in db ("" - "hostName")
+	hostName     string
 	host         *proxy.Host
 	baseURL      string
 	robotTxtData string
 	getHostErr   string
+	sitemapURLs  []*proxy.SitemapURL
+	cookies      []*proxy.Cookie
+	cookiesSaved time.Time
+	hostURLs     []string
+	traps        []*proxy.Trap
+	hashes       map[string]string
 }
 
 func (f *fakeDbHost) GetHosts() (map[int64]*proxy.Host, error) {
@@ -26,7 +36,11 @@ func (f *fakeDbHost) GetHosts() (map[int64]*proxy.Host, error) {
 		return result, errors.New(f.getHostErr)
 	}
 	if f.robotTxtData != "" {
-		result[1] = proxy.NewHost("hostName", 200, []byte(f.robotTxtData))
+		hostName := f.hostName
+		if hostName == "" {
+			hostName = "hostName"
+		}
+		result[1] = proxy.NewHost(hostName, 200, []byte(f.robotTxtData))
 	}
 
 	return result, nil
@@ -39,6 +53,51 @@ func (f *fakeDbHost) AddHost(host *proxy.Host, baseURL string) (int64, error) {
 	return 1, nil
 }
 
+func (f *fakeDbHost) UpdateRobotsTxt(hostID int64, host *proxy.Host) error {
+	f.host = host
+
+	return nil
+}
+
+func (f *fakeDbHost) GetCookies(hostID int64) ([]*proxy.Cookie, error) {
+	return f.cookies, nil
+}
+
+func (f *fakeDbHost) SaveCookies(hostID int64, cookies []*proxy.Cookie, now time.Time) error {
+	f.cookies = append(f.cookies, cookies...)
+	f.cookiesSaved = now
+
+	return nil
+}
+
+func (f *fakeDbHost) AddSitemapURLs(urls []*proxy.SitemapURL) error {
+	f.sitemapURLs = append(f.sitemapURLs, urls...)
+
+	return nil
+}
+
+func (f *fakeDbHost) GetTraps() ([]*proxy.Trap, error) {
+	return f.traps, nil
+}
+
+func (f *fakeDbHost) SaveTrap(trap *proxy.Trap) error {
+	f.traps = append(f.traps, trap)
+
+	return nil
+}
+
+func (f *fakeDbHost) GetContentHashes(hostID int64) (map[string]string, error) {
+	return f.hashes, nil
+}
+
+func (f *fakeDbHost) GetHostURLs(hostID int64, cnt int) ([]string, error) {
+	if len(f.hostURLs) > cnt {
+		return f.hostURLs[:cnt], nil
+	}
+
+	return f.hostURLs, nil
+}
+
 // TestResolveHost ...
 func TestResolveHost(t *testing.T) {
 	Convey("Check resolve hosts", t, func() {
@@ -47,6 +106,17 @@ func TestResolveHost(t *testing.T) {
 		So(h.ResolveHost("HoStNaMe2"), ShouldResemble, sql.NullInt64{Int64: 2, Valid: true})
 		So(h.ResolveHost("hostName3"), ShouldResemble, sql.NullInt64{Valid: false})
 	})
+
+	Convey("Resolve internationalized hosts", t, func() {
+		h := &hostsManager{hosts: map[string]int64{"xn--e1afmkfd.xn--p1ai": 1}}
+		So(h.ResolveHost("пример.рф"), ShouldResemble, sql.NullInt64{Int64: 1, Valid: true})
+		So(h.ResolveHost("www.xn--e1afmkfd.xn--p1ai."), ShouldResemble, sql.NullInt64{Int64: 1, Valid: true})
+		u, _ := url.Parse("https://пример.рф:443/")
+		So(h.ResolveHost(urlHostName(u)), ShouldResemble, sql.NullInt64{Int64: 1, Valid: true})
+		u, _ = url.Parse("http://пример.рф:443/")
+		So(h.ResolveHost(urlHostName(u)), ShouldResemble, sql.NullInt64{Valid: false})
+		So(h.ResolveHost("пример.рф:8080"), ShouldResemble, sql.NullInt64{Valid: false})
+	})
 }
 
 // TestCheckURL ...
@@ -115,6 +185,32 @@ Disallow: /search/`
 	})
 }
 
+// TestUpgradeScheme ...
+func TestUpgradeScheme(t *testing.T) {
+	Convey("Upgrade http URLs for hosts with https origin", t, func() {
+		h := &hostsManager{hosts: map[string]int64{"secure": 1, "plain": 2, "port": 3}}
+		h.setOrigin(1, newHostOrigin("https", 443))
+		h.setOrigin(2, newHostOrigin("http", 0))
+		h.setOrigin(3, newHostOrigin("https", 8443))
+
+		u := &url.URL{Scheme: "http", Host: "www.secure", Path: "/page"}
+		So(h.UpgradeScheme(u), ShouldBeTrue)
+		So(u.String(), ShouldEqual, "https://www.secure/page")
+
+		u = &url.URL{Scheme: "http", Host: "port", Path: "/page"}
+		So(h.UpgradeScheme(u), ShouldBeTrue)
+		So(u.String(), ShouldEqual, "https://port:8443/page")
+
+		u = &url.URL{Scheme: "http", Host: "plain", Path: "/page"}
+		So(h.UpgradeScheme(u), ShouldBeFalse)
+		u = &url.URL{Scheme: "http", Host: "secure:8080", Path: "/page"}
+		So(h.UpgradeScheme(u), ShouldBeFalse)
+		u = &url.URL{Scheme: "http", Host: "unknown", Path: "/page"}
+		So(h.UpgradeScheme(u), ShouldBeFalse)
+		So(u.String(), ShouldEqual, "http://unknown/page")
+	})
+}
+
 // TestGetHosts ...
 func TestGetHosts(t *testing.T) {
 	Convey("Success resolve", t, func() {
@@ -138,9 +234,27 @@ func TestResolveURL(t *testing.T) {
 		So(err, ShouldBeNil)
 
 		h := &hostsManager{}
-		resolvedURL, err := h.resolveURL(parsedURL.Host)
+		resolvedURL, origin, err := h.resolveURL(parsedURL.Host)
 		So(err, ShouldBeNil)
 		So(resolvedURL, ShouldEqual, ts.URL+"/?n=1")
+		So(origin.scheme, ShouldEqual, "http")
+		So(origin.URL(parsedURL.Host, "robots.txt"), ShouldEqual, ts.URL+"/robots.txt")
+	})
+
+	Convey("HTTPS is preferred", t, func() {
+		ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		}))
+		defer ts.Close()
+
+		parsedURL, err := url.Parse(ts.URL)
+		So(err, ShouldBeNil)
+
+		h := &hostsManager{client: ts.Client()}
+		resolvedURL, origin, err := h.resolveURL(parsedURL.Host)
+		So(err, ShouldBeNil)
+		So(resolvedURL, ShouldEqual, ts.URL)
+		So(origin.scheme, ShouldEqual, "https")
+		So(origin.URL(parsedURL.Host, "robots.txt"), ShouldEqual, ts.URL+"/robots.txt")
 	})
 }
 
@@ -157,7 +271,7 @@ func TestReadRobotTxt(t *testing.T) {
 		So(err, ShouldBeNil)
 
 		h := &hostsManager{}
-		statusCode, body, err := h.readRobotTxt(parsedURL.Host)
+		statusCode, body, err := h.readRobotTxt(parsedURL.Host, newHostOrigin("http", 0))
 		So(err, ShouldBeNil)
 		So(statusCode, ShouldEqual, 200)
 		So(string(body), ShouldEqual, expected)
@@ -189,15 +303,20 @@ func TestInitByHostName(t *testing.T) {
 		robot, err := robotstxt.FromStatusAndBytes(200, robotstxtBody)
 		So(err, ShouldBeNil)
 		robotsTxtExpected := make(map[int64]*robotstxt.Group)
-		robotsTxtExpected[hostID] = robot.FindGroup("Googlebot")
+		robotsTxtExpected[hostID] = robot.FindGroup(NewIdentity().RobotsToken)
 		host := proxy.NewHost(hostName, 200, robotstxtBody)
 
 		err = h.initByHostName(db, hostName)
 		So(err, ShouldBeNil)
 		So(h.hosts, ShouldResemble, hostsExpected)
 		So(h.robotsTxt, ShouldResemble, robotsTxtExpected)
+		So(db.host.GetRobotsFetchedAt().IsZero(), ShouldBeFalse)
+		So(h.robotsFetchedAt[hostID], ShouldResemble, db.host.GetRobotsFetchedAt())
+		host.SetRobotsFetchedAt(db.host.GetRobotsFetchedAt())
+		host.SetOrigin("http", originFromURL(parsedURL).port)
 		So(db.host, ShouldResemble, host)
 		So(db.baseURL, ShouldEqual, baseURL)
+		So(h.getOrigin(hostID), ShouldResemble, originFromURL(parsedURL))
 	})
 
 	Convey("Failed resolve base URL by status code", t, func() {
@@ -266,11 +385,11 @@ func TestInitByDb(t *testing.T) {
 		var hostID int64
 		hostID = 1
 		hostsExpected := make(map[string]int64)
-		hostsExpected["hostName"] = hostID
+		hostsExpected["hostname"] = hostID
 		robot, err := robotstxt.FromStatusAndBytes(200, []byte(db.robotTxtData))
 		So(err, ShouldBeNil)
 		robotsTxtExpected := make(map[int64]*robotstxt.Group)
-		robotsTxtExpected[hostID] = robot.FindGroup("Googlebot")
+		robotsTxtExpected[hostID] = robot.FindGroup(NewIdentity().RobotsToken)
 
 		err = h.initByDb(db)
 		So(err, ShouldBeNil)
@@ -278,6 +397,31 @@ func TestInitByDb(t *testing.T) {
 		So(h.robotsTxt, ShouldResemble, robotsTxtExpected)
 	})
 
+	Convey("Sitemaps of host from db are loaded", t, func() {
+		var ts *httptest.Server
+		ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/sitemap.xml" {
+				_, _ = fmt.Fprintf(w, sitemapURLSet, ts.URL, ts.URL)
+				return
+			}
+			http.NotFound(w, r)
+		}))
+		defer ts.Close()
+
+		parsed, err := url.Parse(ts.URL)
+		So(err, ShouldBeNil)
+		h := &hostsManager{
+			sitemapMaxFiles: 1,
+			robotsTxt:       make(map[int64]*robotstxt.Group),
+			hosts:           make(map[string]int64)}
+		db := &fakeDbHost{hostName: parsed.Host, robotTxtData: "User-agent: *\nDisallow: /private\n"}
+
+		err = h.initByDb(db)
+		So(err, ShouldBeNil)
+		So(len(db.sitemapURLs), ShouldEqual, 1)
+		So(db.sitemapURLs[0].GetURL(), ShouldEqual, ts.URL+"/page1")
+	})
+
 	Convey("Failed by db.GetHosts", t, func() {
 		h := &hostsManager{}
 		db := &fakeDbHost{getHostErr: "get host error"}
@@ -326,3 +470,73 @@ func TestInitHostManager(t *testing.T) {
 		So(h.robotsTxt, ShouldBeEmpty)
 	})
 }
+
+// TestRefreshRobotsTxt ...
+func TestRefreshRobotsTxt(t *testing.T) {
+	helperInit := func(ts *httptest.Server, fetchedAt time.Time) (*hostsManager, string) {
+		parsedURL, err := url.Parse(ts.URL)
+		So(err, ShouldBeNil)
+		robot, err := robotstxt.FromStatusAndBytes(200, []byte("User-agent: *\nDisallow: /old"))
+		So(err, ShouldBeNil)
+		h := &hostsManager{
+			robotsTxt: make(map[int64]*robotstxt.Group),
+			hosts:     make(map[string]int64),
+			robotsTTL: time.Hour}
+		h.setRobotsTxt(parsedURL.Host, 1, robot.FindGroup("Googlebot"), fetchedAt)
+
+		return h, parsedURL.Host
+	}
+
+	Convey("Expired robots.txt is swapped", t, func() {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("User-agent: *\nDisallow: /new"))
+		}))
+		defer ts.Close()
+
+		h, hostName := helperInit(ts, time.Now().Add(-2*time.Hour))
+		db := &fakeDbHost{}
+		h.RefreshRobotsTxt(db)
+		So(db.host, ShouldNotBeNil)
+		So(db.host.GetName(), ShouldEqual, hostName)
+		_, robotOk := h.CheckURL(&url.URL{Host: hostName, Path: "/old"})
+		So(robotOk, ShouldBeTrue)
+		_, robotOk = h.CheckURL(&url.URL{Host: hostName, Path: "/new"})
+		So(robotOk, ShouldBeFalse)
+		So(h.robotsFetchedAt[1], ShouldResemble, db.host.GetRobotsFetchedAt())
+	})
+
+	Convey("Not expired robots.txt is not downloaded", t, func() {
+		cnt := 0
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cnt++
+		}))
+		defer ts.Close()
+
+		h, _ := helperInit(ts, time.Now())
+		db := &fakeDbHost{}
+		h.RefreshRobotsTxt(db)
+		So(cnt, ShouldEqual, 0)
+		So(db.host, ShouldBeNil)
+
+		h.robotsTTL = 0
+		So(h.expiredRobotsTxt(time.Now().Add(time.Hour)), ShouldBeEmpty)
+	})
+
+	Convey("Server error keeps previous rules", t, func() {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "error status", 503)
+		}))
+		defer ts.Close()
+
+		fetchedAt := time.Now().Add(-2 * time.Hour)
+		h, hostName := helperInit(ts, fetchedAt)
+		db := &fakeDbHost{}
+		err := h.refreshRobotsTxt(db, 1, hostName)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, ErrStatusCode)
+		So(db.host, ShouldBeNil)
+		_, robotOk := h.CheckURL(&url.URL{Host: hostName, Path: "/old"})
+		So(robotOk, ShouldBeFalse)
+		So(h.robotsFetchedAt[1], ShouldResemble, fetchedAt)
+	})
+}
@@ -5,7 +5,9 @@ import (
 	"database/sql"
 	"net/url"
 	"strings"
+	"time"
 
+	"github.com/ReanGD/go-web-search/proxy"
 	"github.com/ReanGD/go-web-search/werrors"
 	"github.com/uber-go/zap"
 )
@@ -13,9 +15,18 @@ import (
 // HTMLMetadata extracted meta data from HTML
 type HTMLMetadata struct {
 	// [URL]hostID
-	URLs         map[string]sql.NullInt64
+	URLs map[string]sql.NullInt64
+	// Rejected - map[URL]links rejected by rules of host
+	Rejected     map[string]*proxy.RejectedURL
 	MetaTagIndex bool
 	title        string
+	// canonical - normalized canonical URL from <link rel="canonical"> or header Link ("" - not found)
+	canonical string
+	// refresh - normalized target URL of <meta http-equiv="refresh"> ("" - not found)
+	refresh      string
+	refreshDelay time.Duration
+	// linkDepth - click depth of links from page
+	linkDepth int
 	// [URL]error
 	wrongURLs map[string]string
 	baseURL   *url.URL
@@ -33,14 +44,21 @@ func NewHTMLMetadata(hostMng *hostsManager, urlStr string) (*HTMLMetadata, error
 
 	return &HTMLMetadata{
 		URLs:         make(map[string]sql.NullInt64),
+		Rejected:     make(map[string]*proxy.RejectedURL),
 		wrongURLs:    make(map[string]string),
 		title:        "",
 		MetaTagIndex: true,
+		linkDepth:    1,
 		baseURL:      baseURL,
 		hostMng:      hostMng,
 	}, nil
 }
 
+// SetDepth - set click depth of page, links from page have depth + 1
+func (h *HTMLMetadata) SetDepth(depth int) {
+	h.linkDepth = depth + 1
+}
+
 // SetTitle - set title
 func (h *HTMLMetadata) SetTitle(title string, rewrite bool) {
 	if title != "" && (h.title == "" || rewrite) {
@@ -62,31 +80,100 @@ func (h *HTMLMetadata) GetTitle() string {
 	return h.title
 }
 
+// resolveURL - get absolute normalized URL for link
+func (h *HTMLMetadata) resolveURL(link string) (*url.URL, string, bool) {
+	relative, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		h.wrongURLs[link] = err.Error()
+		return nil, "", false
+	}
+
+	parsed := h.baseURL.ResolveReference(relative)
+	urlStr := h.hostMng.NormalizeURL(parsed)
+	parsed, _ = url.Parse(urlStr)
+	if h.hostMng.UpgradeScheme(parsed) {
+		urlStr = h.hostMng.NormalizeURL(parsed)
+	}
+
+	return parsed, urlStr, parsed.Scheme == "http" || parsed.Scheme == "https"
+}
+
 // AddURL - add not parsed URL
 func (h *HTMLMetadata) AddURL(link string) {
 	if link == "" {
 		return
 	}
-	relative, err := url.Parse(strings.TrimSpace(link))
-	if err != nil {
-		h.wrongURLs[link] = err.Error()
+
+	parsed, urlStr, ok := h.resolveURL(link)
+	if !ok || urlStr == h.baseURL.String() {
+		return
+	}
+	hostID := h.hostMng.ResolveHost(urlHostName(parsed))
+	if !hostID.Valid {
+		h.hostMng.Discover(urlHostName(parsed))
+		h.URLs[urlStr] = hostID
+		return
+	}
+	if _, exists := h.URLs[urlStr]; exists {
 		return
 	}
+	reason, details, accepted := h.hostMng.CheckRules(parsed, urlStr, h.linkDepth)
+	if !accepted {
+		h.Rejected[urlStr] = proxy.NewRejectedURL(urlStr, hostID, reason, details)
+		return
+	}
+	h.URLs[urlStr] = hostID
+}
 
-	parsed := h.baseURL.ResolveReference(relative)
-	urlStr := NormalizeURL(parsed)
-	parsed, _ = url.Parse(urlStr)
+// SetCanonical - set canonical URL, canonical URL from external host is ignored
+// rewrite - rewrite previous value (header Link has priority over HTML)
+func (h *HTMLMetadata) SetCanonical(link string, rewrite bool) {
+	if link == "" || (h.canonical != "" && !rewrite) {
+		return
+	}
+
+	parsed, urlStr, ok := h.resolveURL(link)
+	if ok && h.hostMng.ResolveHost(urlHostName(parsed)).Valid {
+		h.canonical = urlStr
+	}
+}
 
-	if (parsed.Scheme == "http" || parsed.Scheme == "https") && urlStr != h.baseURL.String() {
-		h.URLs[urlStr] = h.hostMng.ResolveHost(parsed.Host)
+// GetCanonical - get canonical URL and its hostID ("" - not found)
+func (h *HTMLMetadata) GetCanonical() (string, sql.NullInt64) {
+	if h.canonical == "" {
+		return "", sql.NullInt64{Valid: false}
+	}
+	parsed, _ := url.Parse(h.canonical)
+
+	return h.canonical, h.hostMng.ResolveHost(urlHostName(parsed))
+}
+
+// SetRefresh - set target of <meta http-equiv="refresh">, only first refresh is used
+func (h *HTMLMetadata) SetRefresh(link string, delay time.Duration) {
+	if link == "" || h.refresh != "" {
+		return
+	}
+
+	_, urlStr, ok := h.resolveURL(link)
+	if ok && urlStr != h.baseURL.String() {
+		h.refresh = urlStr
+		h.refreshDelay = delay
 	}
 }
 
+// GetRefresh - get target URL and delay of <meta http-equiv="refresh"> ("" - not found)
+func (h *HTMLMetadata) GetRefresh() (string, time.Duration) {
+	return h.refresh, h.refreshDelay
+}
+
 // ClearURLs - remove all URLs
 func (h *HTMLMetadata) ClearURLs() {
 	if len(h.URLs) != 0 {
 		h.URLs = make(map[string]sql.NullInt64)
 	}
+	if len(h.Rejected) != 0 {
+		h.Rejected = make(map[string]*proxy.RejectedURL)
+	}
 }
 
 // WrongURLsToLog - write to log add wrong URLs
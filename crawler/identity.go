@@ -0,0 +1,46 @@
+package crawler
+
+import "net/http"
+
+// Identity - how crawler introduces itself to sites
+type Identity struct {
+	// UserAgent - value of User-Agent header
+	UserAgent string
+	// RobotsToken - name of crawler for search of group in robots.txt
+	RobotsToken string
+	// Headers - default headers for all requests
+	Headers http.Header
+	// HostHeaders - map[hostName]headers, they override default headers for host
+	HostHeaders map[string]http.Header
+}
+
+// NewIdentity - create Identity with default values
+func NewIdentity() *Identity {
+	return &Identity{
+		UserAgent:   "Mozilla/5.0 (compatible; GoWebSearch/0.1)",
+		RobotsToken: "GoWebSearch",
+		Headers: http.Header{
+			"Accept":          {"text/html;q=0.9,*/*;q=0.1"},
+			"Accept-Language": {"ru-RU,ru;q=0.9,en-US;q=0.2,en;q=0.1"},
+			"Accept-Charset":  {"utf-8;q=0.9,windows-1251;q=0.8,koi8-r;q=0.7,*;q=0.1"},
+		},
+		HostHeaders: make(map[string]http.Header)}
+}
+
+func copyHeader(dst http.Header, src http.Header) {
+	for key, values := range src {
+		dst[http.CanonicalHeaderKey(key)] = append([]string(nil), values...)
+	}
+}
+
+// Header - get request headers for host
+func (i *Identity) Header(hostName string) http.Header {
+	result := make(http.Header)
+	copyHeader(result, i.Headers)
+	if i.UserAgent != "" {
+		result.Set("User-Agent", i.UserAgent)
+	}
+	copyHeader(result, i.HostHeaders[NormalizeHostName(hostName)])
+
+	return result
+}
@@ -0,0 +1,72 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/temoto/robotstxt-go"
+)
+
+// TestIdentityHeader ...
+func TestIdentityHeader(t *testing.T) {
+	Convey("Default headers", t, func() {
+		identity := NewIdentity()
+		header := identity.Header("host")
+		So(header.Get("User-Agent"), ShouldEqual, identity.UserAgent)
+		So(header.Get("Accept"), ShouldEqual, identity.Headers.Get("Accept"))
+
+		header.Set("Accept", "changed")
+		So(identity.Headers.Get("Accept"), ShouldNotEqual, "changed")
+	})
+
+	Convey("Host headers override defaults", t, func() {
+		identity := NewIdentity()
+		identity.HostHeaders["host"] = http.Header{
+			"accept-language": {"en-US"},
+			"User-Agent":      {"HostBot/1.0"}}
+		header := identity.Header("www.Host")
+		So(header.Get("Accept-Language"), ShouldEqual, "en-US")
+		So(header.Get("User-Agent"), ShouldEqual, "HostBot/1.0")
+		So(header.Get("Accept"), ShouldEqual, identity.Headers.Get("Accept"))
+
+		header = identity.Header("other")
+		So(header.Get("User-Agent"), ShouldEqual, identity.UserAgent)
+	})
+}
+
+// TestIdentityHostsManager ...
+func TestIdentityHostsManager(t *testing.T) {
+	Convey("Robots group is found by robots token", t, func() {
+		robot, err := robotstxt.FromStatusAndBytes(200, []byte("User-agent: TestBot\nDisallow: /private\n\nUser-agent: *\nDisallow: /"))
+		So(err, ShouldBeNil)
+		identity := NewIdentity()
+		identity.RobotsToken = "TestBot"
+		h := &hostsManager{identity: identity}
+		group := h.findRobotsGroup(robot)
+		So(group.Test("/page"), ShouldBeTrue)
+		So(group.Test("/private"), ShouldBeFalse)
+	})
+
+	Convey("Identity is used for robots.txt and resolve URL requests", t, func() {
+		userAgents := make([]string, 0)
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userAgents = append(userAgents, r.Header.Get("User-Agent"))
+		}))
+		defer ts.Close()
+
+		parsedURL, err := url.Parse(ts.URL)
+		So(err, ShouldBeNil)
+		identity := NewIdentity()
+		identity.UserAgent = "TestBot/1.0"
+		h := &hostsManager{identity: identity}
+
+		_, origin, err := h.resolveURL(parsedURL.Host)
+		So(err, ShouldBeNil)
+		_, _, err = h.readRobotTxt(parsedURL.Host, origin)
+		So(err, ShouldBeNil)
+		So(userAgents, ShouldResemble, []string{"TestBot/1.0", "TestBot/1.0"})
+	})
+}
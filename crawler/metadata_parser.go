@@ -3,6 +3,7 @@ package crawler
 import (
 	"mime"
 	"net/http"
+	"strings"
 
 	"github.com/ReanGD/go-web-search/werrors"
 	"github.com/uber-go/zap"
@@ -44,10 +45,46 @@ func checkContentType(header *http.Header) (string, error) {
 	return contentType, nil
 }
 
+// getContentEncoding - get list of encodings, they can be in one or several headers
 func getContentEncoding(header *http.Header) string {
 	contentEncodingArr, ok := (*header)["Content-Encoding"]
 	if ok && len(contentEncodingArr) != 0 {
-		return contentEncodingArr[0]
+		return strings.Join(contentEncodingArr, ", ")
+	}
+
+	return ""
+}
+
+// hasRel - check that value of attribute rel contains token (value is space separated list)
+func hasRel(rel string, token string) bool {
+	for _, it := range strings.Fields(strings.ToLower(rel)) {
+		if it == token {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getCanonicalLink - get target of header "Link: <URL>; rel=canonical" (RFC 8288)
+func getCanonicalLink(header *http.Header) string {
+	for _, value := range (*header)["Link"] {
+		for _, link := range strings.Split(value, ",") {
+			params := strings.Split(link, ";")
+			target := strings.TrimSpace(params[0])
+			if len(target) < 2 || target[0] != '<' || target[len(target)-1] != '>' {
+				continue
+			}
+			for _, param := range params[1:] {
+				keyVal := strings.SplitN(param, "=", 2)
+				if len(keyVal) != 2 || strings.ToLower(strings.TrimSpace(keyVal[0])) != "rel" {
+					continue
+				}
+				if hasRel(strings.Trim(strings.TrimSpace(keyVal[1]), `"`), "canonical") {
+					return strings.TrimSpace(target[1 : len(target)-1])
+				}
+			}
+		}
 	}
 
 	return ""
@@ -90,7 +90,7 @@ func TestGetContentEncoding(t *testing.T) {
 			"Content-Encoding1": []string{"val0", "val1"},
 			"Content-Encoding":  []string{"val2", "val3"},
 			"Content-Encoding2": []string{"val4", "val5"}}
-		So(getContentEncoding(header), ShouldEqual, "val2")
+		So(getContentEncoding(header), ShouldEqual, "val2, val3")
 	})
 
 	Convey("empty header", t, func() {
@@ -98,3 +98,24 @@ func TestGetContentEncoding(t *testing.T) {
 		So(getContentEncoding(header), ShouldEqual, "")
 	})
 }
+
+// TestGetCanonicalLink ...
+func TestGetCanonicalLink(t *testing.T) {
+	Convey("Canonical in list of links", t, func() {
+		header := &http.Header{"Link": []string{
+			`<http://host/next>; rel="next"`,
+			`<http://host/style.css>; rel=stylesheet, < http://host/page >; title="page"; rel="Canonical"`}}
+		So(getCanonicalLink(header), ShouldEqual, "http://host/page")
+	})
+
+	Convey("Without canonical", t, func() {
+		header := &http.Header{"Link": []string{`<http://host/next>; rel="next"`, `http://host/page; rel=canonical`}}
+		So(getCanonicalLink(header), ShouldEqual, "")
+		So(getCanonicalLink(&http.Header{}), ShouldEqual, "")
+	})
+
+	Convey("Rel with several values", t, func() {
+		So(hasRel("alternate Canonical", "canonical"), ShouldBeTrue)
+		So(hasRel("canonical-like", "canonical"), ShouldBeFalse)
+	})
+}
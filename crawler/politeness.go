@@ -0,0 +1,116 @@
+package crawler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxRetryAfter - upper limit for Retry-After header value
+const maxRetryAfter = time.Hour
+
+// latencyWeight - weight of new sample in average latency
+const latencyWeight = 0.3
+
+// politeness - per host controller of delay between requests
+// combine robots.txt Crawl-delay, min delay, Retry-After and response latency
+type politeness struct {
+	mu            sync.Mutex
+	hostMng       *hostsManager
+	hostID        int64
+	minDelay      time.Duration
+	maxDelay      time.Duration
+	latencyFactor float64
+	latency       time.Duration
+	retryAfter    time.Time
+	now           func() time.Time
+}
+
+func newPoliteness(hostMng *hostsManager, hostID int64, cfg *Config) *politeness {
+	return &politeness{
+		hostMng:       hostMng,
+		hostID:        hostID,
+		minDelay:      cfg.MinDelay,
+		maxDelay:      cfg.MaxDelay,
+		latencyFactor: cfg.LatencyFactor,
+		now:           cfg.now()}
+}
+
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	if date.Before(now) {
+		return 0, true
+	}
+
+	return date.Sub(now), true
+}
+
+// Update - register server answer
+func (p *politeness) Update(statusCode int, header http.Header, latency time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.latency == 0 {
+		p.latency = latency
+	} else {
+		p.latency = time.Duration(float64(p.latency)*(1-latencyWeight) + float64(latency)*latencyWeight)
+	}
+
+	if statusCode != http.StatusTooManyRequests && statusCode != http.StatusServiceUnavailable {
+		return
+	}
+
+	now := p.now()
+	wait, ok := parseRetryAfter(header.Get("Retry-After"), now)
+	if !ok {
+		wait = p.maxDelay
+	}
+	if wait > maxRetryAfter {
+		wait = maxRetryAfter
+	}
+	p.retryAfter = now.Add(wait)
+}
+
+// Delay - get delay before next request to host
+func (p *politeness) Delay() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	result := time.Duration(float64(p.latency) * p.latencyFactor)
+	if result < p.minDelay {
+		result = p.minDelay
+	}
+	if result > p.maxDelay {
+		result = p.maxDelay
+	}
+
+	robotsDelay := p.hostMng.GetCrawlDelay(p.hostID)
+	if result < robotsDelay {
+		result = robotsDelay
+	}
+
+	retryAfter := p.retryAfter.Sub(p.now())
+	if result < retryAfter {
+		result = retryAfter
+	}
+
+	return result
+}
@@ -0,0 +1,95 @@
+package crawler
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/temoto/robotstxt-go"
+)
+
+func helperNewPoliteness(robotsBody string) *politeness {
+	robot, err := robotstxt.FromStatusAndBytes(200, []byte(robotsBody))
+	So(err, ShouldBeNil)
+
+	hostMng := &hostsManager{robotsTxt: map[int64]*robotstxt.Group{1: robot.FindGroup("Googlebot")}}
+	cfg := NewConfig([]string{}, 0)
+	cfg.MinDelay = time.Second
+	cfg.MaxDelay = 10 * time.Second
+	cfg.LatencyFactor = 2
+	p := newPoliteness(hostMng, 1, cfg)
+	now := time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC)
+	p.now = func() time.Time { return now }
+
+	return p
+}
+
+// TestParseRetryAfter ...
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	Convey("Seconds", t, func() {
+		wait, ok := parseRetryAfter(" 120 ", now)
+		So(ok, ShouldBeTrue)
+		So(wait, ShouldEqual, 2*time.Minute)
+	})
+
+	Convey("HTTP date", t, func() {
+		wait, ok := parseRetryAfter("Sat, 01 Oct 2016 12:00:30 GMT", now)
+		So(ok, ShouldBeTrue)
+		So(wait, ShouldEqual, 30*time.Second)
+
+		wait, ok = parseRetryAfter("Sat, 01 Oct 2016 11:00:00 GMT", now)
+		So(ok, ShouldBeTrue)
+		So(wait, ShouldEqual, 0)
+	})
+
+	Convey("Wrong value", t, func() {
+		_, ok := parseRetryAfter("", now)
+		So(ok, ShouldBeFalse)
+		_, ok = parseRetryAfter("-5", now)
+		So(ok, ShouldBeFalse)
+		_, ok = parseRetryAfter("tomorrow", now)
+		So(ok, ShouldBeFalse)
+	})
+}
+
+// TestPolitenessDelay ...
+func TestPolitenessDelay(t *testing.T) {
+	Convey("Min delay", t, func() {
+		p := helperNewPoliteness("User-agent: *")
+		So(p.Delay(), ShouldEqual, time.Second)
+	})
+
+	Convey("Robots.txt Crawl-delay", t, func() {
+		p := helperNewPoliteness("User-agent: *\nCrawl-delay: 15")
+		So(p.Delay(), ShouldEqual, 15*time.Second)
+	})
+
+	Convey("Unknown host", t, func() {
+		p := helperNewPoliteness("User-agent: *")
+		p.hostID = 2
+		So(p.Delay(), ShouldEqual, time.Second)
+	})
+
+	Convey("Slow down by latency", t, func() {
+		p := helperNewPoliteness("User-agent: *")
+		p.Update(200, http.Header{}, 2*time.Second)
+		So(p.Delay(), ShouldEqual, 4*time.Second)
+		p.Update(200, http.Header{}, 12*time.Second)
+		So(p.Delay(), ShouldEqual, 10*time.Second)
+	})
+
+	Convey("Retry-After", t, func() {
+		p := helperNewPoliteness("User-agent: *")
+		p.Update(503, http.Header{"Retry-After": []string{"30"}}, 0)
+		So(p.Delay(), ShouldEqual, 30*time.Second)
+
+		p.Update(429, http.Header{"Retry-After": []string{"100000"}}, 0)
+		So(p.Delay(), ShouldEqual, maxRetryAfter)
+
+		p.Update(429, http.Header{}, 0)
+		So(p.Delay(), ShouldEqual, 10*time.Second)
+	})
+}
@@ -0,0 +1,159 @@
+package crawler
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ReanGD/go-web-search/content"
+)
+
+const (
+	// pageRankDamping - damping factor of PageRank
+	pageRankDamping = 0.85
+	// linksBatchSize - count of links read from db at once for PageRank
+	linksBatchSize = 10000
+)
+
+// dbPriority - database interface for priority updater
+type dbPriority interface {
+	// GetPriorityFactors - get data for priority calculation of not loaded URLs
+	GetPriorityFactors() ([]content.PriorityFactors, error)
+	// UpdatePriorities - save priorities of URLs, map[URL.ID]priority
+	UpdatePriorities(priorities map[int64]float64) error
+	// GetLinks - get next cnt links between URLs after link in order of master and slave
+	GetLinks(after content.Link, cnt int) ([]content.Link, error)
+	// UpdateRanks - save PageRank of URLs, map[URL.ID]rank
+	UpdateRanks(ranks map[int64]float64) error
+}
+
+// pageRank - calculate PageRank of URLs by links, result is multiplied by count of URLs
+// (average value is 1), rank of URLs without links (dangling) is spread uniformly
+func pageRank(links []content.Link, iterations int) map[int64]float64 {
+	outLinks := make(map[int64][]int64)
+	ranks := make(map[int64]float64)
+	for _, link := range links {
+		if link.Master == link.Slave {
+			continue
+		}
+		outLinks[link.Master] = append(outLinks[link.Master], link.Slave)
+		ranks[link.Master] = 0
+		ranks[link.Slave] = 0
+	}
+	cnt := float64(len(ranks))
+	if cnt == 0 {
+		return ranks
+	}
+
+	for id := range ranks {
+		ranks[id] = 1 / cnt
+	}
+	for i := 0; i < iterations; i++ {
+		dangling := 0.0
+		for id, rank := range ranks {
+			if len(outLinks[id]) == 0 {
+				dangling += rank
+			}
+		}
+		base := (1-pageRankDamping)/cnt + pageRankDamping*dangling/cnt
+		next := make(map[int64]float64, len(ranks))
+		for id := range ranks {
+			next[id] = base
+		}
+		for id, slaves := range outLinks {
+			part := pageRankDamping * ranks[id] / float64(len(slaves))
+			for _, slave := range slaves {
+				next[slave] += part
+			}
+		}
+		ranks = next
+	}
+
+	for id, rank := range ranks {
+		ranks[id] = rank * cnt
+	}
+
+	return ranks
+}
+
+// priorityUpdater - periodic recalculation of URL priorities and PageRank
+type priorityUpdater struct {
+	db                 dbPriority
+	interval           time.Duration
+	pageRankInterval   time.Duration
+	pageRankIterations int
+	lastPageRank       time.Time
+	now                func() time.Time
+}
+
+func newPriorityUpdater(db dbPriority, cfg *Config) *priorityUpdater {
+	return &priorityUpdater{
+		db:                 db,
+		interval:           cfg.PriorityUpdateInterval,
+		pageRankInterval:   cfg.PageRankInterval,
+		pageRankIterations: cfg.PageRankIterations,
+		now:                cfg.now()}
+}
+
+// UpdateRanks - recalculate PageRank of all URLs
+func (u *priorityUpdater) UpdateRanks() error {
+	var links []content.Link
+	after := content.Link{}
+	for {
+		batch, err := u.db.GetLinks(after, linksBatchSize)
+		if err != nil {
+			return err
+		}
+		links = append(links, batch...)
+		if len(batch) < linksBatchSize {
+			break
+		}
+		after = batch[len(batch)-1]
+	}
+
+	return u.db.UpdateRanks(pageRank(links, u.pageRankIterations))
+}
+
+// Update - recalculate priorities of not loaded URLs, PageRank is recalculated if interval expired
+func (u *priorityUpdater) Update(now time.Time) error {
+	if u.pageRankInterval > 0 && now.Sub(u.lastPageRank) >= u.pageRankInterval {
+		err := u.UpdateRanks()
+		if err != nil {
+			return err
+		}
+		u.lastPageRank = now
+	}
+
+	factors, err := u.db.GetPriorityFactors()
+	if err != nil {
+		return err
+	}
+	priorities := make(map[int64]float64, len(factors))
+	for _, f := range factors {
+		priorities[f.ID] = content.PriorityScore(f)
+	}
+
+	return u.db.UpdatePriorities(priorities)
+}
+
+// Start - update priorities immediately and then with interval until stop
+func (u *priorityUpdater) Start(stop <-chan struct{}, wgParent *sync.WaitGroup) {
+	defer wgParent.Done()
+	if u.interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(u.interval)
+	defer ticker.Stop()
+	for {
+		err := u.Update(u.now())
+		if err != nil {
+			log.Printf("ERROR: Update priorities of URLs, message: %s", err)
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package crawler
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/ReanGD/go-web-search/content"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type fakeDbPriority struct {
+	factors    []content.PriorityFactors
+	links      []content.Link
+	priorities map[int64]float64
+	ranks      map[int64]float64
+	rankCalls  int
+}
+
+func (f *fakeDbPriority) GetPriorityFactors() ([]content.PriorityFactors, error) {
+	return f.factors, nil
+}
+
+func (f *fakeDbPriority) UpdatePriorities(priorities map[int64]float64) error {
+	f.priorities = priorities
+	return nil
+}
+
+func (f *fakeDbPriority) GetLinks(after content.Link, cnt int) ([]content.Link, error) {
+	var result []content.Link
+	for _, link := range f.links {
+		if link.Master > after.Master || (link.Master == after.Master && link.Slave > after.Slave) {
+			result = append(result, link)
+		}
+		if len(result) == cnt {
+			break
+		}
+	}
+	return result, nil
+}
+
+func (f *fakeDbPriority) UpdateRanks(ranks map[int64]float64) error {
+	f.rankCalls++
+	f.ranks = ranks
+	return nil
+}
+
+// TestPriorityScore ...
+func TestPriorityScore(t *testing.T) {
+	Convey("More in-links - greater priority", t, func() {
+		low := content.PriorityScore(content.PriorityFactors{InLinks: 1})
+		high := content.PriorityScore(content.PriorityFactors{InLinks: 10})
+		So(high, ShouldBeGreaterThan, low)
+	})
+
+	Convey("Greater depth - less priority", t, func() {
+		low := content.PriorityScore(content.PriorityFactors{Depth: 3})
+		high := content.PriorityScore(content.PriorityFactors{Depth: 1})
+		So(high, ShouldBeGreaterThan, low)
+	})
+
+	Convey("Sitemap priority", t, func() {
+		noHint := content.PriorityScore(content.PriorityFactors{})
+		low := content.PriorityScore(content.PriorityFactors{SitemapPriority: sql.NullFloat64{Float64: 0.1, Valid: true}})
+		high := content.PriorityScore(content.PriorityFactors{SitemapPriority: sql.NullFloat64{Float64: 1, Valid: true}})
+		So(high, ShouldBeGreaterThan, low)
+		So(low, ShouldBeGreaterThan, noHint)
+	})
+
+	Convey("Greater PageRank - greater priority", t, func() {
+		low := content.PriorityScore(content.PriorityFactors{Rank: 0.5})
+		high := content.PriorityScore(content.PriorityFactors{Rank: 3})
+		So(high, ShouldBeGreaterThan, low)
+	})
+}
+
+// TestPageRank ...
+func TestPageRank(t *testing.T) {
+	Convey("Empty links", t, func() {
+		So(pageRank(nil, 20), ShouldBeEmpty)
+	})
+
+	Convey("Cycle has equal ranks", t, func() {
+		ranks := pageRank([]content.Link{{Master: 1, Slave: 2}, {Master: 2, Slave: 3}, {Master: 3, Slave: 1}}, 20)
+		So(len(ranks), ShouldEqual, 3)
+		for _, rank := range ranks {
+			So(rank, ShouldAlmostEqual, 1, 0.0001)
+		}
+	})
+
+	Convey("Page with more in-links has greater rank", t, func() {
+		ranks := pageRank([]content.Link{
+			{Master: 1, Slave: 4}, {Master: 2, Slave: 4}, {Master: 3, Slave: 4},
+			{Master: 4, Slave: 1}, {Master: 1, Slave: 1}}, 20)
+		So(len(ranks), ShouldEqual, 4)
+		So(ranks[4], ShouldBeGreaterThan, ranks[1])
+		So(ranks[1], ShouldBeGreaterThan, ranks[2])
+		sum := 0.0
+		for _, rank := range ranks {
+			sum += rank
+		}
+		So(sum, ShouldAlmostEqual, 4, 0.0001)
+	})
+}
+
+// TestPriorityUpdater ...
+func TestPriorityUpdater(t *testing.T) {
+	Convey("Update priorities and PageRank by interval", t, func() {
+		db := &fakeDbPriority{
+			factors: []content.PriorityFactors{{ID: 1, Depth: 1}, {ID: 2, Depth: 0, InLinks: 2}},
+			links:   []content.Link{{Master: 1, Slave: 2}}}
+		cfg := NewConfig(nil, 0)
+		u := newPriorityUpdater(db, cfg)
+
+		now := time.Now()
+		So(u.Update(now), ShouldBeNil)
+		So(db.rankCalls, ShouldEqual, 1)
+		So(len(db.ranks), ShouldEqual, 2)
+		So(db.priorities[2], ShouldBeGreaterThan, db.priorities[1])
+
+		So(u.Update(now.Add(time.Minute)), ShouldBeNil)
+		So(db.rankCalls, ShouldEqual, 1)
+		So(u.Update(now.Add(cfg.PageRankInterval)), ShouldBeNil)
+		So(db.rankCalls, ShouldEqual, 2)
+	})
+
+	Convey("PageRank is disabled", t, func() {
+		db := &fakeDbPriority{}
+		cfg := NewConfig(nil, 0)
+		cfg.PageRankInterval = 0
+		u := newPriorityUpdater(db, cfg)
+		So(u.Update(time.Now()), ShouldBeNil)
+		So(db.rankCalls, ShouldEqual, 0)
+	})
+}
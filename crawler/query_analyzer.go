@@ -0,0 +1,134 @@
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+
+	"github.com/ReanGD/go-web-search/proxy"
+)
+
+// queryAnalyzerMinSamples - min count of URL groups, where parameter has different values,
+// for proposal of strip rule
+const queryAnalyzerMinSamples = 3
+
+// paramStat - statistics of query parameter
+// samples - count of URL groups (URLs differ only in parameter value) with different values of parameter
+// changes - count of groups, where content hash depends on parameter value
+type paramStat struct {
+	name    string
+	samples int
+	changes int
+}
+
+// paramGroup - URLs that differ only in value of one parameter
+type paramGroup struct {
+	values map[string]struct{}
+	hashes map[string]struct{}
+}
+
+// analyzeQueryParams - find parameters, that never change content hash
+// pages - map[URL]hash of content
+func analyzeQueryParams(pages map[string]string, minSamples int) []*paramStat {
+	// map[parameter]map[URL without parameter]group
+	groups := make(map[string]map[string]*paramGroup)
+	for urlStr, hash := range pages {
+		u, err := url.Parse(urlStr)
+		if err != nil || u.RawQuery == "" {
+			continue
+		}
+		query := u.Query()
+		for name, values := range query {
+			rest := *u
+			restQuery := u.Query()
+			restQuery.Del(name)
+			rest.RawQuery = restQuery.Encode()
+			key := rest.String()
+
+			byKey, ok := groups[name]
+			if !ok {
+				byKey = make(map[string]*paramGroup)
+				groups[name] = byKey
+			}
+			group, ok := byKey[key]
+			if !ok {
+				group = &paramGroup{values: make(map[string]struct{}), hashes: make(map[string]struct{})}
+				byKey[key] = group
+			}
+			group.values[fmt.Sprintf("%q", values)] = struct{}{}
+			group.hashes[hash] = struct{}{}
+		}
+	}
+
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var result []*paramStat
+	for _, name := range names {
+		byKey := groups[name]
+		stat := &paramStat{name: name}
+		for _, group := range byKey {
+			if len(group.values) < 2 {
+				continue
+			}
+			stat.samples++
+			if len(group.hashes) > 1 {
+				stat.changes++
+			}
+		}
+		if stat.samples >= minSamples && stat.changes == 0 {
+			result = append(result, stat)
+		}
+	}
+
+	return result
+}
+
+// WriteQueryParamsReport - write parameters, that never change content of page,
+// as strip rules in format of QueryPolicy
+func WriteQueryParamsReport(db proxy.DbHost, w io.Writer) error {
+	hosts, err := db.GetHosts()
+	if err != nil {
+		return err
+	}
+	ids := make(map[string]int64, len(hosts))
+	hostNames := make([]string, 0, len(hosts))
+	for id, host := range hosts {
+		hostName := DisplayHostName(host.GetName())
+		ids[hostName] = id
+		hostNames = append(hostNames, hostName)
+	}
+	sort.Strings(hostNames)
+
+	for _, hostName := range hostNames {
+		pages, err := db.GetContentHashes(ids[hostName])
+		if err != nil {
+			return err
+		}
+		stats := analyzeQueryParams(pages, queryAnalyzerMinSamples)
+		if len(stats) == 0 {
+			continue
+		}
+
+		_, err = fmt.Fprintf(w, "%q: &crawler.QueryPolicy{Mode: crawler.QueryStrip, Params: []string{\n", hostName)
+		if err != nil {
+			return err
+		}
+		for _, stat := range stats {
+			_, err = fmt.Fprintf(w, "\t%q, // samples: %d\n", stat.name, stat.samples)
+			if err != nil {
+				return err
+			}
+		}
+		_, err = fmt.Fprintln(w, "}},")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
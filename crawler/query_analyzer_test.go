@@ -0,0 +1,145 @@
+package crawler
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/ReanGD/go-web-search/proxy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakeDbQueryHosts - several hosts with hashes of content, map[hostID]map[URL]hash
+type fakeDbQueryHosts struct {
+	*fakeDbHost
+	hosts     map[int64]*proxy.Host
+	hostPages map[int64]map[string]string
+	hashesErr string
+}
+
+func (f *fakeDbQueryHosts) GetHosts() (map[int64]*proxy.Host, error) {
+	return f.hosts, nil
+}
+
+func (f *fakeDbQueryHosts) GetContentHashes(hostID int64) (map[string]string, error) {
+	if f.hashesErr != "" {
+		return nil, errors.New(f.hashesErr)
+	}
+
+	return f.hostPages[hostID], nil
+}
+
+// TestQueryAnalyzer ...
+func TestQueryAnalyzer(t *testing.T) {
+	pages := map[string]string{
+		"http://s/a?id=1&ref=x": "h1",
+		"http://s/a?id=1&ref=y": "h1",
+		"http://s/a?id=2&ref=x": "h2",
+		"http://s/a?id=2&ref=z": "h2",
+		"http://s/b?ref=x":      "h3",
+		"http://s/b?ref=y":      "h3",
+		"http://s/c?ref=x":      "h4",
+		"http://s/c":            "h4",
+	}
+
+	Convey("Parameters without influence on content", t, func() {
+		stats := analyzeQueryParams(pages, 3)
+		So(len(stats), ShouldEqual, 1)
+		So(stats[0].name, ShouldEqual, "ref")
+		So(stats[0].samples, ShouldEqual, 3)
+	})
+
+	Convey("Not enough samples", t, func() {
+		So(len(analyzeQueryParams(pages, 4)), ShouldEqual, 0)
+	})
+
+	Convey("Parameter changes content", t, func() {
+		changed := map[string]string{"http://s/d?ref=x": "h5", "http://s/d?ref=y": "h6"}
+		for urlStr, hash := range pages {
+			changed[urlStr] = hash
+		}
+		So(len(analyzeQueryParams(changed, 3)), ShouldEqual, 0)
+	})
+
+	Convey("Parameters are sorted by name", t, func() {
+		sorted := map[string]string{
+			"http://s/a?utm=1&sid=1": "h1",
+			"http://s/a?utm=2&sid=1": "h1",
+			"http://s/a?utm=1&sid=2": "h1",
+		}
+		stats := analyzeQueryParams(sorted, 1)
+		So(len(stats), ShouldEqual, 2)
+		So(stats[0].name, ShouldEqual, "sid")
+		So(stats[0].samples, ShouldEqual, 1)
+		So(stats[1].name, ShouldEqual, "utm")
+		So(stats[1].samples, ShouldEqual, 1)
+	})
+
+	Convey("Repeated parameter is compared by all values", t, func() {
+		repeated := map[string]string{
+			"http://s/a?tag=x&tag=y": "h1",
+			"http://s/a?tag=y&tag=x": "h1",
+			"http://s/a?tag=x":       "h1",
+		}
+		stats := analyzeQueryParams(repeated, 1)
+		So(len(stats), ShouldEqual, 1)
+		So(stats[0].samples, ShouldEqual, 1)
+	})
+
+	Convey("URLs without query and invalid URLs are skipped", t, func() {
+		invalid := map[string]string{
+			"http://s/a":        "h1",
+			"http://s/b":        "h2",
+			"http://s/%zz?ref=": "h3",
+		}
+		So(len(analyzeQueryParams(invalid, 1)), ShouldEqual, 0)
+	})
+
+	Convey("Report in format of query policy", t, func() {
+		db := &fakeDbHost{robotTxtData: "User-agent: *", hashes: pages}
+		buf := &bytes.Buffer{}
+		So(WriteQueryParamsReport(db, buf), ShouldBeNil)
+		expected := `"hostName": &crawler.QueryPolicy{Mode: crawler.QueryStrip, Params: []string{
+	"ref", // samples: 3
+}},
+`
+		So(buf.String(), ShouldEqual, expected)
+	})
+
+	Convey("Report is sorted by display name of host, hosts without rules are skipped", t, func() {
+		db := &fakeDbQueryHosts{
+			fakeDbHost: &fakeDbHost{},
+			hosts: map[int64]*proxy.Host{
+				1: proxy.NewHost("xn--e1afmkfd.xn--p1ai", 200, []byte{}),
+				2: proxy.NewHost("a", 200, []byte{}),
+				3: proxy.NewHost("m", 200, []byte{})},
+			hostPages: map[int64]map[string]string{
+				1: pages,
+				2: pages,
+				3: {"http://m/a?ref=x": "h1", "http://m/a?ref=y": "h2"}}}
+		buf := &bytes.Buffer{}
+		So(WriteQueryParamsReport(db, buf), ShouldBeNil)
+		expected := `"a": &crawler.QueryPolicy{Mode: crawler.QueryStrip, Params: []string{
+	"ref", // samples: 3
+}},
+"пример.рф": &crawler.QueryPolicy{Mode: crawler.QueryStrip, Params: []string{
+	"ref", // samples: 3
+}},
+`
+		So(buf.String(), ShouldEqual, expected)
+	})
+
+	Convey("Report errors", t, func() {
+		db := &fakeDbHost{robotTxtData: "User-agent: *", getHostErr: "get hosts"}
+		So(WriteQueryParamsReport(db, &bytes.Buffer{}).Error(), ShouldEqual, "get hosts")
+
+		hashesErr := &fakeDbQueryHosts{
+			fakeDbHost: &fakeDbHost{},
+			hosts:      map[int64]*proxy.Host{1: proxy.NewHost("s", 200, []byte{})},
+			hashesErr:  "get hashes"}
+		So(WriteQueryParamsReport(hashesErr, &bytes.Buffer{}).Error(), ShouldEqual, "get hashes")
+
+		db = &fakeDbHost{robotTxtData: "User-agent: *", hashes: pages}
+		So(WriteQueryParamsReport(db, ioTestWriterErr{}).Error(), ShouldEqual, "write error")
+	})
+}
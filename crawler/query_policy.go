@@ -0,0 +1,104 @@
+package crawler
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/opennota/urlesc"
+)
+
+// QueryMode - processing of query parameters in NormalizeURL
+type QueryMode uint8
+
+const (
+	// QueryStrip - remove Params and default tracking parameters, keep others
+	QueryStrip QueryMode = 0
+	// QueryKeep - keep only Params, remove others
+	QueryKeep QueryMode = 1
+	// QuerySortOnly - keep all parameters, only sort them
+	QuerySortOnly QueryMode = 2
+)
+
+// defaultStripParams - tracking and session parameters, that are removed for all hosts in QueryStrip mode
+var defaultStripParams = []string{
+	"utm_source", "utm_medium", "utm_term", "utm_content", "utm_campaign",
+	"fbclid", "gclid", "yclid", "msclkid",
+	"sid", "phpsessid", "jsessionid", "sessionid"}
+
+// QueryPolicy - query parameters policy of host, parameter names are case insensitive
+type QueryPolicy struct {
+	Mode   QueryMode
+	Params []string
+}
+
+type queryPolicy struct {
+	mode   QueryMode
+	params map[string]struct{}
+}
+
+func newQueryPolicy(cfg *QueryPolicy) *queryPolicy {
+	result := &queryPolicy{mode: cfg.Mode, params: make(map[string]struct{})}
+	if cfg.Mode == QueryStrip {
+		for _, param := range defaultStripParams {
+			result.params[param] = struct{}{}
+		}
+	}
+	for _, param := range cfg.Params {
+		result.params[strings.ToLower(param)] = struct{}{}
+	}
+
+	return result
+}
+
+// Keep - check that parameter is kept in URL
+func (p *queryPolicy) Keep(param string) bool {
+	_, listed := p.params[strings.ToLower(param)]
+	switch p.mode {
+	case QueryKeep:
+		return listed
+	case QuerySortOnly:
+		return true
+	default:
+		return !listed
+	}
+}
+
+// defaultQueryPolicy - policy of hosts without own policy
+var defaultQueryPolicy = newQueryPolicy(&QueryPolicy{Mode: QueryStrip})
+
+// newQueryPolicies - get map[hostName]query parameters policy by cfg (map[hostName]policy)
+func newQueryPolicies(cfg map[string]*QueryPolicy) map[string]*queryPolicy {
+	result := make(map[string]*queryPolicy, len(cfg))
+	for hostName, policy := range cfg {
+		result[NormalizeHostName(hostName)] = newQueryPolicy(policy)
+	}
+
+	return result
+}
+
+// filterQuery - remove query parameters by policy
+func filterQuery(u *url.URL, policy *queryPolicy) {
+	if policy.mode == QuerySortOnly {
+		return
+	}
+
+	q := u.Query()
+	if len(q) > 0 {
+		buf := new(bytes.Buffer)
+		for key, value := range q {
+			if policy.Keep(key) {
+				for _, v := range value {
+					if buf.Len() > 0 {
+						_, _ = buf.WriteRune('&')
+					}
+					_, _ = buf.WriteString(fmt.Sprintf("%s=%s", key, urlesc.QueryEscape(v)))
+				}
+			}
+		}
+
+		// Rebuild the raw query string
+		u.RawQuery = buf.String()
+	}
+}
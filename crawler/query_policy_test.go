@@ -0,0 +1,40 @@
+package crawler
+
+import (
+	"net/url"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func helperNormalizeURLByPolicy(policies map[string]*QueryPolicy, in string, out string) {
+	m := &hostsManager{queries: newQueryPolicies(policies)}
+	u, err := url.Parse(in)
+	So(err, ShouldBeNil)
+	So(m.NormalizeURL(u), ShouldEqual, out)
+}
+
+// TestQueryPolicy ...
+func TestQueryPolicy(t *testing.T) {
+	Convey("Default tracking and session parameters", t, func() {
+		helperNormalizeURL("http://s/?fbclid=1&id=2&GCLID=3", "http://s/?id=2")
+		helperNormalizeURL("http://s/?PHPSESSID=abc&page=2&sid=1", "http://s/?page=2")
+	})
+
+	Convey("Strip mode", t, func() {
+		policies := map[string]*QueryPolicy{"www.s": &QueryPolicy{Mode: QueryStrip, Params: []string{"Ref"}}}
+		helperNormalizeURLByPolicy(policies, "http://s/?ref=1&id=2&utm_source=3", "http://s/?id=2")
+		helperNormalizeURLByPolicy(policies, "http://other/?ref=1", "http://other/?ref=1")
+		helperNormalizeURL("http://s/?ref=1", "http://s/?ref=1")
+	})
+
+	Convey("Keep mode", t, func() {
+		policies := map[string]*QueryPolicy{"s": &QueryPolicy{Mode: QueryKeep, Params: []string{"id"}}}
+		helperNormalizeURLByPolicy(policies, "http://s/?ref=1&id=2&sort=asc", "http://s/?id=2")
+	})
+
+	Convey("Sort only mode", t, func() {
+		policies := map[string]*QueryPolicy{"s": &QueryPolicy{Mode: QuerySortOnly}}
+		helperNormalizeURLByPolicy(policies, "http://s/?utm_source=1&b=2&a=3", "http://s/?a=3&b=2&utm_source=1")
+	})
+}
@@ -0,0 +1,85 @@
+package crawler
+
+import (
+	"time"
+
+	"github.com/ReanGD/go-web-search/content"
+	"github.com/ReanGD/go-web-search/database"
+	"github.com/ReanGD/go-web-search/proxy"
+)
+
+// recrawlScheduler - plan next download of page by estimated change interval
+// first interval is taken from sitemap <changefreq> hint if it exists
+// interval is halved when content changed and grows by half when not changed,
+// interval is doubled when recrawl failed, so page is not lost after temporary error
+type recrawlScheduler struct {
+	initInterval time.Duration
+	minInterval  time.Duration
+	maxInterval  time.Duration
+	now          func() time.Time
+}
+
+// changeFreqIntervals - recrawl intervals for <changefreq> values from sitemap
+var changeFreqIntervals = map[string]time.Duration{
+	"always":  0,
+	"hourly":  time.Hour,
+	"daily":   24 * time.Hour,
+	"weekly":  7 * 24 * time.Hour,
+	"monthly": 30 * 24 * time.Hour,
+	"yearly":  365 * 24 * time.Hour,
+	"never":   100 * 365 * 24 * time.Hour,
+}
+
+func newRecrawlScheduler(cfg *Config) *recrawlScheduler {
+	return &recrawlScheduler{
+		initInterval: cfg.RecrawlInitInterval,
+		minInterval:  cfg.RecrawlMinInterval,
+		maxInterval:  cfg.RecrawlMaxInterval,
+		now:          cfg.now()}
+}
+
+// clamp - limit interval by min and max intervals
+func (s *recrawlScheduler) clamp(interval time.Duration) time.Duration {
+	if interval < s.minInterval {
+		interval = s.minInterval
+	}
+	if interval > s.maxInterval {
+		interval = s.maxInterval
+	}
+
+	return interval
+}
+
+// Schedule - set fetch time and next recrawl time for successfully loaded page or for failed recrawl
+func (s *recrawlScheduler) Schedule(meta *proxy.Meta, task *content.Task) {
+	if meta.GetState() != database.StateSuccess {
+		if meta.IsRecrawl() {
+			prev := time.Duration(task.RecrawlInterval) * time.Second
+			if prev <= 0 {
+				prev = s.initInterval
+			}
+			meta.SetSchedule(s.now(), false, s.clamp(prev*2))
+		}
+		return
+	}
+
+	changed := true
+	interval := s.initInterval
+	if hint, ok := changeFreqIntervals[task.ChangeFreq]; ok {
+		interval = hint
+	}
+	if meta.IsRecrawl() {
+		prev := time.Duration(task.RecrawlInterval) * time.Second
+		if prev <= 0 {
+			prev = interval
+		}
+		changed = !meta.IsNotModified() && meta.GetHash() != task.Hash
+		if changed {
+			interval = prev / 2
+		} else {
+			interval = prev * 3 / 2
+		}
+	}
+
+	meta.SetSchedule(s.now(), changed, s.clamp(interval))
+}
@@ -0,0 +1,133 @@
+package crawler
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/ReanGD/go-web-search/content"
+	"github.com/ReanGD/go-web-search/database"
+	"github.com/ReanGD/go-web-search/proxy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func helperNewRecrawlScheduler() (*recrawlScheduler, time.Time) {
+	cfg := NewConfig([]string{}, 0)
+	cfg.RecrawlInitInterval = 8 * time.Hour
+	cfg.RecrawlMinInterval = 3 * time.Hour
+	cfg.RecrawlMaxInterval = 20 * time.Hour
+	s := newRecrawlScheduler(cfg)
+	now := time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	return s, now
+}
+
+func helperRecrawlMeta(recrawl bool, body string) *proxy.Meta {
+	meta := proxy.NewMeta(sql.NullInt64{Int64: 1, Valid: true}, "http://host/", nil)
+	if recrawl {
+		meta.SetRecrawl()
+	}
+	meta.SetContent(proxy.NewContent([]byte(body), "title"))
+
+	return meta
+}
+
+// TestRecrawlSchedule ...
+func TestRecrawlSchedule(t *testing.T) {
+	Convey("First download", t, func() {
+		s, now := helperNewRecrawlScheduler()
+		meta := helperRecrawlMeta(false, "body")
+		s.Schedule(meta, &content.Task{})
+
+		dbMeta := meta.GetMeta(1)
+		So(*dbMeta.FetchedAt, ShouldResemble, now)
+		So(*dbMeta.ChangedAt, ShouldResemble, now)
+		So(*dbMeta.NextFetchAt, ShouldResemble, now.Add(8*time.Hour))
+		So(dbMeta.RecrawlInterval, ShouldEqual, 8*3600)
+	})
+
+	Convey("Content changed", t, func() {
+		s, now := helperNewRecrawlScheduler()
+		meta := helperRecrawlMeta(true, "new body")
+		old := helperRecrawlMeta(true, "old body")
+		task := &content.Task{Loaded: true, RecrawlInterval: 8 * 3600, Hash: old.GetHash()}
+		s.Schedule(meta, task)
+
+		dbMeta := meta.GetMeta(1)
+		So(*dbMeta.ChangedAt, ShouldResemble, now)
+		So(*dbMeta.NextFetchAt, ShouldResemble, now.Add(4*time.Hour))
+
+		task.RecrawlInterval = 4 * 3600
+		s.Schedule(meta, task)
+		So(*meta.GetMeta(1).NextFetchAt, ShouldResemble, now.Add(3*time.Hour))
+	})
+
+	Convey("Content not changed", t, func() {
+		s, now := helperNewRecrawlScheduler()
+		meta := helperRecrawlMeta(true, "body")
+		task := &content.Task{Loaded: true, RecrawlInterval: 8 * 3600, Hash: meta.GetHash()}
+		s.Schedule(meta, task)
+
+		dbMeta := meta.GetMeta(1)
+		So(dbMeta.ChangedAt, ShouldBeNil)
+		So(*dbMeta.NextFetchAt, ShouldResemble, now.Add(12*time.Hour))
+
+		task.RecrawlInterval = 16 * 3600
+		s.Schedule(meta, task)
+		So(*meta.GetMeta(1).NextFetchAt, ShouldResemble, now.Add(20*time.Hour))
+	})
+
+	Convey("Not modified", t, func() {
+		s, now := helperNewRecrawlScheduler()
+		meta := proxy.NewMeta(sql.NullInt64{Int64: 1, Valid: true}, "http://host/", nil)
+		meta.SetRecrawl()
+		meta.SetNotModified()
+		task := &content.Task{Loaded: true, RecrawlInterval: 8 * 3600, Hash: "hash"}
+		s.Schedule(meta, task)
+
+		fields := meta.GetScheduleFields()
+		So(fields["next_fetch_at"], ShouldResemble, func() *time.Time { v := now.Add(12 * time.Hour); return &v }())
+		_, changed := fields["changed_at"]
+		So(changed, ShouldBeFalse)
+	})
+
+	Convey("Page with error is not scheduled", t, func() {
+		s, _ := helperNewRecrawlScheduler()
+		meta := helperRecrawlMeta(false, "body")
+		meta.SetState(database.StateErrorStatusCode)
+		s.Schedule(meta, &content.Task{})
+		So(meta.GetMeta(1).NextFetchAt, ShouldBeNil)
+	})
+
+	Convey("Failed recrawl is backed off", t, func() {
+		s, now := helperNewRecrawlScheduler()
+		meta := helperRecrawlMeta(true, "body")
+		meta.SetState(database.StateConnectError)
+		s.Schedule(meta, &content.Task{Loaded: true, RecrawlInterval: 4 * 3600})
+
+		fields := meta.GetUpdateFields()
+		So(fields["next_fetch_at"], ShouldResemble, func() *time.Time { v := now.Add(8 * time.Hour); return &v }())
+		_, changed := fields["changed_at"]
+		So(changed, ShouldBeFalse)
+
+		s.Schedule(meta, &content.Task{Loaded: true, RecrawlInterval: 16 * 3600})
+		So(*meta.GetMeta(1).NextFetchAt, ShouldResemble, now.Add(20*time.Hour))
+	})
+}
+
+// TestRecrawlScheduleChangeFreq ...
+func TestRecrawlScheduleChangeFreq(t *testing.T) {
+	Convey("First download with sitemap hint", t, func() {
+		s, now := helperNewRecrawlScheduler()
+		meta := helperRecrawlMeta(false, "body")
+		s.Schedule(meta, &content.Task{ChangeFreq: "hourly"})
+		So(*meta.GetMeta(1).NextFetchAt, ShouldResemble, now.Add(3*time.Hour))
+
+		s.Schedule(meta, &content.Task{ChangeFreq: "never"})
+		So(*meta.GetMeta(1).NextFetchAt, ShouldResemble, now.Add(20*time.Hour))
+
+		s.Schedule(meta, &content.Task{ChangeFreq: "unknown"})
+		So(*meta.GetMeta(1).NextFetchAt, ShouldResemble, now.Add(8*time.Hour))
+	})
+}
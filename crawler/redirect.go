@@ -0,0 +1,103 @@
+package crawler
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ReanGD/go-web-search/database"
+	"github.com/ReanGD/go-web-search/proxy"
+)
+
+// maxRedirects - max count of redirects in chain
+const maxRedirects = 10
+
+var (
+	// errRedirectLoop - redirect to URL from current redirect chain
+	errRedirectLoop = errors.New("redirect loop")
+	// errTooManyRedirects - redirect chain is longer than maxRedirects
+	errTooManyRedirects = errors.New("stopped after 10 redirects")
+)
+
+// redirectState - get state for redirect error returned by http.Client.Do
+// returns false if err is not redirect error
+func redirectState(err error) (database.State, bool) {
+	if uerr, ok := err.(*url.Error); ok {
+		err = uerr.Err
+	}
+	switch err {
+	case errRedirectLoop:
+		return database.StateRedirectLoop, true
+	case errTooManyRedirects:
+		return database.StateTooManyRedirects, true
+	default:
+		return database.StateSuccess, false
+	}
+}
+
+// redirectHop - get position of URL in redirect chain (0 - requested URL)
+func redirectHop(meta *proxy.Meta) int {
+	hop := 0
+	for it := meta.GetReferer(); it != nil; it = it.GetReferer() {
+		hop++
+	}
+
+	return hop
+}
+
+// isRedirectLoop - check that URL is found in redirect chain
+func isRedirectLoop(urlStr string, meta *proxy.Meta) bool {
+	for it := meta; it != nil; it = it.GetReferer() {
+		if it.GetURL() == urlStr {
+			return true
+		}
+	}
+
+	return false
+}
+
+// redirectResponse - get status code and Location header of response, that caused redirect request
+func redirectResponse(req *http.Request) (int, string) {
+	if req.Response == nil {
+		return http.StatusFound, req.URL.String()
+	}
+
+	return req.Response.StatusCode, req.Response.Header.Get("Location")
+}
+
+// metaRefresh - redirect by <meta http-equiv="refresh">
+type metaRefresh struct {
+	urlStr string
+	delay  time.Duration
+}
+
+// parseRefreshContent - parse attribute content of <meta http-equiv="refresh">: "delay; url=URL"
+// returns false if content without URL (reload of page)
+func parseRefreshContent(content string) (time.Duration, string, bool) {
+	content = strings.TrimSpace(content)
+	delayStr, link := content, ""
+	if pos := strings.IndexAny(content, ";,"); pos >= 0 {
+		delayStr, link = content[:pos], content[pos+1:]
+	}
+	seconds, err := strconv.ParseFloat(strings.TrimSpace(delayStr), 64)
+	if err != nil || seconds < 0 {
+		return 0, "", false
+	}
+
+	link = strings.TrimSpace(link)
+	if len(link) >= 3 && strings.EqualFold(link[:3], "url") {
+		value := strings.TrimSpace(link[3:])
+		if strings.HasPrefix(value, "=") {
+			link = strings.TrimSpace(value[1:])
+		}
+	}
+	link = strings.TrimSpace(strings.Trim(link, `'"`))
+	if link == "" {
+		return 0, "", false
+	}
+
+	return time.Duration(seconds * float64(time.Second)), link, true
+}
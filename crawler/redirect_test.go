@@ -0,0 +1,361 @@
+package crawler
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ReanGD/go-web-search/content"
+	"github.com/ReanGD/go-web-search/database"
+	"github.com/ReanGD/go-web-search/proxy"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/temoto/robotstxt-go"
+	"github.com/uber-go/zap"
+)
+
+func helperRedirectRequest(urlStr string) *request {
+	buf := &bytes.Buffer{}
+	r := &request{hostMng: &hostsManager{}}
+	r.Init(zap.NewJSON(zap.DebugLevel, zap.Output(zap.AddSync(buf))), nil, nil)
+	r.meta = proxy.NewMeta(sql.NullInt64{Valid: false}, urlStr, nil)
+
+	return r
+}
+
+// closeTracker - transport, that counts response bodies and their closes
+type closeTracker struct {
+	opened int
+	closed int
+}
+
+type closeTrackerBody struct {
+	io.ReadCloser
+	tracker *closeTracker
+}
+
+func (b *closeTrackerBody) Close() error {
+	b.tracker.closed++
+	return b.ReadCloser.Close()
+}
+
+func (t *closeTracker) RoundTrip(req *http.Request) (*http.Response, error) {
+	response, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		return response, err
+	}
+	t.opened++
+	response.Body = &closeTrackerBody{ReadCloser: response.Body, tracker: t}
+
+	return response, nil
+}
+
+func helperRedirectServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/permanent", http.RedirectHandler("/temporary", http.StatusMovedPermanently))
+	mux.Handle("/temporary", http.RedirectHandler("/see-other", http.StatusFound))
+	mux.Handle("/see-other", http.RedirectHandler("/page", http.StatusSeeOther))
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("page"))
+	})
+	mux.Handle("/redirect-validators", http.RedirectHandler("/validators", http.StatusMovedPermanently))
+	mux.Handle("/loop1", http.RedirectHandler("/loop2", http.StatusTemporaryRedirect))
+	mux.Handle("/loop2", http.RedirectHandler("/loop1", http.StatusPermanentRedirect))
+	mux.HandleFunc("/validators", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "%s|%s", r.Header.Get("If-None-Match"), r.Header.Get("If-Modified-Since"))
+	})
+	mux.HandleFunc("/chain/", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, r.URL.Path+"x", http.StatusFound)
+	})
+
+	return httptest.NewServer(mux)
+}
+
+// TestRedirectChain ...
+func TestRedirectChain(t *testing.T) {
+	ts := helperRedirectServer()
+	defer ts.Close()
+
+	Convey("Real status codes and order of hops", t, func() {
+		r := helperRedirectRequest(ts.URL + "/permanent")
+		response, err := r.client.Get(ts.URL + "/permanent")
+		So(err, ShouldBeNil)
+		So(response.Body.Close(), ShouldBeNil)
+
+		hop := r.meta
+		So(hop.IsRedirect(), ShouldBeFalse)
+		So(hop.GetURL(), ShouldEqual, ts.URL+"/page")
+		expected := []struct {
+			path       string
+			statusCode int
+			location   string
+			state      database.State
+			permanent  bool
+		}{
+			{"/see-other", 303, "/page", database.StateRedirect, false},
+			{"/temporary", 302, "/see-other", database.StateRedirect, false},
+			{"/permanent", 301, "/temporary", database.StateDublicate, true},
+		}
+		for i, item := range expected {
+			hop = hop.GetReferer()
+			So(hop, ShouldNotBeNil)
+			So(hop.GetURL(), ShouldEqual, ts.URL+item.path)
+			So(hop.GetState(), ShouldEqual, item.state)
+			So(hop.GetStatusCode().Int64, ShouldEqual, item.statusCode)
+			So(hop.IsPermanentRedirect(), ShouldEqual, item.permanent)
+			redirect := hop.GetRedirect(1, sql.NullInt64{Int64: 2, Valid: true})
+			So(redirect.Location, ShouldEqual, item.location)
+			So(redirect.Hop, ShouldEqual, len(expected)-1-i)
+		}
+		So(hop.GetReferer(), ShouldBeNil)
+	})
+
+	Convey("Redirect loop", t, func() {
+		r := helperRedirectRequest(ts.URL + "/loop1")
+		_, err := r.client.Get(ts.URL + "/loop1")
+		So(err, ShouldNotBeNil)
+		state, ok := redirectState(err)
+		So(ok, ShouldBeTrue)
+		So(state, ShouldEqual, database.StateRedirectLoop)
+
+		So(r.meta.GetURL(), ShouldEqual, ts.URL+"/loop2")
+		So(r.meta.GetState(), ShouldEqual, database.StateRedirectLoop)
+		So(r.meta.GetStatusCode().Int64, ShouldEqual, 308)
+		So(r.meta.GetReferer().GetState(), ShouldEqual, database.StateRedirect)
+		So(r.meta.GetReferer().GetStatusCode().Int64, ShouldEqual, 307)
+	})
+
+	Convey("Too many redirects", t, func() {
+		r := helperRedirectRequest(ts.URL + "/chain/")
+		_, err := r.client.Get(ts.URL + "/chain/")
+		So(err, ShouldNotBeNil)
+		state, ok := redirectState(err)
+		So(ok, ShouldBeTrue)
+		So(state, ShouldEqual, database.StateTooManyRedirects)
+		So(r.meta.GetState(), ShouldEqual, database.StateTooManyRedirects)
+
+		cnt := 0
+		for hop := r.meta; hop != nil; hop = hop.GetReferer() {
+			cnt++
+		}
+		So(cnt, ShouldEqual, maxRedirects)
+	})
+
+	Convey("Validators of recrawl are not sent to target of redirect", t, func() {
+		r := helperRedirectRequest(ts.URL + "/moved")
+		request, err := http.NewRequest("GET", ts.URL+"/redirect-validators", nil)
+		So(err, ShouldBeNil)
+		request.Header.Set("If-None-Match", `"etag"`)
+		request.Header.Set("If-Modified-Since", "Sat, 01 Oct 2016 12:00:00 GMT")
+		request.Header.Set("Accept", "text/html")
+		response, err := r.client.Do(request)
+		So(err, ShouldBeNil)
+		body, err := ioutil.ReadAll(response.Body)
+		So(err, ShouldBeNil)
+		So(response.Body.Close(), ShouldBeNil)
+		So(string(body), ShouldEqual, "|")
+		So(response.Request.Header.Get("Accept"), ShouldEqual, "text/html")
+	})
+
+	Convey("Body of response to external host is closed", t, func() {
+		external := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("external"))
+		}))
+		defer external.Close()
+		source := httptest.NewServer(http.RedirectHandler(external.URL+"/", http.StatusFound))
+		defer source.Close()
+
+		r := helperRefreshRequest(source)
+		tracker := &closeTracker{}
+		r.Init(zap.NewJSON(zap.DebugLevel, zap.Output(zap.AddSync(&bytes.Buffer{}))), tracker, nil)
+		u, err := url.Parse(source.URL + "/")
+		So(err, ShouldBeNil)
+		_, err = r.get(u, &content.Task{})
+		So(err, ShouldBeNil)
+
+		So(r.meta.GetState(), ShouldEqual, database.StateExternal)
+		So(tracker.opened, ShouldEqual, 2)
+		So(tracker.closed, ShouldEqual, 2)
+	})
+
+	Convey("Not redirect error", t, func() {
+		_, ok := redirectState(errRedirectLoop)
+		So(ok, ShouldBeTrue)
+		_, ok = redirectState(nil)
+		So(ok, ShouldBeFalse)
+	})
+}
+
+// TestParseRefreshContent ...
+func TestParseRefreshContent(t *testing.T) {
+	Convey("Refresh with URL", t, func() {
+		values := map[string]string{
+			"0;url=/page":              "/page",
+			" 0 ; URL = '/page' ":      "/page",
+			`0, url="http://host/a"`:   "http://host/a",
+			"0; /page":                 "/page",
+			"0; urlpage.html":          "urlpage.html",
+			"0;url=http://host/?a=b;c": "http://host/?a=b;c",
+		}
+		for content, expected := range values {
+			delay, link, ok := parseRefreshContent(content)
+			So(ok, ShouldBeTrue)
+			So(delay, ShouldEqual, 0)
+			So(link, ShouldEqual, expected)
+		}
+
+		delay, link, ok := parseRefreshContent("2.5; url=/page")
+		So(ok, ShouldBeTrue)
+		So(delay, ShouldEqual, 2500*time.Millisecond)
+		So(link, ShouldEqual, "/page")
+	})
+
+	Convey("Refresh without URL", t, func() {
+		for _, content := range []string{"5", "5;", "5; url=", "-1; url=/page", "a; url=/page", ""} {
+			_, _, ok := parseRefreshContent(content)
+			So(ok, ShouldBeFalse)
+		}
+	})
+}
+
+func helperRefreshPage(delay int, target string) string {
+	return fmt.Sprintf(`<html><head><meta http-equiv="Refresh" content="%d; url=%s"></head>
+<body><a href="/link">link</a></body></html>`, delay, target)
+}
+
+func helperRefreshRequest(ts *httptest.Server) *request {
+	u, err := url.Parse(ts.URL)
+	So(err, ShouldBeNil)
+	robot, err := robotstxt.FromStatusAndBytes(404, nil)
+	So(err, ShouldBeNil)
+	hostMng := &hostsManager{
+		hosts:     map[string]int64{NormalizeHostName(u.Host): 1},
+		robotsTxt: map[int64]*robotstxt.Group{1: robot.FindGroup("GoWebSearch")}}
+
+	cfg := NewConfig([]string{}, 0)
+	buf := &bytes.Buffer{}
+	r := &request{
+		hostMng:         hostMng,
+		politeness:      newPoliteness(hostMng, 1, cfg),
+		refreshMaxDelay: cfg.MetaRefreshMaxDelay}
+	r.Init(zap.NewJSON(zap.DebugLevel, zap.Output(zap.AddSync(buf))), nil, nil)
+
+	return r
+}
+
+// TestMetaRefresh ...
+func TestMetaRefresh(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/instant", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(helperRefreshPage(0, "/temporary")))
+	})
+	mux.HandleFunc("/temporary", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(helperRefreshPage(3, "/redirect")))
+	})
+	mux.Handle("/redirect", http.RedirectHandler("/page", http.StatusFound))
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<html><head><title>page</title></head><body>text</body></html>"))
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(helperRefreshPage(60, "/page")))
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.RawQuery != "" {
+			http.Redirect(w, r, "/loop", http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(helperRefreshPage(0, "/loop?a=1")))
+	})
+	mux.HandleFunc("/external", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(helperRefreshPage(0, "http://external/")))
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	Convey("Short delay refresh joins redirect chain", t, func() {
+		r := helperRefreshRequest(ts)
+		u, err := url.Parse(ts.URL + "/instant")
+		So(err, ShouldBeNil)
+		_, err = r.get(u, &content.Task{})
+		So(err, ShouldBeNil)
+
+		So(r.meta.GetURL(), ShouldEqual, ts.URL+"/page")
+		So(r.meta.GetState(), ShouldEqual, database.StateSuccess)
+		hop := r.meta.GetReferer()
+		So(hop.GetURL(), ShouldEqual, ts.URL+"/redirect")
+		So(hop.GetRedirect(1, sql.NullInt64{}).Hop, ShouldEqual, 2)
+		So(hop.GetRedirect(1, sql.NullInt64{}).MetaRefresh, ShouldBeFalse)
+
+		hop = hop.GetReferer()
+		So(hop.GetURL(), ShouldEqual, ts.URL+"/temporary")
+		So(hop.GetState(), ShouldEqual, database.StateRedirect)
+		So(hop.GetContent(), ShouldBeNil)
+		redirect := hop.GetRedirect(1, sql.NullInt64{})
+		So(redirect.MetaRefresh, ShouldBeTrue)
+		So(redirect.StatusCode, ShouldEqual, 200)
+		So(redirect.Location, ShouldEqual, ts.URL+"/redirect")
+		So(redirect.Hop, ShouldEqual, 1)
+
+		hop = hop.GetReferer()
+		So(hop.GetURL(), ShouldEqual, ts.URL+"/instant")
+		So(hop.GetState(), ShouldEqual, database.StateDublicate)
+		So(hop.IsPermanentRedirect(), ShouldBeTrue)
+		So(hop.GetRedirect(1, sql.NullInt64{}).Hop, ShouldEqual, 0)
+		So(hop.GetReferer(), ShouldBeNil)
+
+		So(r.urls, ShouldContainKey, ts.URL+"/link")
+		So(r.urls, ShouldNotContainKey, ts.URL+"/temporary")
+		So(r.urls, ShouldNotContainKey, ts.URL+"/redirect")
+	})
+
+	Convey("Long delay refresh is plain link", t, func() {
+		r := helperRefreshRequest(ts)
+		u, err := url.Parse(ts.URL + "/slow")
+		So(err, ShouldBeNil)
+		_, err = r.get(u, &content.Task{})
+		So(err, ShouldBeNil)
+
+		So(r.meta.GetURL(), ShouldEqual, ts.URL+"/slow")
+		So(r.meta.GetState(), ShouldEqual, database.StateSuccess)
+		So(r.meta.IsRedirect(), ShouldBeFalse)
+		So(r.meta.GetReferer(), ShouldBeNil)
+		So(r.urls, ShouldContainKey, ts.URL+"/page")
+	})
+
+	Convey("Refresh loop", t, func() {
+		r := helperRefreshRequest(ts)
+		u, err := url.Parse(ts.URL + "/loop")
+		So(err, ShouldBeNil)
+		_, err = r.get(u, &content.Task{})
+		So(err, ShouldNotBeNil)
+		state, ok := redirectState(err)
+		So(ok, ShouldBeTrue)
+		So(state, ShouldEqual, database.StateRedirectLoop)
+		So(r.meta.GetURL(), ShouldEqual, ts.URL+"/loop?a=1")
+		So(r.meta.GetState(), ShouldEqual, database.StateRedirectLoop)
+		So(r.meta.GetReferer().IsPermanentRedirect(), ShouldBeTrue)
+	})
+
+	Convey("Refresh to external host", t, func() {
+		r := helperRefreshRequest(ts)
+		u, err := url.Parse(ts.URL + "/external")
+		So(err, ShouldBeNil)
+		_, err = r.get(u, &content.Task{})
+		So(err, ShouldBeNil)
+		So(r.meta.GetURL(), ShouldEqual, "http://external/")
+		So(r.meta.GetState(), ShouldEqual, database.StateExternal)
+		So(r.meta.GetReferer().GetState(), ShouldEqual, database.StateDublicate)
+	})
+}
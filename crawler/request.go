@@ -1,13 +1,16 @@
 package crawler
 
 import (
+	"context"
 	"database/sql"
-	"errors"
+	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
 	"time"
 
+	"github.com/ReanGD/go-web-search/content"
 	"github.com/ReanGD/go-web-search/database"
 	"github.com/ReanGD/go-web-search/proxy"
 	"github.com/ReanGD/go-web-search/werrors"
@@ -15,18 +18,38 @@ import (
 )
 
 type request struct {
-	hostMng *hostsManager
-	client  *http.Client
-	meta    *proxy.Meta
-	urls    map[string]sql.NullInt64
-	logger  zap.Logger
+	hostMng    *hostsManager
+	politeness *politeness
+	retry      *retryPolicy
+	recrawl    *recrawlScheduler
+	limits     *bodyLimits
+	// requestTimeout - timeout of whole request include redirects and body (0 - unlimited)
+	requestTimeout time.Duration
+	// bodyIdleTimeout - max time without new body data (0 - unlimited)
+	bodyIdleTimeout time.Duration
+	// refreshMaxDelay - max delay of meta refresh, that is followed like HTTP redirect
+	refreshMaxDelay time.Duration
+	client          *http.Client
+	meta            *proxy.Meta
+	urls            map[string]sql.NullInt64
+	rejected        map[string]*proxy.RejectedURL
+	logger          zap.Logger
+	// warc - writer of raw HTTP exchanges (nil - WARC output is disabled)
+	warc *warcWriter
+	// hopStart - start time of current hop of redirect chain
+	hopStart time.Time
 }
 
-func (r *request) get(u *url.URL) (int64, error) {
+func (r *request) get(u *url.URL, task *content.Task) (int64, error) {
 	urlStr := u.String()
 	r.urls = make(map[string]sql.NullInt64)
+	r.rejected = make(map[string]*proxy.RejectedURL)
 	hostID, robotOk := r.hostMng.CheckURL(u)
 	r.meta = proxy.NewMeta(hostID, urlStr, nil)
+	r.meta.SetDepth(task.Depth)
+	if task.IsRecrawl() {
+		r.meta.SetRecrawl()
+	}
 
 	if !hostID.Valid {
 		r.meta.SetState(database.StateExternal)
@@ -37,96 +60,278 @@ func (r *request) get(u *url.URL) (int64, error) {
 		return 0, nil
 	}
 
-	startTime := time.Now()
+	duration, refresh, err := r.load(u, task)
+	for err == nil && refresh != nil {
+		u, err = r.followMetaRefresh(refresh)
+		if u == nil {
+			break
+		}
+		var refreshDuration int64
+		refreshDuration, refresh, err = r.load(u, &content.Task{})
+		duration += refreshDuration
+	}
+
+	return duration, err
+}
+
+// followMetaRefresh - add target of meta refresh to redirect chain like HTTP redirect
+// returns nil if target must not be loaded
+func (r *request) followMetaRefresh(refresh *metaRefresh) (*url.URL, error) {
+	hop := redirectHop(r.meta)
+	r.meta.SetMetaRefresh(refresh.urlStr, hop, refresh.delay)
+	if isRedirectLoop(refresh.urlStr, r.meta) {
+		r.meta.SetState(database.StateRedirectLoop)
+		return nil, errRedirectLoop
+	}
+	if hop+1 >= maxRedirects {
+		r.meta.SetState(database.StateTooManyRedirects)
+		return nil, errTooManyRedirects
+	}
+	target, err := url.Parse(refresh.urlStr)
+	if err != nil {
+		return nil, err
+	}
+
+	hostID, robotOk := r.hostMng.CheckURL(target)
+	r.meta = proxy.NewMeta(hostID, refresh.urlStr, r.meta)
+	if !hostID.Valid {
+		r.meta.SetState(database.StateExternal)
+		return nil, nil
+	}
+	if !robotOk {
+		r.meta.SetState(database.StateDisabledByRobotsTxt)
+		log.Printf("INFO: URL %s blocked by robot.txt", refresh.urlStr)
+		return nil, nil
+	}
+
+	return target, nil
+}
+
+// writeWarc - write exchange to WARC file and save ID of response record in r.meta
+// body - read part of response body (nil - WARC output is disabled), truncated - body was cut by size limits
+func (r *request) writeWarc(response *http.Response, body *warcBody, truncated bool, startTime time.Time) {
+	if body == nil {
+		return
+	}
+
+	id, err := r.warc.WriteExchange(&warcExchange{
+		response:  response,
+		body:      body.buf.Bytes(),
+		complete:  body.eof,
+		truncated: truncated,
+		fetchedAt: startTime,
+		duration:  r.hostMng.Now().Sub(startTime),
+		meta:      r.meta})
+	if err != nil {
+		werrors.LogError(r.logger, err)
+		return
+	}
+	r.meta.SetWarcRecordID(id)
+}
+
+// writeWarcRedirect - write exchange of redirect hop to WARC file and save ID of response record in r.meta,
+// response body is read with limit before it is closed by client
+func (r *request) writeWarcRedirect(response *http.Response) {
+	if r.warc == nil || response == nil {
+		return
+	}
+
+	captured := newWarcBody(response.Body)
+	var reader io.Reader = captured
+	if r.limits != nil && r.limits.maxSize > 0 {
+		reader = io.LimitReader(captured, r.limits.maxSize)
+	}
+	_, _ = io.Copy(ioutil.Discard, reader)
+	truncated := !captured.eof && r.limits != nil && r.limits.maxSize > 0 &&
+		int64(captured.buf.Len()) >= r.limits.maxSize
+	r.writeWarc(response, captured, truncated, r.hopStart)
+	r.hopStart = r.hostMng.Now()
+}
+
+// load - download and parse URL for r.meta
+// returns meta refresh, that must be followed like HTTP redirect
+func (r *request) load(u *url.URL, task *content.Task) (int64, *metaRefresh, error) {
+	err := r.hostMng.Login(urlHostName(u))
+	if err != nil {
+		werrors.LogError(r.logger, err)
+	}
+
+	startTime := r.hostMng.Now()
+	r.hopStart = startTime
 	request := &http.Request{
 		Method:     "GET",
 		URL:        u,
 		Proto:      "HTTP/1.1",
 		ProtoMajor: 1,
 		ProtoMinor: 1,
-		Header: map[string][]string{
-			"User-Agent":      {"Mozilla/5.0 (compatible; GoWebSearch/0.1)"},
-			"Accept":          {"text/html;q=0.9,*/*;q=0.1"},
-			"Accept-Encoding": {"gzip;q=0.9,identity;q=0.5,*;q=0.1"},
-			"Accept-Language": {"ru-RU,ru;q=0.9,en-US;q=0.2,en;q=0.1"},
-			"Accept-Charset":  {"utf-8;q=0.9,windows-1251;q=0.8,koi8-r;q=0.7,*;q=0.1"},
-		},
-		Body: nil,
-		Host: u.Host,
+		Header:     r.hostMng.RequestHeader(urlHostName(u)),
+		Body:       nil,
+		Host:       u.Host,
+	}
+	request.Header.Set("Accept-Encoding", acceptEncoding())
+	r.hostMng.ApplyAuth(request)
+	if task.IsRecrawl() && task.ETag != "" {
+		request.Header.Set("If-None-Match", task.ETag)
+	}
+	if task.IsRecrawl() && task.LastModified != "" {
+		request.Header.Set("If-Modified-Since", task.LastModified)
 	}
 
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if r.requestTimeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), r.requestTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	defer cancel()
+	request = request.WithContext(ctx)
+
 	response, err := r.client.Do(request)
 	if err != nil {
-		r.meta.SetState(database.StateConnectError)
-		return 0, err
+		state, isTimeout := classifyTimeout(ctx, err)
+		if !isTimeout {
+			var isRedirect bool
+			state, isRedirect = redirectState(err)
+			if !isRedirect {
+				state = database.StateConnectError
+			}
+		}
+		r.meta.SetState(state)
+		return 0, nil, err
+	}
+	var idleBody *idleTimeoutBody
+	if r.bodyIdleTimeout > 0 {
+		idleBody = newIdleTimeoutBody(response.Body, r.bodyIdleTimeout, cancel)
+		response.Body = idleBody
 	}
+	var captured *warcBody
+	if r.warc != nil {
+		captured = newWarcBody(response.Body)
+		response.Body = captured
+	}
+	r.hostMng.CheckSession(urlHostName(u), response)
+	r.politeness.Update(response.StatusCode, response.Header, r.hostMng.Now().Sub(startTime))
+	r.meta.SetValidators(response.Header.Get("ETag"), response.Header.Get("Last-Modified"))
 
-	if r.meta.GetState() != database.StateSuccess {
-		// here or early - logging!!!
-		return 0, nil
+	if response.StatusCode == http.StatusNotModified && r.meta.IsRecrawl() {
+		r.meta.SetStatusCode(response.StatusCode)
+		r.meta.SetNotModified()
+		err = response.Body.Close()
+		r.writeWarc(response, captured, false, startTime)
+		return 0, nil, err
 	}
 
-	// hostID, robotOk := r.hostMng.CheckURL(u)
-	// 		if !robotOk {
-	// 		r.meta.SetState(database.StateDisabledByRobotsTxt)
-	// 		return fmt.Errorf("INFO: URL %s blocked by robot.txt", NormalizeURL(&copyURL))
-	// 	}
+	if r.meta.GetState() != database.StateSuccess {
+		err = response.Body.Close()
+		r.writeWarc(response, captured, false, startTime)
+		return 0, nil, err
+	}
 
 	loggerURL := r.logger.With(zap.String("url", r.meta.GetURL()))
 
-	RequestDurationMs := int64(time.Since(startTime) / time.Millisecond)
+	RequestDurationMs := int64(r.hostMng.Now().Sub(startTime) / time.Millisecond)
 	loggerURL.Debug(DbgRequestDuration, zap.Int64("duration", RequestDurationMs))
 
-	parser := newResponseParser(loggerURL, r.hostMng, r.meta)
+	parser := newResponseParser(loggerURL, r.hostMng, r.limits, r.refreshMaxDelay, r.meta)
 	err = parser.Run(response)
-	if err == nil {
-		r.urls = parser.URLs
-	} else {
+	r.writeWarc(response, captured, parser.Truncated, startTime)
+	if r.meta.GetState() == database.StateAnswerError {
+		// body reading is interrupted by timeout
+		if idleBody != nil && idleBody.Expired() {
+			r.meta.SetState(database.StateBodyTimeout)
+		} else if ctx.Err() == context.DeadlineExceeded {
+			r.meta.SetState(database.StateRequestTimeout)
+		}
+	}
+	if err != nil {
 		werrors.LogError(loggerURL, err)
-		err = nil
+		return parser.BodyDurationMs, nil, nil
+	}
+	for urlStr, hostID := range parser.URLs {
+		r.urls[urlStr] = hostID
+	}
+	for urlStr, item := range parser.Rejected {
+		r.rejected[urlStr] = item
 	}
 
-	return parser.BodyDurationMs, err
+	return parser.BodyDurationMs, parser.Refresh, nil
 }
 
-// Send - load and parse the urlStr
-// urlStr - valid URL
-func (r *request) Process(u *url.URL) (*proxy.PageData, int64) {
-	duration, err := r.get(u)
+// Process - load and parse the URL
+// task - URL info from db (count of failed attempts, data from previous download)
+func (r *request) Process(u *url.URL, task *content.Task) (*proxy.PageData, int64) {
+	duration, err := r.get(u, task)
 	if err != nil {
 		log.Printf("ERROR: Get URL %s, message: %s", u.String(), err)
 	}
 
-	return proxy.NewPageData(r.meta, r.urls), duration
+	if r.retry.NeedRetry(r.meta, err, task.Attempts) {
+		hostID, _ := r.hostMng.CheckURL(u)
+		meta := proxy.NewMeta(hostID, u.String(), nil)
+		meta.SetRetry(task.Attempts+1, r.hostMng.Now().Add(r.retry.Backoff(task.Attempts+1)))
+		return proxy.NewPageData(meta, nil), duration
+	}
+	r.recrawl.Schedule(r.meta, task)
+	if r.meta.GetState() == database.StateSuccess {
+		if loaded, err := url.Parse(r.meta.GetURL()); err == nil {
+			r.hostMng.AddContent(loaded, r.meta.GetURL(), r.meta.GetHash())
+		}
+	}
+	data := proxy.NewPageData(r.meta, r.urls)
+	data.SetRejected(r.rejected)
+
+	return data, duration
 }
 
 // Init - init request structure
-func (r *request) Init(logger zap.Logger) {
-	r.client = new(http.Client)
+// transport - shared transport for all requests
+// jar - shared cookie jar (nil - without cookies)
+func (r *request) Init(logger zap.Logger, transport http.RoundTripper, jar http.CookieJar) {
+	r.client = &http.Client{Transport: transport, Jar: jar}
 	r.logger = logger
 	r.client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
-		if len(via) >= 10 {
-			return errors.New("stopped after 10 redirects")
-		}
 		if len(via) == 0 {
 			return nil
 		}
 
-		r.meta.SetState(database.StateDublicate)
-		r.meta.SetStatusCode(301)
+		statusCode, location := redirectResponse(req)
+		hop := redirectHop(r.meta)
+		r.meta.SetRedirect(statusCode, location, hop)
+		r.writeWarcRedirect(req.Response)
+		copyURL := *req.URL
+		urlStr := r.hostMng.NormalizeURL(&copyURL)
+		if isRedirectLoop(urlStr, r.meta) {
+			r.meta.SetState(database.StateRedirectLoop)
+			return errRedirectLoop
+		}
+		if hop+1 >= maxRedirects {
+			r.meta.SetState(database.StateTooManyRedirects)
+			return errTooManyRedirects
+		}
 
 		hostID, _ := r.hostMng.CheckURL(req.URL)
-		copyURL := *req.URL
-		r.meta = proxy.NewMeta(hostID, NormalizeURL(&copyURL), r.meta)
+		r.meta = proxy.NewMeta(hostID, urlStr, r.meta)
 		if !hostID.Valid {
 			r.meta.SetState(database.StateExternal)
 		}
 
 		for attr, val := range via[0].Header {
+			// cookies are added from jar and auth is set for host of redirect
+			if attr == "Cookie" || attr == "Authorization" {
+				continue
+			}
+			// validators of recrawl belong to requested URL, not to target of redirect,
+			// client copies them from first request itself
+			if attr == "If-None-Match" || attr == "If-Modified-Since" {
+				delete(req.Header, attr)
+				continue
+			}
 			if _, ok := req.Header[attr]; !ok {
 				req.Header[attr] = val
 			}
 		}
+		r.hostMng.ApplyAuth(req)
 
 		return nil
 	}
@@ -14,21 +14,35 @@ import (
 )
 
 type responseParser struct {
-	logger         zap.Logger
-	hostMng        *hostsManager
-	meta           *proxy.Meta
-	URLs           map[string]sql.NullInt64
+	logger          zap.Logger
+	hostMng         *hostsManager
+	limits          *bodyLimits
+	refreshMaxDelay time.Duration
+	meta            *proxy.Meta
+	URLs            map[string]sql.NullInt64
+	// Rejected - links rejected by rules of host
+	Rejected map[string]*proxy.RejectedURL
+	// Refresh - meta refresh with short delay, that is followed like HTTP redirect (nil - not found)
+	Refresh        *metaRefresh
 	BodyDurationMs int64
+	// Truncated - body was cut by size limits
+	Truncated bool
 }
 
 // newResponseParser - create responseParser struct
-func newResponseParser(logger zap.Logger, hostMng *hostsManager, meta *proxy.Meta) *responseParser {
+// refreshMaxDelay - max delay of meta refresh, that is followed like HTTP redirect
+func newResponseParser(logger zap.Logger, hostMng *hostsManager, limits *bodyLimits,
+	refreshMaxDelay time.Duration, meta *proxy.Meta) *responseParser {
 	return &responseParser{
-		logger:         logger,
-		hostMng:        hostMng,
-		meta:           meta,
-		URLs:           make(map[string]sql.NullInt64),
-		BodyDurationMs: 0}
+		logger:          logger,
+		hostMng:         hostMng,
+		limits:          limits,
+		refreshMaxDelay: refreshMaxDelay,
+		meta:            meta,
+		URLs:            make(map[string]sql.NullInt64),
+		Rejected:        make(map[string]*proxy.RejectedURL),
+		Refresh:         nil,
+		BodyDurationMs:  0}
 }
 
 func (r *responseParser) processMeta(statusCode int, header *http.Header) (string, string, error) {
@@ -48,7 +62,9 @@ func (r *responseParser) processMeta(statusCode int, header *http.Header) (strin
 	return contentType, getContentEncoding(header), nil
 }
 
-func (r *responseParser) processBody(body []byte, contentType string) (database.State, error) {
+// processBody - parse body
+// canonicalLink - target of header "Link: <URL>; rel=canonical"
+func (r *responseParser) processBody(body []byte, contentType string, canonicalLink string) (database.State, error) {
 	if !isHTML(body) {
 		return database.StateParseError, werrors.New(ErrBodyNotHTML)
 	}
@@ -63,13 +79,14 @@ func (r *responseParser) processBody(body []byte, contentType string) (database.
 		return database.StateParseError, werrors.NewDetails(ErrHTMLParse, err)
 	}
 
-	parser, err := RunDataExtrator(r.hostMng, node, r.meta.GetURL())
+	parser, err := RunDataExtrator(r.hostMng, node, r.meta.GetURL(), r.meta.GetDepth())
 	if err != nil {
 		return database.StateParseError, err
 	}
 	if !parser.MetaTagIndex {
 		return database.StateNoFollow, werrors.NewLevel(zap.InfoLevel, WarnPageNotIndexed)
 	}
+	parser.SetCanonical(canonicalLink, true)
 	parser.WrongURLsToLog(r.logger)
 
 	var buf bytes.Buffer
@@ -79,7 +96,15 @@ func (r *responseParser) processBody(body []byte, contentType string) (database.
 	}
 
 	r.URLs = parser.URLs
+	r.Rejected = parser.Rejected
 	r.meta.SetContent(proxy.NewContent(buf.Bytes(), parser.GetTitle()))
+	r.meta.SetCanonical(parser.GetCanonical())
+	refresh, delay := parser.GetRefresh()
+	if refresh != "" && delay <= r.refreshMaxDelay {
+		// target is added to redirect chain instead of links
+		delete(r.URLs, refresh)
+		r.Refresh = &metaRefresh{urlStr: refresh, delay: delay}
+	}
 
 	r.logger.Debug(DbgBodySize, zap.Int("size", buf.Len()))
 	return database.StateSuccess, nil
@@ -97,19 +122,28 @@ func (r *responseParser) Run(response *http.Response) error {
 		return err
 	}
 
-	body, err := readBody(contentEncoding, response.Body)
+	body, size, err := readBody(contentEncoding, response.Body, r.limits)
 	closeErr := response.Body.Close()
+	r.Truncated = size.truncated
 	defer r.timeTrack(time.Now())
+	r.logger.Debug(DbgBodyReadSize, zap.Int64("read_size", size.read), zap.Int64("decoded_size", size.decoded))
 	if err != nil {
-		r.meta.SetState(database.StateAnswerError)
+		if err.Error() == ErrBodyTooLarge {
+			r.meta.SetState(database.StateTooLarge)
+		} else {
+			r.meta.SetState(database.StateAnswerError)
+		}
 		return err
 	}
+	if size.truncated {
+		r.logger.Warn(WarnBodyTruncated, zap.Int64("read_size", size.read), zap.Int64("decoded_size", size.decoded))
+	}
 	if closeErr != nil {
 		r.meta.SetState(database.StateAnswerError)
 		return werrors.NewDetails(ErrCloseResponseBody, closeErr)
 	}
 
-	state, err := r.processBody(body, contentType)
+	state, err := r.processBody(body, contentType, getCanonicalLink(&response.Header))
 	if err != nil {
 		r.meta.SetState(state)
 		return err
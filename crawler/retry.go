@@ -0,0 +1,131 @@
+package crawler
+
+import (
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/ReanGD/go-web-search/database"
+	"github.com/ReanGD/go-web-search/proxy"
+)
+
+type errorClass uint8
+
+const (
+	// errorNone - no error
+	errorNone errorClass = 0
+	// errorTransient - error can disappear after retry
+	errorTransient errorClass = 1
+	// errorPermanent - error does not disappear after retry
+	errorPermanent errorClass = 2
+)
+
+// classifyFetchError - classify error returned by http.Client.Do
+func classifyFetchError(err error) errorClass {
+	if err == nil {
+		return errorNone
+	}
+	if uerr, ok := err.(*url.Error); ok {
+		err = uerr.Err
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return errorTransient
+	}
+	if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+		return errorTransient
+	}
+	if derr, ok := err.(*net.DNSError); ok {
+		if derr.IsTimeout || derr.IsTemporary {
+			return errorTransient
+		}
+		return errorPermanent
+	}
+	if oerr, ok := err.(*net.OpError); ok {
+		err = oerr.Err
+		if serr, ok := err.(*os.SyscallError); ok {
+			err = serr.Err
+		}
+		switch err {
+		case syscall.ECONNRESET, syscall.ECONNREFUSED, syscall.ECONNABORTED, syscall.EPIPE:
+			return errorTransient
+		}
+	}
+
+	return errorPermanent
+}
+
+// classifyStatusCode - classify response status code
+func classifyStatusCode(statusCode int) errorClass {
+	switch {
+	case statusCode == http.StatusOK:
+		return errorNone
+	case statusCode == http.StatusTooManyRequests, statusCode == http.StatusRequestTimeout:
+		return errorTransient
+	case statusCode >= 500 && statusCode != http.StatusNotImplemented:
+		return errorTransient
+	default:
+		return errorPermanent
+	}
+}
+
+// classifyMeta - classify result of page processing
+func classifyMeta(meta *proxy.Meta, fetchErr error) errorClass {
+	switch meta.GetState() {
+	case database.StateSuccess:
+		return errorNone
+	case database.StateConnectError:
+		return classifyFetchError(fetchErr)
+	case database.StateDialTimeout, database.StateTLSTimeout, database.StateResponseTimeout,
+		database.StateRequestTimeout, database.StateBodyTimeout:
+		return errorTransient
+	case database.StateErrorStatusCode:
+		statusCode := meta.GetStatusCode()
+		if !statusCode.Valid {
+			return errorPermanent
+		}
+		return classifyStatusCode(int(statusCode.Int64))
+	default:
+		return errorPermanent
+	}
+}
+
+// retryPolicy - requeue transient failures with jittered exponential backoff
+type retryPolicy struct {
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	random      func() float64
+}
+
+func newRetryPolicy(cfg *Config) *retryPolicy {
+	return &retryPolicy{
+		maxAttempts: cfg.RetryMaxAttempts,
+		baseDelay:   cfg.RetryBaseDelay,
+		maxDelay:    cfg.RetryMaxDelay,
+		random:      rand.Float64}
+}
+
+// Backoff - delay before attempt number "attempt" (starts from 1)
+// result is random value in the range [delay/2, delay)
+func (p *retryPolicy) Backoff(attempt int) time.Duration {
+	delay := p.baseDelay
+	for i := 1; i < attempt && delay < p.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.maxDelay {
+		delay = p.maxDelay
+	}
+
+	return delay/2 + time.Duration(p.random()*float64(delay/2))
+}
+
+// NeedRetry - check is need new download attempt
+// attempts - count of failed attempts before current
+func (p *retryPolicy) NeedRetry(meta *proxy.Meta, fetchErr error, attempts int) bool {
+	return attempts+1 < p.maxAttempts && classifyMeta(meta, fetchErr) == errorTransient
+}
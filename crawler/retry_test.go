@@ -0,0 +1,130 @@
+package crawler
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ReanGD/go-web-search/database"
+	"github.com/ReanGD/go-web-search/proxy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type timeoutError struct {
+}
+
+func (e timeoutError) Error() string   { return "timeout" }
+func (e timeoutError) Timeout() bool   { return true }
+func (e timeoutError) Temporary() bool { return true }
+
+func helperNewRetryPolicy() *retryPolicy {
+	cfg := NewConfig([]string{}, 0)
+	cfg.RetryMaxAttempts = 3
+	cfg.RetryBaseDelay = time.Minute
+	cfg.RetryMaxDelay = 5 * time.Minute
+	p := newRetryPolicy(cfg)
+	p.random = func() float64 { return 0.5 }
+
+	return p
+}
+
+// TestClassifyFetchError ...
+func TestClassifyFetchError(t *testing.T) {
+	Convey("Transient errors", t, func() {
+		So(classifyFetchError(&url.Error{Op: "Get", URL: "http://host", Err: timeoutError{}}), ShouldEqual, errorTransient)
+		So(classifyFetchError(io.ErrUnexpectedEOF), ShouldEqual, errorTransient)
+		So(classifyFetchError(&net.DNSError{Err: "dns", IsTimeout: true}), ShouldEqual, errorTransient)
+		connReset := &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+		So(classifyFetchError(&url.Error{Op: "Get", URL: "http://host", Err: connReset}), ShouldEqual, errorTransient)
+		So(classifyFetchError(&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}), ShouldEqual, errorTransient)
+	})
+
+	Convey("Permanent errors", t, func() {
+		So(classifyFetchError(errors.New("stopped after 10 redirects")), ShouldEqual, errorPermanent)
+		So(classifyFetchError(&net.DNSError{Err: "no such host"}), ShouldEqual, errorPermanent)
+	})
+
+	Convey("Without error", t, func() {
+		So(classifyFetchError(nil), ShouldEqual, errorNone)
+	})
+}
+
+// TestClassifyStatusCode ...
+func TestClassifyStatusCode(t *testing.T) {
+	Convey("Classify status code", t, func() {
+		So(classifyStatusCode(200), ShouldEqual, errorNone)
+		So(classifyStatusCode(429), ShouldEqual, errorTransient)
+		So(classifyStatusCode(502), ShouldEqual, errorTransient)
+		So(classifyStatusCode(503), ShouldEqual, errorTransient)
+		So(classifyStatusCode(501), ShouldEqual, errorPermanent)
+		So(classifyStatusCode(404), ShouldEqual, errorPermanent)
+		So(classifyStatusCode(410), ShouldEqual, errorPermanent)
+	})
+}
+
+// TestRetryBackoff ...
+func TestRetryBackoff(t *testing.T) {
+	Convey("Exponential backoff with max delay", t, func() {
+		p := helperNewRetryPolicy()
+		So(p.Backoff(1), ShouldEqual, 45*time.Second)
+		So(p.Backoff(2), ShouldEqual, 90*time.Second)
+		So(p.Backoff(3), ShouldEqual, 180*time.Second)
+		So(p.Backoff(4), ShouldEqual, 225*time.Second)
+		So(p.Backoff(100), ShouldEqual, 225*time.Second)
+	})
+
+	Convey("Jitter range", t, func() {
+		p := helperNewRetryPolicy()
+		p.random = func() float64 { return 0 }
+		So(p.Backoff(1), ShouldEqual, 30*time.Second)
+		p.random = func() float64 { return 0.999 }
+		So(p.Backoff(1), ShouldBeLessThan, time.Minute)
+	})
+}
+
+// TestRetryNeedRetry ...
+func TestRetryNeedRetry(t *testing.T) {
+	Convey("Retry transient status code", t, func() {
+		p := helperNewRetryPolicy()
+		meta := proxy.NewMeta(sql.NullInt64{Int64: 1, Valid: true}, "http://host", nil)
+		meta.SetStatusCode(503)
+		meta.SetState(database.StateErrorStatusCode)
+		So(p.NeedRetry(meta, nil, 0), ShouldBeTrue)
+		So(p.NeedRetry(meta, nil, 1), ShouldBeTrue)
+		So(p.NeedRetry(meta, nil, 2), ShouldBeFalse)
+	})
+
+	Convey("Not retry permanent errors", t, func() {
+		p := helperNewRetryPolicy()
+		meta := proxy.NewMeta(sql.NullInt64{Int64: 1, Valid: true}, "http://host", nil)
+		meta.SetStatusCode(404)
+		meta.SetState(database.StateErrorStatusCode)
+		So(p.NeedRetry(meta, nil, 0), ShouldBeFalse)
+
+		meta.SetState(database.StateDisabledByRobotsTxt)
+		So(p.NeedRetry(meta, nil, 0), ShouldBeFalse)
+	})
+
+	Convey("Retry connect error", t, func() {
+		p := helperNewRetryPolicy()
+		meta := proxy.NewMeta(sql.NullInt64{Int64: 1, Valid: true}, "http://host", nil)
+		meta.SetState(database.StateConnectError)
+		So(p.NeedRetry(meta, timeoutError{}, 0), ShouldBeTrue)
+		So(p.NeedRetry(meta, errors.New("error"), 0), ShouldBeFalse)
+	})
+
+	Convey("Retry timeouts", t, func() {
+		p := helperNewRetryPolicy()
+		meta := proxy.NewMeta(sql.NullInt64{Int64: 1, Valid: true}, "http://host", nil)
+		meta.SetState(database.StateResponseTimeout)
+		So(p.NeedRetry(meta, nil, 0), ShouldBeTrue)
+		meta.SetState(database.StateBodyTimeout)
+		So(p.NeedRetry(meta, nil, 0), ShouldBeTrue)
+	})
+}
@@ -0,0 +1,230 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ReanGD/go-web-search/proxy"
+	"github.com/ReanGD/go-web-search/werrors"
+	"github.com/uber-go/zap"
+)
+
+// sitemapMaxSize - max size of uncompressed sitemap file (by sitemaps.org protocol)
+const sitemapMaxSize = 50 * 1024 * 1024
+
+// sitemapDefaultPriority - default value of <priority>
+const sitemapDefaultPriority = 0.5
+
+var sitemapTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+type sitemapItem struct {
+	Loc        string `xml:"loc"`
+	LastMod    string `xml:"lastmod"`
+	ChangeFreq string `xml:"changefreq"`
+	Priority   string `xml:"priority"`
+}
+
+// sitemapXML - <urlset> or <sitemapindex>
+type sitemapXML struct {
+	XMLName  xml.Name
+	URLs     []sitemapItem `xml:"url"`
+	Sitemaps []sitemapItem `xml:"sitemap"`
+}
+
+func parseSitemapTime(value string) *time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range sitemapTimeLayouts {
+		result, err := time.Parse(layout, value)
+		if err == nil {
+			return &result
+		}
+	}
+
+	return nil
+}
+
+func parseSitemapPriority(value string) float64 {
+	result, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || result < 0 || result > 1 {
+		return sitemapDefaultPriority
+	}
+
+	return result
+}
+
+func parseSitemapChangeFreq(value string) string {
+	result := strings.ToLower(strings.TrimSpace(value))
+	if _, ok := changeFreqIntervals[result]; !ok {
+		return ""
+	}
+
+	return result
+}
+
+// unpackSitemap - unpack gzipped sitemap (*.xml.gz is sent without Content-Encoding)
+func unpackSitemap(body []byte) ([]byte, error) {
+	if len(body) < 2 || body[0] != 0x1f || body[1] != 0x8b {
+		return body, nil
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, werrors.NewDetails(ErrReadGZipResponse, err)
+	}
+	result, err := ioutil.ReadAll(io.LimitReader(reader, sitemapMaxSize))
+	if err == nil {
+		err = reader.Close()
+	} else {
+		_ = reader.Close()
+	}
+	if err != nil {
+		return nil, werrors.NewDetails(ErrReadGZipResponse, err)
+	}
+
+	return result, nil
+}
+
+func parseSitemap(body []byte) (*sitemapXML, error) {
+	body, err := unpackSitemap(body)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &sitemapXML{}
+	err = xml.Unmarshal(body, result)
+	if err != nil {
+		return nil, werrors.NewDetails(ErrParseSitemap, err)
+	}
+	if result.XMLName.Local != "urlset" && result.XMLName.Local != "sitemapindex" {
+		return nil, werrors.NewFields(ErrParseSitemap, zap.String("root", result.XMLName.Local))
+	}
+
+	return result, nil
+}
+
+// sitemapLoader - download sitemaps and sitemap indexes of host
+type sitemapLoader struct {
+	hostMng  *hostsManager
+	maxFiles int
+	visited  map[string]bool
+	urls     map[string]*proxy.SitemapURL
+}
+
+func newSitemapLoader(hostMng *hostsManager, maxFiles int) *sitemapLoader {
+	return &sitemapLoader{
+		hostMng:  hostMng,
+		maxFiles: maxFiles,
+		visited:  make(map[string]bool),
+		urls:     make(map[string]*proxy.SitemapURL)}
+}
+
+func (l *sitemapLoader) download(sitemapURL string) ([]byte, error) {
+	response, err := l.hostMng.httpGet(sitemapURL)
+	if err != nil {
+		return nil, werrors.NewFields(ErrGetRequest,
+			zap.String("details", err.Error()),
+			zap.String("url", sitemapURL))
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(response.Body, sitemapMaxSize))
+	closeErr := response.Body.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, werrors.NewFields(ErrReadResponseBody,
+			zap.String("details", err.Error()),
+			zap.String("url", sitemapURL))
+	}
+	if response.StatusCode != 200 {
+		return nil, werrors.NewEx(zap.WarnLevel, ErrStatusCode,
+			zap.Int("status_code", response.StatusCode),
+			zap.String("url", sitemapURL))
+	}
+
+	return body, nil
+}
+
+func (l *sitemapLoader) addURL(item *sitemapItem) {
+	parsed, err := url.Parse(strings.TrimSpace(item.Loc))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return
+	}
+
+	urlStr := l.hostMng.NormalizeURL(parsed)
+	parsed, err = url.Parse(urlStr)
+	if err != nil {
+		return
+	}
+	if l.hostMng.UpgradeScheme(parsed) {
+		urlStr = l.hostMng.NormalizeURL(parsed)
+	}
+	hostID, robotOk := l.hostMng.CheckURL(parsed)
+	if !hostID.Valid || !robotOk {
+		return
+	}
+	// URLs from sitemap have depth 0 and no referer, rejected URL is skipped without saving
+	if _, _, ok := l.hostMng.CheckRules(parsed, urlStr, 0); !ok {
+		return
+	}
+
+	l.urls[urlStr] = proxy.NewSitemapURL(urlStr, hostID,
+		parseSitemapTime(item.LastMod),
+		parseSitemapPriority(item.Priority),
+		parseSitemapChangeFreq(item.ChangeFreq))
+}
+
+// Load - load sitemap or sitemap index with all nested sitemaps
+func (l *sitemapLoader) Load(sitemapURL string) error {
+	if l.visited[sitemapURL] || len(l.visited) >= l.maxFiles {
+		return nil
+	}
+	l.visited[sitemapURL] = true
+
+	body, err := l.download(sitemapURL)
+	if err != nil {
+		return err
+	}
+	sitemap, err := parseSitemap(body)
+	if err != nil {
+		return werrors.AddFields(err, zap.String("url", sitemapURL))
+	}
+
+	for i := range sitemap.URLs {
+		l.addURL(&sitemap.URLs[i])
+	}
+	for _, item := range sitemap.Sitemaps {
+		nestedURL := strings.TrimSpace(item.Loc)
+		err = l.Load(nestedURL)
+		if err != nil {
+			log.Printf("WARN: Load sitemap %s, message: %s", nestedURL, err)
+		}
+	}
+
+	return nil
+}
+
+// GetURLs - get all loaded URLs
+func (l *sitemapLoader) GetURLs() []*proxy.SitemapURL {
+	result := make([]*proxy.SitemapURL, 0, len(l.urls))
+	for _, item := range l.urls {
+		result = append(result, item)
+	}
+
+	return result
+}
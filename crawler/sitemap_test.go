@@ -0,0 +1,174 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/temoto/robotstxt-go"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const sitemapURLSet = `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<url>
+		<loc>%s/page1</loc>
+		<lastmod>2016-05-01</lastmod>
+		<changefreq>Daily</changefreq>
+		<priority>0.8</priority>
+	</url>
+	<url>
+		<loc>%s/private/page2</loc>
+	</url>
+	<url>
+		<loc>http://other.host/page3</loc>
+	</url>
+</urlset>`
+
+const sitemapIndex = `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<sitemap><loc>%s/sitemap1.xml.gz</loc></sitemap>
+	<sitemap><loc>%s/missing.xml</loc></sitemap>
+</sitemapindex>`
+
+func helperGZip(data []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, _ = w.Write(data)
+	_ = w.Close()
+
+	return buf.Bytes()
+}
+
+// TestParseSitemap ...
+func TestParseSitemap(t *testing.T) {
+	Convey("Parse urlset", t, func() {
+		sitemap, err := parseSitemap([]byte(fmt.Sprintf(sitemapURLSet, "http://host", "http://host")))
+		So(err, ShouldBeNil)
+		So(sitemap.XMLName.Local, ShouldEqual, "urlset")
+		So(len(sitemap.URLs), ShouldEqual, 3)
+		So(sitemap.URLs[0].Loc, ShouldEqual, "http://host/page1")
+		So(sitemap.URLs[0].ChangeFreq, ShouldEqual, "Daily")
+		So(sitemap.Sitemaps, ShouldBeEmpty)
+	})
+
+	Convey("Parse gzipped sitemap index", t, func() {
+		body := helperGZip([]byte(fmt.Sprintf(sitemapIndex, "http://host", "http://host")))
+		sitemap, err := parseSitemap(body)
+		So(err, ShouldBeNil)
+		So(sitemap.XMLName.Local, ShouldEqual, "sitemapindex")
+		So(len(sitemap.Sitemaps), ShouldEqual, 2)
+		So(sitemap.Sitemaps[0].Loc, ShouldEqual, "http://host/sitemap1.xml.gz")
+	})
+
+	Convey("Parse errors", t, func() {
+		_, err := parseSitemap([]byte("<html><body></body></html>"))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, ErrParseSitemap)
+
+		_, err = parseSitemap([]byte("<urlset"))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, ErrParseSitemap)
+	})
+}
+
+// TestParseSitemapValues ...
+func TestParseSitemapValues(t *testing.T) {
+	Convey("Parse lastmod", t, func() {
+		So(*parseSitemapTime("2016-05-01"), ShouldResemble, time.Date(2016, 5, 1, 0, 0, 0, 0, time.UTC))
+		So(parseSitemapTime("2016-05-01T10:20:30+03:00").UTC(), ShouldResemble, time.Date(2016, 5, 1, 7, 20, 30, 0, time.UTC))
+		So(parseSitemapTime("yesterday"), ShouldBeNil)
+	})
+
+	Convey("Parse priority", t, func() {
+		So(parseSitemapPriority(" 0.8 "), ShouldEqual, 0.8)
+		So(parseSitemapPriority(""), ShouldEqual, sitemapDefaultPriority)
+		So(parseSitemapPriority("2"), ShouldEqual, sitemapDefaultPriority)
+	})
+
+	Convey("Parse changefreq", t, func() {
+		So(parseSitemapChangeFreq("Weekly"), ShouldEqual, "weekly")
+		So(parseSitemapChangeFreq("sometimes"), ShouldEqual, "")
+	})
+}
+
+// TestSitemapLoader ...
+func TestSitemapLoader(t *testing.T) {
+	Convey("Load sitemap index with nested sitemaps", t, func() {
+		var ts *httptest.Server
+		ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/sitemap.xml":
+				_, _ = fmt.Fprintf(w, sitemapIndex, ts.URL, ts.URL)
+			case "/sitemap1.xml.gz":
+				_, _ = w.Write(helperGZip([]byte(fmt.Sprintf(sitemapURLSet, ts.URL, ts.URL))))
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+		defer ts.Close()
+
+		parsed, err := url.Parse(ts.URL)
+		So(err, ShouldBeNil)
+		robot, err := robotstxt.FromStatusAndBytes(200, []byte("User-agent: *\nDisallow: /private\n"))
+		So(err, ShouldBeNil)
+		h := &hostsManager{
+			hosts:     map[string]int64{parsed.Host: 1},
+			robotsTxt: map[int64]*robotstxt.Group{1: robot.FindGroup("Googlebot")}}
+
+		loader := newSitemapLoader(h, 10)
+		err = loader.Load(ts.URL + "/sitemap.xml")
+		So(err, ShouldBeNil)
+		urls := loader.GetURLs()
+		So(len(urls), ShouldEqual, 1)
+		So(urls[0].GetURL(), ShouldEqual, ts.URL+"/page1")
+		So(urls[0].GetHostID(), ShouldResemble, sql.NullInt64{Int64: 1, Valid: true})
+		hint := urls[0].GetHint(5)
+		So(hint.URL, ShouldEqual, 5)
+		So(hint.Priority, ShouldEqual, 0.8)
+		So(hint.ChangeFreq, ShouldEqual, "daily")
+		So(*hint.LastMod, ShouldResemble, time.Date(2016, 5, 1, 0, 0, 0, 0, time.UTC))
+
+		visited := make([]string, 0, len(loader.visited))
+		for key := range loader.visited {
+			visited = append(visited, key)
+		}
+		sort.Strings(visited)
+		So(visited, ShouldResemble, []string{
+			ts.URL + "/missing.xml", ts.URL + "/sitemap.xml", ts.URL + "/sitemap1.xml.gz"})
+	})
+
+	Convey("Limit of files", t, func() {
+		cnt := 0
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cnt++
+			_, _ = fmt.Fprintf(w, sitemapIndex, "http://"+r.Host, "http://"+r.Host)
+		}))
+		defer ts.Close()
+
+		loader := newSitemapLoader(&hostsManager{}, 1)
+		err := loader.Load(ts.URL + "/sitemap.xml")
+		So(err, ShouldBeNil)
+		So(cnt, ShouldEqual, 1)
+	})
+
+	Convey("Load error", t, func() {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.NotFound(w, r)
+		}))
+		defer ts.Close()
+
+		loader := newSitemapLoader(&hostsManager{}, 1)
+		err := loader.Load(ts.URL + "/sitemap.xml")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, ErrStatusCode)
+	})
+}
@@ -0,0 +1,96 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ReanGD/go-web-search/database"
+)
+
+// errBodyIdleTimeout - body data was not received during idle timeout
+var errBodyIdleTimeout = errors.New("body idle timeout exceeded")
+
+// classifyTimeout - get state for timeout error returned by http.Client.Do
+// ctx - context of request with timeout of whole request
+// returns false if err is not timeout error
+func classifyTimeout(ctx context.Context, err error) (database.State, bool) {
+	if err == nil {
+		return database.StateSuccess, false
+	}
+	if ctx != nil && ctx.Err() == context.DeadlineExceeded {
+		return database.StateRequestTimeout, true
+	}
+	if uerr, ok := err.(*url.Error); ok {
+		err = uerr.Err
+	}
+	if err == context.DeadlineExceeded {
+		return database.StateRequestTimeout, true
+	}
+	if oerr, ok := err.(*net.OpError); ok && oerr.Op == "dial" && oerr.Timeout() {
+		return database.StateDialTimeout, true
+	}
+	// errors of http.Transport are not exported, only messages can be checked
+	msg := err.Error()
+	if strings.Contains(msg, "TLS handshake timeout") {
+		return database.StateTLSTimeout, true
+	}
+	if strings.Contains(msg, "timeout awaiting response headers") {
+		return database.StateResponseTimeout, true
+	}
+	if strings.Contains(msg, "Client.Timeout exceeded") {
+		return database.StateRequestTimeout, true
+	}
+
+	return database.StateSuccess, false
+}
+
+// idleTimeoutBody - cancel request if body data is not received during timeout
+type idleTimeoutBody struct {
+	body    io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+	expired int32
+}
+
+// newIdleTimeoutBody - wrap response body
+// cancel - cancel function of request context
+func newIdleTimeoutBody(body io.ReadCloser, timeout time.Duration, cancel func()) *idleTimeoutBody {
+	result := &idleTimeoutBody{body: body, timeout: timeout}
+	result.timer = time.AfterFunc(timeout, func() {
+		atomic.StoreInt32(&result.expired, 1)
+		cancel()
+	})
+
+	return result
+}
+
+// Expired - check that request was canceled by idle timeout
+func (b *idleTimeoutBody) Expired() bool {
+	return atomic.LoadInt32(&b.expired) != 0
+}
+
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	if b.Expired() {
+		return n, errBodyIdleTimeout
+	}
+	if err == nil {
+		b.timer.Reset(b.timeout)
+	} else {
+		b.timer.Stop()
+	}
+
+	return n, err
+}
+
+// Close - stop timer and close body
+func (b *idleTimeoutBody) Close() error {
+	b.timer.Stop()
+	return b.body.Close()
+}
@@ -0,0 +1,203 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ReanGD/go-web-search/database"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func helperTimeoutsClient(cfg *Config) *http.Client {
+	f, err := newTransportFactory(cfg)
+	So(err, ShouldBeNil)
+
+	return f.NewClient()
+}
+
+// TestClassifyTimeout ...
+func TestClassifyTimeout(t *testing.T) {
+	Convey("Dial timeout", t, func() {
+		err := &url.Error{Op: "Get", URL: "http://host", Err: &net.OpError{Op: "dial", Err: timeoutError{}}}
+		state, ok := classifyTimeout(context.Background(), err)
+		So(ok, ShouldBeTrue)
+		So(state, ShouldEqual, database.StateDialTimeout)
+	})
+
+	Convey("Request context deadline", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+		defer cancel()
+		<-ctx.Done()
+		state, ok := classifyTimeout(ctx, &url.Error{Op: "Get", URL: "http://host", Err: ctx.Err()})
+		So(ok, ShouldBeTrue)
+		So(state, ShouldEqual, database.StateRequestTimeout)
+	})
+
+	Convey("Not timeout", t, func() {
+		_, ok := classifyTimeout(context.Background(), &net.OpError{Op: "dial", Err: errors.New("refused")})
+		So(ok, ShouldBeFalse)
+		_, ok = classifyTimeout(context.Background(), &net.OpError{Op: "read", Err: timeoutError{}})
+		So(ok, ShouldBeFalse)
+		_, ok = classifyTimeout(context.Background(), nil)
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("Time to first byte", t, func() {
+		done := make(chan struct{})
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-done
+		}))
+		defer ts.Close()
+		defer close(done)
+
+		cfg := NewConfig([]string{}, 0)
+		cfg.ResponseHeaderTimeout = 50 * time.Millisecond
+		_, err := helperTimeoutsClient(cfg).Get(ts.URL)
+		So(err, ShouldNotBeNil)
+		state, ok := classifyTimeout(context.Background(), err)
+		So(ok, ShouldBeTrue)
+		So(state, ShouldEqual, database.StateResponseTimeout)
+	})
+
+	Convey("TLS handshake", t, func() {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		defer listener.Close()
+		go func() {
+			// accept connection and do not answer
+			conn, err := listener.Accept()
+			if err == nil {
+				time.Sleep(time.Second)
+				_ = conn.Close()
+			}
+		}()
+
+		cfg := NewConfig([]string{}, 0)
+		cfg.TLSHandshakeTimeout = 50 * time.Millisecond
+		_, err = helperTimeoutsClient(cfg).Get("https://" + listener.Addr().String())
+		So(err, ShouldNotBeNil)
+		state, ok := classifyTimeout(context.Background(), err)
+		So(ok, ShouldBeTrue)
+		So(state, ShouldEqual, database.StateTLSTimeout)
+	})
+
+	Convey("Total request", t, func() {
+		done := make(chan struct{})
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-done
+		}))
+		defer ts.Close()
+		defer close(done)
+
+		cfg := NewConfig([]string{}, 0)
+		cfg.RequestTimeout = 50 * time.Millisecond
+		_, err := helperTimeoutsClient(cfg).Get(ts.URL)
+		So(err, ShouldNotBeNil)
+		state, ok := classifyTimeout(context.Background(), err)
+		So(ok, ShouldBeTrue)
+		So(state, ShouldEqual, database.StateRequestTimeout)
+	})
+}
+
+// TestIdleTimeoutBody ...
+func TestIdleTimeoutBody(t *testing.T) {
+	Convey("Stalled body is canceled", t, func() {
+		done := make(chan struct{})
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("start"))
+			w.(http.Flusher).Flush()
+			<-done
+		}))
+		defer ts.Close()
+		defer close(done)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		request, err := http.NewRequest("GET", ts.URL, nil)
+		So(err, ShouldBeNil)
+		response, err := http.DefaultClient.Do(request.WithContext(ctx))
+		So(err, ShouldBeNil)
+		body := newIdleTimeoutBody(response.Body, 50*time.Millisecond, cancel)
+		data, err := ioutil.ReadAll(body)
+		So(err, ShouldEqual, errBodyIdleTimeout)
+		So(string(data), ShouldEqual, "start")
+		So(body.Expired(), ShouldBeTrue)
+		So(body.Close(), ShouldBeNil)
+	})
+
+	Convey("Body is read before timeout", t, func() {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("body"))
+		}))
+		defer ts.Close()
+
+		response, err := http.Get(ts.URL)
+		So(err, ShouldBeNil)
+		body := newIdleTimeoutBody(response.Body, time.Second, func() {})
+		data, err := ioutil.ReadAll(body)
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, "body")
+		So(body.Close(), ShouldBeNil)
+		So(body.Expired(), ShouldBeFalse)
+	})
+}
+
+// TestTransportPool ...
+func TestTransportPool(t *testing.T) {
+	Convey("Pool settings", t, func() {
+		cfg := NewConfig([]string{}, 0)
+		f, err := newTransportFactory(cfg)
+		So(err, ShouldBeNil)
+		So(f.transport.MaxIdleConns, ShouldEqual, cfg.MaxIdleConns)
+		So(f.transport.MaxIdleConnsPerHost, ShouldEqual, cfg.MaxIdleConnsPerHost)
+		So(f.transport.IdleConnTimeout, ShouldEqual, cfg.IdleConnTimeout)
+		So(f.transport.ForceAttemptHTTP2, ShouldBeTrue)
+		So(f.NewClient().Timeout, ShouldEqual, cfg.RequestTimeout)
+	})
+
+	Convey("Connection is reused with keep-alive", t, func() {
+		var addrs []string
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			addrs = append(addrs, r.RemoteAddr)
+			_, _ = w.Write([]byte("ok"))
+		}))
+		defer ts.Close()
+
+		client := helperTimeoutsClient(NewConfig([]string{}, 0))
+		for i := 0; i != 2; i++ {
+			response, err := client.Get(ts.URL)
+			So(err, ShouldBeNil)
+			_, err = ioutil.ReadAll(response.Body)
+			So(err, ShouldBeNil)
+			So(response.Body.Close(), ShouldBeNil)
+		}
+		So(len(addrs), ShouldEqual, 2)
+		So(addrs[0], ShouldEqual, addrs[1])
+	})
+
+	Convey("HTTP/2 for https host", t, func() {
+		var proto string
+		ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			proto = r.Proto
+		}))
+		ts.EnableHTTP2 = true
+		ts.StartTLS()
+		defer ts.Close()
+
+		f, err := newTransportFactory(NewConfig([]string{}, 0))
+		So(err, ShouldBeNil)
+		f.transport.TLSClientConfig = ts.Client().Transport.(*http.Transport).TLSClientConfig
+		response, err := f.NewClient().Get(ts.URL)
+		So(err, ShouldBeNil)
+		So(response.Body.Close(), ShouldBeNil)
+		So(response.ProtoMajor, ShouldEqual, 2)
+		So(proto, ShouldEqual, "HTTP/2.0")
+	})
+}
@@ -0,0 +1,114 @@
+package crawler
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ReanGD/go-web-search/werrors"
+	"github.com/uber-go/zap"
+)
+
+// proxyDirect - value of Config.HostProxies for direct connection to host
+const proxyDirect = "direct"
+
+// transportFactory - shared transport for all outbound requests of crawler
+type transportFactory struct {
+	// proxy - proxy for all hosts (nil - direct connection)
+	proxy *url.URL
+	// hostProxies - map[hostName]proxy, nil value - direct connection
+	hostProxies map[string]*url.URL
+	// requestTimeout - timeout of whole request for clients (0 - unlimited)
+	requestTimeout time.Duration
+	transport      *http.Transport
+	// fetcher - transport with record or replay of exchanges by Config.FetchMode
+	fetcher Fetcher
+}
+
+func parseProxyURL(rawURL string) (*url.URL, error) {
+	if rawURL == "" || rawURL == proxyDirect {
+		return nil, nil
+	}
+
+	result, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, werrors.NewFields(ErrParseProxyURL,
+			zap.String("details", err.Error()),
+			zap.String("proxy", rawURL))
+	}
+	if result.Host == "" || (result.Scheme != "http" && result.Scheme != "https" && result.Scheme != "socks5") {
+		return nil, werrors.NewFields(ErrParseProxyURL,
+			zap.String("details", "unsupported proxy URL"),
+			zap.String("proxy", rawURL))
+	}
+
+	return result, nil
+}
+
+func newTransportFactory(cfg *Config) (*transportFactory, error) {
+	proxy, err := parseProxyURL(cfg.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	hostProxies := make(map[string]*url.URL, len(cfg.HostProxies))
+	for hostName, rawURL := range cfg.HostProxies {
+		hostProxies[NormalizeHostName(hostName)], err = parseProxyURL(rawURL)
+		if err != nil {
+			return nil, werrors.AddFields(err, zap.String("host", hostName))
+		}
+	}
+
+	f := &transportFactory{proxy: proxy, hostProxies: hostProxies, requestTimeout: cfg.RequestTimeout}
+	dialer := &net.Dialer{Timeout: cfg.DialTimeout, KeepAlive: cfg.KeepAlive}
+	// HTTP proxy is used with CONNECT for https URLs, proxy auth is taken from user info of proxy URL
+	// connections are shared by all hosts workers, HTTP/2 must be forced because of custom dialer
+	f.transport = &http.Transport{
+		Proxy:                 f.proxyForRequest,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   cfg.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: cfg.ResponseHeaderTimeout,
+		ExpectContinueTimeout: time.Second,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		ForceAttemptHTTP2:     cfg.EnableHTTP2}
+	f.fetcher, err = newFetcher(cfg, f.transport)
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// proxyForHost - get proxy from HostProxies
+func (f *transportFactory) proxyForHost(u *url.URL) (*url.URL, bool) {
+	if proxy, ok := f.hostProxies[urlHostName(u)]; ok {
+		return proxy, true
+	}
+	proxy, ok := f.hostProxies[NormalizeHostName(u.Hostname())]
+
+	return proxy, ok
+}
+
+// proxyForRequest - get proxy for host of request (nil - direct connection, proxy from environment is used without Config.Proxy)
+func (f *transportFactory) proxyForRequest(request *http.Request) (*url.URL, error) {
+	if proxy, ok := f.proxyForHost(request.URL); ok {
+		return proxy, nil
+	}
+	if f.proxy == nil {
+		return http.ProxyFromEnvironment(request)
+	}
+
+	return f.proxy, nil
+}
+
+// Transport - get shared transport (fetcher)
+func (f *transportFactory) Transport() http.RoundTripper {
+	return f.fetcher
+}
+
+// NewClient - create client with shared transport (fetcher) and request timeout
+func (f *transportFactory) NewClient() *http.Client {
+	return &http.Client{Transport: f.fetcher, Timeout: f.requestTimeout}
+}
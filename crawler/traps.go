@@ -0,0 +1,314 @@
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/ReanGD/go-web-search/database"
+	"github.com/ReanGD/go-web-search/proxy"
+)
+
+// pathTemplate - path, where segments with digits are replaced by "*" ("/news/2016/10/" -> "/news/*/*/")
+func pathTemplate(u *url.URL) string {
+	segments := strings.Split(u.EscapedPath(), "/")
+	for i, segment := range segments {
+		if strings.IndexFunc(segment, unicode.IsDigit) != -1 {
+			segments[i] = "*"
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// repeatedSegment - find path segment repeated more than maxRepeats times
+func repeatedSegment(u *url.URL, maxRepeats int) (string, bool) {
+	counts := make(map[string]int)
+	for _, segment := range strings.Split(u.EscapedPath(), "/") {
+		if segment == "" {
+			continue
+		}
+		counts[segment]++
+		if counts[segment] > maxRepeats {
+			return segment, true
+		}
+	}
+
+	return "", false
+}
+
+// queryShape - names of query parameters in order of appearance ("b=2&a=1&a=3" -> "b&a&a"),
+// values are ignored, so pagination and ids do not create new variants, but sort permutations do
+func queryShape(u *url.URL) string {
+	params := strings.Split(u.RawQuery, "&")
+	for i, param := range params {
+		if pos := strings.IndexByte(param, '='); pos != -1 {
+			params[i] = param[:pos]
+		}
+	}
+
+	return strings.Join(params, "&")
+}
+
+// pathRepeatPattern - pattern for URLs with segment repeated more than maxRepeats times
+func pathRepeatPattern(segment string, maxRepeats int) string {
+	parts := make([]string, maxRepeats+1)
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(segment)
+	}
+
+	return rulePrefixRegexp + "^/(.*/)?" + strings.Join(parts, "/(.*/)?") + "([/?]|$)"
+}
+
+// templatePattern - pattern for URLs of path template, withQuery - only URLs with query
+func templatePattern(template string, withQuery bool) string {
+	segments := strings.Split(template, "/")
+	for i, segment := range segments {
+		if segment == "*" {
+			segments[i] = "[^/]*"
+		} else {
+			segments[i] = regexp.QuoteMeta(segment)
+		}
+	}
+	end := "$"
+	if withQuery {
+		end = `\?`
+	}
+
+	return rulePrefixRegexp + "^" + strings.Join(segments, "/") + end
+}
+
+// trapDetector - heuristics for crawler traps (infinite URL spaces), found traps are quarantined per host
+type trapDetector struct {
+	db proxy.DbHost
+	// maxPathRepeats - max repeats of one segment in path (0 - check disabled)
+	maxPathRepeats int
+	// maxQueryVariants - max count of distinct query shapes for path template (0 - check disabled)
+	maxQueryVariants int
+	// maxSameContent - max count of distinct URLs of path template with same content (0 - check disabled)
+	maxSameContent int
+	mu             sync.Mutex
+	// quarantine - map[hostID]patterns of found traps
+	quarantine map[int64][]*urlPattern
+	// queries - map[hostID]map[path template]set of query shapes
+	queries map[int64]map[string]map[string]struct{}
+	// contents - map[hostID]map[path template + hash]set of URLs
+	contents map[int64]map[string]map[string]struct{}
+}
+
+func newTrapDetector(db proxy.DbHost, cfg *Config) *trapDetector {
+	return &trapDetector{
+		db:               db,
+		maxPathRepeats:   cfg.TrapMaxPathRepeats,
+		maxQueryVariants: cfg.TrapMaxQueryVariants,
+		maxSameContent:   cfg.TrapMaxSameContent,
+		quarantine:       make(map[int64][]*urlPattern),
+		queries:          make(map[int64]map[string]map[string]struct{}),
+		contents:         make(map[int64]map[string]map[string]struct{})}
+}
+
+// Init - load quarantined patterns from db
+func (d *trapDetector) Init() error {
+	traps, err := d.db.GetTraps()
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, trap := range traps {
+		pattern, err := newURLPattern(trap.GetPattern())
+		if err != nil {
+			return err
+		}
+		d.quarantine[trap.GetHostID()] = append(d.quarantine[trap.GetHostID()], pattern)
+	}
+
+	return nil
+}
+
+// findQuarantined - find quarantined pattern matched URL, d.mu must be locked
+func (d *trapDetector) findQuarantined(hostID int64, u *url.URL) (string, bool) {
+	target := u.RequestURI()
+	for _, pattern := range d.quarantine[hostID] {
+		if pattern.Match(target) {
+			return pattern.source, true
+		}
+	}
+
+	return "", false
+}
+
+// flag - quarantine pattern of host, d.mu must be locked
+// returns trap for saving to db after unlock (nil - pattern is wrong)
+func (d *trapDetector) flag(hostID int64, pattern string, kind database.TrapKind, hits int, example string) *proxy.Trap {
+	compiled, err := newURLPattern(pattern)
+	if err != nil {
+		log.Printf("ERROR: Compile trap pattern %s, message: %s", pattern, err)
+		return nil
+	}
+	d.quarantine[hostID] = append(d.quarantine[hostID], compiled)
+	log.Printf("INFO: Crawler trap %s quarantined for host %d, example URL: %s", pattern, hostID, example)
+
+	return proxy.NewTrap(hostID, pattern, kind, hits, example)
+}
+
+// save - save flagged trap to db, d.mu must not be locked
+func (d *trapDetector) save(trap *proxy.Trap) {
+	if trap == nil {
+		return
+	}
+	err := d.db.SaveTrap(trap)
+	if err != nil {
+		log.Printf("ERROR: Save trap %s for host %d, message: %s", trap.GetPattern(), trap.GetHostID(), err)
+	}
+}
+
+// addToSet - add item to set in group of host, returns size of set
+func addToSet(groups map[int64]map[string]map[string]struct{}, hostID int64, key string, item string) int {
+	group, ok := groups[hostID]
+	if !ok {
+		group = make(map[string]map[string]struct{})
+		groups[hostID] = group
+	}
+	set, ok := group[key]
+	if !ok {
+		set = make(map[string]struct{})
+		group[key] = set
+	}
+	set[item] = struct{}{}
+
+	return len(set)
+}
+
+// check - check link to URL of host, d.mu must be locked
+// returns false and pattern if URL is in crawler trap, found trap must be saved
+func (d *trapDetector) check(hostID int64, u *url.URL, urlStr string) (string, *proxy.Trap, bool) {
+	if pattern, found := d.findQuarantined(hostID, u); found {
+		return pattern, nil, false
+	}
+
+	if d.maxPathRepeats > 0 {
+		if segment, found := repeatedSegment(u, d.maxPathRepeats); found {
+			pattern := pathRepeatPattern(segment, d.maxPathRepeats)
+			return pattern, d.flag(hostID, pattern, database.TrapPathRepeat, 1, urlStr), false
+		}
+	}
+
+	if d.maxQueryVariants > 0 && u.RawQuery != "" {
+		template := pathTemplate(u)
+		count := addToSet(d.queries, hostID, template, queryShape(u))
+		if count > d.maxQueryVariants {
+			delete(d.queries[hostID], template)
+			pattern := templatePattern(template, true)
+			return pattern, d.flag(hostID, pattern, database.TrapQueryVariants, count, urlStr), false
+		}
+	}
+
+	return "", nil, true
+}
+
+// Check - check link to URL of host, returns false and pattern if URL is in crawler trap
+func (d *trapDetector) Check(hostID int64, u *url.URL, urlStr string) (string, bool) {
+	d.mu.Lock()
+	pattern, trap, ok := d.check(hostID, u, urlStr)
+	d.mu.Unlock()
+	d.save(trap)
+
+	return pattern, ok
+}
+
+// addContent - check loaded page of host with hash of content, d.mu must be locked
+// returns found trap, that must be saved
+func (d *trapDetector) addContent(hostID int64, u *url.URL, urlStr string, hash string) *proxy.Trap {
+	template := pathTemplate(u)
+	key := template + "\x00" + hash
+	count := addToSet(d.contents, hostID, key, urlStr)
+	if count <= d.maxSameContent {
+		return nil
+	}
+	delete(d.contents[hostID], key)
+	if _, found := d.findQuarantined(hostID, u); found {
+		return nil
+	}
+
+	return d.flag(hostID, templatePattern(template, u.RawQuery != ""), database.TrapSameContent, count, urlStr)
+}
+
+// AddContent - check loaded page of host with hash of content
+func (d *trapDetector) AddContent(hostID int64, u *url.URL, urlStr string, hash string) {
+	if d.maxSameContent <= 0 || hash == "" {
+		return
+	}
+
+	d.mu.Lock()
+	trap := d.addContent(hostID, u, urlStr, hash)
+	d.mu.Unlock()
+	d.save(trap)
+}
+
+// trapKindName - name of heuristic for report
+func trapKindName(kind database.TrapKind) string {
+	switch kind {
+	case database.TrapPathRepeat:
+		return "path repeat"
+	case database.TrapQueryVariants:
+		return "query variants"
+	case database.TrapSameContent:
+		return "same content"
+	default:
+		return "unknown"
+	}
+}
+
+// WriteTrapsReport - write quarantined patterns grouped by host in format of HostRules.Exclude
+func WriteTrapsReport(db proxy.DbHost, w io.Writer) error {
+	hosts, err := db.GetHosts()
+	if err != nil {
+		return err
+	}
+	traps, err := db.GetTraps()
+	if err != nil {
+		return err
+	}
+
+	byHost := make(map[string][]*proxy.Trap)
+	for _, trap := range traps {
+		hostName := fmt.Sprintf("%d", trap.GetHostID())
+		if host, ok := hosts[trap.GetHostID()]; ok {
+			hostName = DisplayHostName(host.GetName())
+		}
+		byHost[hostName] = append(byHost[hostName], trap)
+	}
+	hostNames := make([]string, 0, len(byHost))
+	for hostName := range byHost {
+		hostNames = append(hostNames, hostName)
+	}
+	sort.Strings(hostNames)
+
+	for _, hostName := range hostNames {
+		_, err = fmt.Fprintf(w, "%q: &crawler.HostRules{Exclude: []string{\n", hostName)
+		if err != nil {
+			return err
+		}
+		for _, trap := range byHost[hostName] {
+			_, err = fmt.Fprintf(w, "\t%q, // %s, hits: %d, example: %s\n",
+				trap.GetPattern(), trapKindName(trap.GetKind()), trap.GetHits(), trap.GetExample())
+			if err != nil {
+				return err
+			}
+		}
+		_, err = fmt.Fprintln(w, "}},")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
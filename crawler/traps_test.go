@@ -0,0 +1,176 @@
+package crawler
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"testing"
+
+	"github.com/ReanGD/go-web-search/database"
+	"github.com/ReanGD/go-web-search/proxy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func helperTrapDetector(db *fakeDbHost) *trapDetector {
+	cfg := NewConfig(nil, 0)
+	cfg.TrapMaxPathRepeats = 2
+	cfg.TrapMaxQueryVariants = 3
+	cfg.TrapMaxSameContent = 2
+	d := newTrapDetector(db, cfg)
+	So(d.Init(), ShouldBeNil)
+
+	return d
+}
+
+func helperCheckTrap(d *trapDetector, urlStr string) (string, bool) {
+	u, err := url.Parse(urlStr)
+	So(err, ShouldBeNil)
+
+	return d.Check(1, u, urlStr)
+}
+
+func helperMatchPattern(pattern string, target string) bool {
+	p, err := newURLPattern(pattern)
+	So(err, ShouldBeNil)
+
+	return p.Match(target)
+}
+
+// TestTrapPatterns ...
+func TestTrapPatterns(t *testing.T) {
+	Convey("Path template", t, func() {
+		u, _ := url.Parse("http://host/news/2016/item-10/view?sort=asc")
+		So(pathTemplate(u), ShouldEqual, "/news/*/*/view")
+	})
+
+	Convey("Query shape", t, func() {
+		u, _ := url.Parse("http://host/list?sort=asc&page=2&flag&page=3")
+		So(queryShape(u), ShouldEqual, "sort&page&flag&page")
+	})
+
+	Convey("Path repeat pattern", t, func() {
+		pattern := pathRepeatPattern("a", 2)
+		So(helperMatchPattern(pattern, "/a/b/a/c/a"), ShouldBeTrue)
+		So(helperMatchPattern(pattern, "/a/a/a?q=1"), ShouldBeTrue)
+		So(helperMatchPattern(pattern, "/a/b/a"), ShouldBeFalse)
+		So(helperMatchPattern(pattern, "/ba/ba/ba"), ShouldBeFalse)
+	})
+
+	Convey("Template pattern", t, func() {
+		pattern := templatePattern("/calendar/*/*", true)
+		So(helperMatchPattern(pattern, "/calendar/2016/10?day=1"), ShouldBeTrue)
+		So(helperMatchPattern(pattern, "/calendar/2016/10"), ShouldBeFalse)
+		So(helperMatchPattern(pattern, "/calendar/2016/10/1?day=1"), ShouldBeFalse)
+
+		pattern = templatePattern("/s/*/index", false)
+		So(helperMatchPattern(pattern, "/s/sid123/index"), ShouldBeTrue)
+		So(helperMatchPattern(pattern, "/s/sid123/index?a=1"), ShouldBeFalse)
+	})
+}
+
+// TestTrapDetector ...
+func TestTrapDetector(t *testing.T) {
+	Convey("Path repeat", t, func() {
+		db := &fakeDbHost{}
+		d := helperTrapDetector(db)
+
+		_, ok := helperCheckTrap(d, "http://host/a/b/a/b")
+		So(ok, ShouldBeTrue)
+		pattern, ok := helperCheckTrap(d, "http://host/a/b/a/b/a/b")
+		So(ok, ShouldBeFalse)
+		So(len(db.traps), ShouldEqual, 1)
+		So(db.traps[0].GetPattern(), ShouldEqual, pattern)
+		So(db.traps[0].GetKind(), ShouldEqual, database.TrapPathRepeat)
+	})
+
+	Convey("Query variants", t, func() {
+		db := &fakeDbHost{}
+		d := helperTrapDetector(db)
+
+		for _, query := range []string{"a=1", "a=1&b=2", "b=2&a=1", "a=2&b=1"} {
+			_, ok := helperCheckTrap(d, "http://host/cal/2016?"+query)
+			So(ok, ShouldBeTrue)
+		}
+		_, ok := helperCheckTrap(d, "http://host/cal/2017?c=4")
+		So(ok, ShouldBeFalse)
+		So(len(db.traps), ShouldEqual, 1)
+		So(db.traps[0].GetKind(), ShouldEqual, database.TrapQueryVariants)
+		So(db.traps[0].GetHits(), ShouldEqual, 4)
+
+		// quarantined pattern
+		_, ok = helperCheckTrap(d, "http://host/cal/2018?b=1")
+		So(ok, ShouldBeFalse)
+		_, ok = helperCheckTrap(d, "http://host/cal/2018")
+		So(ok, ShouldBeTrue)
+		So(len(db.traps), ShouldEqual, 1)
+	})
+
+	Convey("Query values are not variants", t, func() {
+		db := &fakeDbHost{}
+		d := helperTrapDetector(db)
+
+		for page := 1; page <= 10; page++ {
+			_, ok := helperCheckTrap(d, fmt.Sprintf("http://host/news?page=%d&sort=date", page))
+			So(ok, ShouldBeTrue)
+		}
+		So(len(db.traps), ShouldEqual, 0)
+	})
+
+	Convey("Same content", t, func() {
+		db := &fakeDbHost{}
+		d := helperTrapDetector(db)
+
+		for _, sid := range []string{"s1", "s2", "s1"} {
+			u, _ := url.Parse("http://host/" + sid + "/index")
+			d.AddContent(1, u, u.String(), "hash")
+		}
+		So(len(db.traps), ShouldEqual, 0)
+		u, _ := url.Parse("http://host/s3/index")
+		d.AddContent(1, u, u.String(), "hash")
+		So(len(db.traps), ShouldEqual, 1)
+		So(db.traps[0].GetKind(), ShouldEqual, database.TrapSameContent)
+
+		_, ok := helperCheckTrap(d, "http://host/s4/index")
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("Quarantine is loaded from db", t, func() {
+		db := &fakeDbHost{traps: []*proxy.Trap{
+			proxy.NewTrap(1, "/print/", database.TrapSameContent, 10, "http://host/print/1")}}
+		d := helperTrapDetector(db)
+
+		pattern, ok := helperCheckTrap(d, "http://host/print/2")
+		So(ok, ShouldBeFalse)
+		So(pattern, ShouldEqual, "/print/")
+		_, ok = d.Check(2, &url.URL{Scheme: "http", Host: "host2", Path: "/print/2"}, "http://host2/print/2")
+		So(ok, ShouldBeTrue)
+	})
+
+	Convey("Trap reject reason", t, func() {
+		db := &fakeDbHost{traps: []*proxy.Trap{
+			proxy.NewTrap(1, "/print/", database.TrapSameContent, 10, "http://host1/print/1")}}
+		hostMng := &hostsManager{hosts: map[string]int64{"host1": 1}, traps: helperTrapDetector(db)}
+		u, _ := url.Parse("http://host1/print/2")
+		reason, details, ok := hostMng.CheckRules(u, u.String(), 1)
+		So(ok, ShouldBeFalse)
+		So(reason, ShouldEqual, database.RejectTrap)
+		So(details, ShouldEqual, "/print/")
+	})
+}
+
+// TestTrapsReport ...
+func TestTrapsReport(t *testing.T) {
+	Convey("Report in format of exclude rules", t, func() {
+		db := &fakeDbHost{
+			robotTxtData: "User-agent: *",
+			traps: []*proxy.Trap{
+				proxy.NewTrap(1, "/print/", database.TrapSameContent, 10, "http://host1/print/1")}}
+		buf := &bytes.Buffer{}
+		So(WriteTrapsReport(db, buf), ShouldBeNil)
+		expected := `"hostName": &crawler.HostRules{Exclude: []string{
+	"/print/", // same content, hits: 10, example: http://host1/print/1
+}},
+`
+		So(buf.String(), ShouldEqual, expected)
+	})
+}
@@ -1,13 +1,11 @@
 package crawler
 
 import (
-	"bytes"
-	"fmt"
 	"net/url"
 	"strings"
 
 	"github.com/PuerkitoBio/purell"
-	"github.com/opennota/urlesc"
+	"golang.org/x/net/idna"
 )
 
 const safeNormalizationFlags purell.NormalizationFlags = purell.FlagLowercaseScheme |
@@ -30,46 +28,87 @@ const defaultNormalizationFlags purell.NormalizationFlags = safeNormalizationFla
 	usuallySafeNormalizationFlags |
 	unsafeNormalizationFlags
 
-func removeUtmFromQuery(u *url.URL) {
-	q := u.Query()
-
-	if len(q) > 0 {
-		buf := new(bytes.Buffer)
-		for key, value := range q {
-			if key != "utm_source" &&
-				key != "utm_medium" &&
-				key != "utm_term" &&
-				key != "utm_content" &&
-				key != "utm_campaign" {
-				for _, v := range value {
-					if buf.Len() > 0 {
-						_, _ = buf.WriteRune('&')
-					}
-					_, _ = buf.WriteString(fmt.Sprintf("%s=%s", key, urlesc.QueryEscape(v)))
-				}
-			}
+// splitHostPort - split "host:port" to host and port ("" - without port), IPv6 host is kept in brackets
+func splitHostPort(hostPort string) (string, string) {
+	if strings.HasPrefix(hostPort, "[") {
+		end := strings.Index(hostPort, "]")
+		if end != -1 && strings.HasPrefix(hostPort[end+1:], ":") {
+			return hostPort[:end+1], hostPort[end+2:]
 		}
+		return hostPort, ""
+	}
+	if pos := strings.LastIndex(hostPort, ":"); pos != -1 {
+		return hostPort[:pos], hostPort[pos+1:]
+	}
+
+	return hostPort, ""
+}
 
-		// Rebuild the raw query string
-		u.RawQuery = buf.String()
+// hostToASCII - convert host name to lowercase ASCII (punycode) form without trailing dot
+func hostToASCII(hostName string) string {
+	result := strings.TrimSuffix(strings.ToLower(hostName), ".")
+	ascii, err := idna.ToASCII(result)
+	if err != nil {
+		return result
 	}
+
+	return ascii
 }
 
-// NormalizeURL - nomalize URL
+// normalizeURLHost - convert host of URL to ASCII (punycode) form without trailing dot, port is kept
+func normalizeURLHost(hostPort string) string {
+	hostName, port := splitHostPort(hostPort)
+	if port == "" {
+		return hostToASCII(hostName)
+	}
+
+	return hostToASCII(hostName) + ":" + port
+}
+
+// NormalizeURL - nomalize URL, query parameters are removed by default policy
 func NormalizeURL(u *url.URL) string {
-	removeUtmFromQuery(u)
+	return normalizeURL(u, defaultQueryPolicy)
+}
+
+// normalizeURL - normalize URL, query parameters are removed by policy
+func normalizeURL(u *url.URL, policy *queryPolicy) string {
+	u.Host = normalizeURLHost(u.Host)
+	filterQuery(u, policy)
 	return purell.NormalizeURL(u, defaultNormalizationFlags)
 }
 
-// NormalizeHostName - normalize host name
+// NormalizeHostName - normalize host name: trailing dot and "www." are removed,
+// internationalized name is converted to ASCII (punycode) form, port is kept
 func NormalizeHostName(hostName string) string {
-	result := hostName
-	if len(result) > 0 {
-		result = strings.ToLower(result)
-	}
-	if len(result) > 0 && strings.HasPrefix(strings.ToLower(result), "www.") {
+	name, port := splitHostPort(hostName)
+	result := hostToASCII(name)
+	if strings.HasPrefix(result, "www.") {
 		result = result[4:]
 	}
+	if port != "" {
+		result = result + ":" + port
+	}
+
+	return result
+}
+
+// urlHostName - normalized host name of URL, default port of URL scheme (80 for http, 443 for https) is removed
+func urlHostName(u *url.URL) string {
+	name, port := splitHostPort(u.Host)
+	scheme := strings.ToLower(u.Scheme)
+	if (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		return NormalizeHostName(name)
+	}
+
+	return NormalizeHostName(u.Host)
+}
+
+// DisplayHostName - get Unicode form of host name for display
+func DisplayHostName(hostName string) string {
+	result, err := idna.ToUnicode(hostName)
+	if err != nil {
+		return hostName
+	}
 
 	return result
 }
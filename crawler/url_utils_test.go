@@ -16,6 +16,40 @@ func TestNormalizeHostName(t *testing.T) {
 		So(NormalizeHostName("www.server1"), ShouldEqual, "server1")
 		So(NormalizeHostName("www"), ShouldEqual, "www")
 	})
+
+	Convey("Normalize internationalized host name", t, func() {
+		So(NormalizeHostName("пример.рф"), ShouldEqual, "xn--e1afmkfd.xn--p1ai")
+		So(NormalizeHostName("ПРИМЕР.РФ"), ShouldEqual, "xn--e1afmkfd.xn--p1ai")
+		So(NormalizeHostName("xn--e1afmkfd.xn--p1ai"), ShouldEqual, "xn--e1afmkfd.xn--p1ai")
+		So(NormalizeHostName("www.пример.рф"), ShouldEqual, "xn--e1afmkfd.xn--p1ai")
+		So(DisplayHostName("xn--e1afmkfd.xn--p1ai"), ShouldEqual, "пример.рф")
+		So(DisplayHostName("server1"), ShouldEqual, "server1")
+	})
+
+	Convey("Normalize host name with trailing dot and port", t, func() {
+		So(NormalizeHostName("server1."), ShouldEqual, "server1")
+		So(NormalizeHostName("www.server1.:80"), ShouldEqual, "server1:80")
+		So(NormalizeHostName("server1:8080"), ShouldEqual, "server1:8080")
+		So(NormalizeHostName("пример.рф.:8080"), ShouldEqual, "xn--e1afmkfd.xn--p1ai:8080")
+		So(NormalizeHostName("[::1]:8080"), ShouldEqual, "[::1]:8080")
+	})
+
+	Convey("Only default port of URL scheme is removed", t, func() {
+		for in, out := range map[string]string{
+			"http://www.server1.:80/": "server1",
+			"https://server1:443/":    "server1",
+			"HTTPS://server1:443/":    "server1",
+			"http://server1:443/":     "server1:443",
+			"https://server1:80/":     "server1:80",
+			"http://пример.рф.:8080/": "xn--e1afmkfd.xn--p1ai:8080",
+			"http://[::1]:80/":        "[::1]",
+			"https://[::1]:80/":       "[::1]:80",
+		} {
+			u, err := url.Parse(in)
+			So(err, ShouldBeNil)
+			So(urlHostName(u), ShouldEqual, out)
+		}
+	})
 }
 
 func helperNormalizeURL(in string, out string) {
@@ -29,6 +63,9 @@ func TestNormalizeURL(t *testing.T) {
 	Convey("Normalize URL", t, func() {
 		helperNormalizeURL("", "")
 		helperNormalizeURL("http://SeRvEr1", "http://server1")
+		helperNormalizeURL("http://пример.рф./path", "http://xn--e1afmkfd.xn--p1ai/path")
+		helperNormalizeURL("http://server1.:8080/", "http://server1:8080/")
+		helperNormalizeURL("https://server1:443/", "https://server1/")
 	})
 
 	Convey("Remove utm", t, func() {
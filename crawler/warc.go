@@ -0,0 +1,345 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ReanGD/go-web-search/proxy"
+	"github.com/ReanGD/go-web-search/werrors"
+	"github.com/uber-go/zap"
+)
+
+const (
+	warcVersion = "WARC/1.1"
+	// warcDateFormat - format of WARC-Date (UTC)
+	warcDateFormat = "2006-01-02T15:04:05Z"
+	// warcFileDateFormat - format of file creation time in file name
+	warcFileDateFormat = "20060102150405"
+)
+
+// warcField - named field of WARC record header, order of fields is kept
+type warcField struct {
+	name  string
+	value string
+}
+
+// warcRecord - WARC record, block is written as is
+type warcRecord struct {
+	recordType  string
+	id          string
+	contentType string
+	fields      []warcField
+	block       []byte
+}
+
+// newWarcRecordID - random record ID in format <urn:uuid:...>
+func newWarcRecordID() (string, error) {
+	var uuid [16]byte
+	_, err := rand.Read(uuid[:])
+	if err != nil {
+		return "", err
+	}
+	// version 4, variant RFC 4122
+	uuid[6] = (uuid[6] & 0x0f) | 0x40
+	uuid[8] = (uuid[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:]), nil
+}
+
+// warcDigest - digest in format of WARC-Block-Digest and WARC-Payload-Digest
+func warcDigest(data []byte) string {
+	sum := sha1.Sum(data)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+// Bytes - record in wire format
+func (r *warcRecord) Bytes(date time.Time) []byte {
+	var buf bytes.Buffer
+	_, _ = buf.WriteString(warcVersion + "\r\n")
+	fields := append([]warcField{
+		{"WARC-Type", r.recordType},
+		{"WARC-Record-ID", r.id},
+		{"WARC-Date", date.UTC().Format(warcDateFormat)}},
+		r.fields...)
+	fields = append(fields,
+		warcField{"WARC-Block-Digest", warcDigest(r.block)},
+		warcField{"Content-Type", r.contentType},
+		warcField{"Content-Length", strconv.Itoa(len(r.block))})
+	for _, field := range fields {
+		_, _ = buf.WriteString(field.name + ": " + field.value + "\r\n")
+	}
+	_, _ = buf.WriteString("\r\n")
+	_, _ = buf.Write(r.block)
+	_, _ = buf.WriteString("\r\n\r\n")
+
+	return buf.Bytes()
+}
+
+// warcBody - response body, that keeps read bytes for WARC response record
+type warcBody struct {
+	body io.ReadCloser
+	buf  bytes.Buffer
+	eof  bool
+}
+
+func newWarcBody(body io.ReadCloser) *warcBody {
+	return &warcBody{body: body}
+}
+
+func (b *warcBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	_, _ = b.buf.Write(p[:n])
+	if err == io.EOF {
+		b.eof = true
+	}
+
+	return n, err
+}
+
+func (b *warcBody) Close() error {
+	return b.body.Close()
+}
+
+// warcExchange - HTTP exchange of one hop of request.get
+// body - read part of response body, complete - body was read until EOF
+// truncated - body was cut by size limits (WARC-Truncated: length)
+type warcExchange struct {
+	response  *http.Response
+	body      []byte
+	complete  bool
+	truncated bool
+	fetchedAt time.Time
+	duration  time.Duration
+	meta      *proxy.Meta
+}
+
+// warcRedactedHeaders - request headers with credentials and session values, their values are not written
+var warcRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+func warcRequestBlock(request *http.Request) []byte {
+	header := make(http.Header, len(request.Header))
+	copyHeader(header, request.Header)
+	for _, name := range warcRedactedHeaders {
+		if _, ok := header[name]; ok {
+			header[name] = []string{"redacted"}
+		}
+	}
+
+	var buf bytes.Buffer
+	_, _ = fmt.Fprintf(&buf, "%s %s HTTP/1.1\r\nHost: %s\r\n", request.Method, request.URL.RequestURI(), request.URL.Host)
+	_ = header.Write(&buf)
+	_, _ = buf.WriteString("\r\n")
+
+	return buf.Bytes()
+}
+
+func warcResponseBlock(response *http.Response, body []byte) []byte {
+	var buf bytes.Buffer
+	_, _ = fmt.Fprintf(&buf, "%s %s\r\n", response.Proto, response.Status)
+	_ = response.Header.Write(&buf)
+	_, _ = buf.WriteString("\r\n")
+	_, _ = buf.Write(body)
+
+	return buf.Bytes()
+}
+
+// warcMetadataBlock - crawl information in format application/warc-fields:
+// redirect chain (from requested URL), state of page and download duration
+func warcMetadataBlock(exchange *warcExchange) []byte {
+	var chain []*proxy.Meta
+	for it := exchange.meta.GetReferer(); it != nil; it = it.GetReferer() {
+		chain = append([]*proxy.Meta{it}, chain...)
+	}
+
+	var buf bytes.Buffer
+	for _, hop := range chain {
+		_, _ = fmt.Fprintf(&buf, "redirect: %d %s\r\n", hop.GetStatusCode().Int64, hop.GetURL())
+	}
+	_, _ = fmt.Fprintf(&buf, "depth: %d\r\n", exchange.meta.GetDepth())
+	_, _ = fmt.Fprintf(&buf, "state: %d\r\n", exchange.meta.GetState())
+	_, _ = fmt.Fprintf(&buf, "fetchTimeMs: %d\r\n", int64(exchange.duration/time.Millisecond))
+
+	return buf.Bytes()
+}
+
+// warcCounter - count bytes written to file
+type warcCounter struct {
+	w    io.Writer
+	size int64
+}
+
+func (c *warcCounter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.size += int64(n)
+
+	return n, err
+}
+
+// warcWriter - write HTTP exchanges to WARC files, every record is separate gzip member,
+// new file is created when size of current file exceeds maxSize
+type warcWriter struct {
+	mu      sync.Mutex
+	dir     string
+	prefix  string
+	maxSize int64
+	now     func() time.Time
+	serial  int
+	file    *os.File
+	counter *warcCounter
+}
+
+// newWarcWriter - create warcWriter, returns nil if WARC output is disabled
+func newWarcWriter(cfg *Config) (*warcWriter, error) {
+	if cfg.WarcDir == "" {
+		return nil, nil
+	}
+	err := os.MkdirAll(cfg.WarcDir, 0755)
+	if err != nil {
+		return nil, werrors.NewFields(ErrWriteWarc,
+			zap.String("details", err.Error()),
+			zap.String("dir", cfg.WarcDir))
+	}
+
+	return &warcWriter{dir: cfg.WarcDir, prefix: cfg.WarcPrefix, maxSize: cfg.WarcMaxFileSize, now: cfg.now()}, nil
+}
+
+func (w *warcWriter) closeFile() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	w.counter = nil
+
+	return err
+}
+
+// rotate - create new file with warcinfo record, if there is no file or file size exceeds limit
+func (w *warcWriter) rotate(now time.Time) error {
+	if w.file != nil && (w.maxSize <= 0 || w.counter.size < w.maxSize) {
+		return nil
+	}
+	err := w.closeFile()
+	if err != nil {
+		return err
+	}
+
+	w.serial++
+	name := fmt.Sprintf("%s-%s-%05d.warc.gz", w.prefix, now.UTC().Format(warcFileDateFormat), w.serial)
+	file, err := os.OpenFile(filepath.Join(w.dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	w.file = file
+	w.counter = &warcCounter{w: file}
+
+	id, err := newWarcRecordID()
+	if err != nil {
+		return err
+	}
+	info := &warcRecord{
+		recordType:  "warcinfo",
+		id:          id,
+		contentType: "application/warc-fields",
+		fields:      []warcField{{"WARC-Filename", name}},
+		block: []byte("software: go-web-search\r\nformat: WARC File Format 1.1\r\n" +
+			"conformsTo: http://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/\r\n")}
+
+	return w.write(info, now)
+}
+
+// write - write record as separate gzip member
+func (w *warcWriter) write(record *warcRecord, date time.Time) error {
+	gz := gzip.NewWriter(w.counter)
+	_, err := gz.Write(record.Bytes(date))
+	if err != nil {
+		return err
+	}
+
+	return gz.Close()
+}
+
+// WriteExchange - write request, response and metadata records, returns WARC-Record-ID of response record
+func (w *warcWriter) WriteExchange(exchange *warcExchange) (string, error) {
+	response := exchange.response
+	ids := make([]string, 3)
+	for i := range ids {
+		id, err := newWarcRecordID()
+		if err != nil {
+			return "", werrors.NewDetails(ErrWriteWarc, err)
+		}
+		ids[i] = id
+	}
+	responseID, requestID, metadataID := ids[0], ids[1], ids[2]
+
+	targetURI := response.Request.URL.String()
+	responseFields := []warcField{
+		{"WARC-Target-URI", targetURI},
+		{"WARC-Payload-Digest", warcDigest(exchange.body)}}
+	if exchange.truncated {
+		responseFields = append(responseFields, warcField{"WARC-Truncated", "length"})
+	} else if !exchange.complete {
+		responseFields = append(responseFields, warcField{"WARC-Truncated", "unspecified"})
+	}
+	records := []*warcRecord{{
+		recordType:  "response",
+		id:          responseID,
+		contentType: "application/http;msgtype=response",
+		fields:      responseFields,
+		block:       warcResponseBlock(response, exchange.body),
+	}, {
+		recordType:  "request",
+		id:          requestID,
+		contentType: "application/http;msgtype=request",
+		fields:      []warcField{{"WARC-Target-URI", targetURI}, {"WARC-Concurrent-To", responseID}},
+		block:       warcRequestBlock(response.Request),
+	}, {
+		recordType:  "metadata",
+		id:          metadataID,
+		contentType: "application/warc-fields",
+		fields:      []warcField{{"WARC-Target-URI", targetURI}, {"WARC-Concurrent-To", responseID}},
+		block:       warcMetadataBlock(exchange),
+	}}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	err := w.rotate(w.now())
+	if err == nil {
+		for _, record := range records {
+			err = w.write(record, exchange.fetchedAt)
+			if err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return "", werrors.NewFields(ErrWriteWarc,
+			zap.String("details", err.Error()),
+			zap.String("url", targetURI))
+	}
+
+	return responseID, nil
+}
+
+// Close - close current file
+func (w *warcWriter) Close() error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.closeFile()
+}
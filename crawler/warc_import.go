@@ -0,0 +1,331 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ReanGD/go-web-search/content"
+	"github.com/ReanGD/go-web-search/proxy"
+	"github.com/ReanGD/go-web-search/werrors"
+	"github.com/uber-go/zap"
+)
+
+// warcURLKey - key of URL in archive (normalized URL)
+func warcURLKey(u *url.URL) string {
+	copyURL := *u
+	return NormalizeURL(&copyURL)
+}
+
+// warcResponseTarget - target URL of response record (nil - record is not HTTP response)
+func warcResponseTarget(record *warcRecord) *url.URL {
+	if record.recordType != "response" || !strings.HasPrefix(record.contentType, "application/http") {
+		return nil
+	}
+	u, err := url.Parse(record.Field("WARC-Target-URI"))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil
+	}
+
+	return u
+}
+
+// readWarcResponse - parse block of response record
+func readWarcResponse(block []byte, request *http.Request) (*http.Response, error) {
+	return http.ReadResponse(bufio.NewReader(bytes.NewReader(block)), request)
+}
+
+// warcArchive - index of responses from WARC files and transport, that serves archived responses
+// redirects and robots.txt are kept in memory, other responses are served while they are imported
+type warcArchive struct {
+	// redirects - map[URL]block of response with redirect
+	redirects map[string][]byte
+	// sources - map[redirect target]redirected URLs
+	sources map[string][]string
+	// robots - map[URL]block of response for robots.txt
+	robots map[string][]byte
+	// baseURLs - map[hostName]base URL of host (origin of first archived response)
+	baseURLs map[string]string
+	// current - map[URL]block of response, that is imported now
+	current map[string][]byte
+}
+
+func newWarcArchive() *warcArchive {
+	return &warcArchive{
+		redirects: make(map[string][]byte),
+		sources:   make(map[string][]string),
+		robots:    make(map[string][]byte),
+		baseURLs:  make(map[string]string),
+		current:   make(map[string][]byte)}
+}
+
+// readWarcFile - call fn for every HTTP response record of file
+func readWarcFile(path string, fn func(record *warcRecord, target *url.URL) error) error {
+	reader, err := openWarcFile(path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if target := warcResponseTarget(record); target != nil {
+			err = fn(record, target)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// isFinal - response is imported as page (not redirect and not robots.txt)
+func (a *warcArchive) isFinal(key string) bool {
+	_, isRedirect := a.redirects[key]
+	_, isRobots := a.robots[key]
+
+	return !isRedirect && !isRobots
+}
+
+// Scan - add redirects, robots.txt and base URLs of hosts from file to index
+func (a *warcArchive) Scan(path string) error {
+	return readWarcFile(path, func(record *warcRecord, target *url.URL) error {
+		response, err := readWarcResponse(record.block, nil)
+		if err != nil {
+			log.Printf("WARN: Parse archived response %s, message: %s", target, err)
+			return nil
+		}
+		key := warcURLKey(target)
+		hostName := urlHostName(target)
+		if _, ok := a.baseURLs[hostName]; !ok {
+			a.baseURLs[hostName] = originFromURL(target).URL(hostName, "")
+		}
+
+		location := response.Header.Get("Location")
+		if response.StatusCode >= 300 && response.StatusCode < 400 && location != "" {
+			locationURL, err := target.Parse(location)
+			if err != nil {
+				log.Printf("WARN: Parse redirect location %s of %s, message: %s", location, target, err)
+				return nil
+			}
+			a.redirects[key] = record.block
+			if locationKey := warcURLKey(locationURL); locationKey != key {
+				a.sources[locationKey] = append(a.sources[locationKey], key)
+			}
+		} else if target.Path == "/robots.txt" {
+			a.robots[key] = record.block
+		}
+
+		return nil
+	})
+}
+
+// Roots - requested URLs of redirect chains, that end with URL (URL itself, if it is not redirect target)
+func (a *warcArchive) Roots(key string) []string {
+	var result []string
+	visited := map[string]bool{key: true}
+	queue := []string{key}
+	for len(queue) != 0 {
+		current := queue[0]
+		queue = queue[1:]
+		sources := a.sources[current]
+		if len(sources) == 0 {
+			result = append(result, current)
+		}
+		for _, source := range sources {
+			if !visited[source] {
+				visited[source] = true
+				queue = append(queue, source)
+			}
+		}
+	}
+
+	return result
+}
+
+// RobotsTxt - archived robots.txt of base URL (404 - not archived, all URLs are allowed)
+func (a *warcArchive) RobotsTxt(hostName string, baseURL string) (int, []byte) {
+	parsed, err := url.Parse(baseURL)
+	if err != nil {
+		log.Printf("WARN: Parse base URL %s of host %s, message: %s", baseURL, hostName, err)
+		return http.StatusNotFound, nil
+	}
+	block, ok := a.robots[originFromURL(parsed).URL(hostName, "robots.txt")]
+	if !ok {
+		log.Printf("WARN: robots.txt of host %s not found in archive, all URLs are allowed", hostName)
+		return http.StatusNotFound, nil
+	}
+
+	response, err := readWarcResponse(block, nil)
+	if err == nil {
+		var body []byte
+		body, _, err = readBody(getContentEncoding(&response.Header), response.Body, nil)
+		if err == nil {
+			return response.StatusCode, body
+		}
+	}
+	log.Printf("WARN: Read archived robots.txt of host %s, all URLs are allowed, message: %s", hostName, err)
+
+	return http.StatusNotFound, nil
+}
+
+// RoundTrip - implementation of http.RoundTripper, serves archived responses
+func (a *warcArchive) RoundTrip(request *http.Request) (*http.Response, error) {
+	if request.Body != nil {
+		_ = request.Body.Close()
+	}
+	key := warcURLKey(request.URL)
+	block, ok := a.current[key]
+	if !ok {
+		block, ok = a.redirects[key]
+	}
+	if !ok {
+		return nil, werrors.NewFields(ErrReplayExchange,
+			zap.String("details", "URL not found in archive"),
+			zap.String("url", request.URL.String()))
+	}
+
+	return readWarcResponse(block, request)
+}
+
+// warcImporter - process archived responses by request like in live crawl
+type warcImporter struct {
+	archive *warcArchive
+	hostMng *hostsManager
+	request *request
+	// fetchedAt - WARC-Date of imported response, clock of importer
+	fetchedAt time.Time
+	imported  int
+	skipped   int
+}
+
+// Import - process final responses of file with redirect chains, that end with them
+func (i *warcImporter) Import(path string, chDB chan<- *proxy.PageData) error {
+	return readWarcFile(path, func(record *warcRecord, target *url.URL) error {
+		key := warcURLKey(target)
+		if !i.archive.isFinal(key) {
+			return nil
+		}
+		fetchedAt, err := time.Parse(time.RFC3339, record.Field("WARC-Date"))
+		if err != nil {
+			fetchedAt = time.Now()
+		}
+		i.fetchedAt = fetchedAt
+		i.archive.current = map[string][]byte{key: record.block}
+
+		for _, root := range i.archive.Roots(key) {
+			u, err := url.Parse(root)
+			if err != nil {
+				continue
+			}
+			// only URLs of known hosts are requested in live crawl
+			if !i.hostMng.ResolveHost(urlHostName(u)).Valid {
+				i.skipped++
+				continue
+			}
+			data, _ := i.request.Process(u, &content.Task{})
+			chDB <- data
+			i.imported++
+		}
+
+		return nil
+	})
+}
+
+// newWarcImporter - scan WARC files and init hosts from cfg.BaseHosts by archive
+func newWarcImporter(db proxy.DbHost, logger zap.Logger, cfg *Config, files []string) (*warcImporter, error) {
+	rules, err := newRulesByHost(cfg.HostRules)
+	if err != nil {
+		return nil, err
+	}
+
+	archive := newWarcArchive()
+	for _, path := range files {
+		err = archive.Scan(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	importer := &warcImporter{archive: archive, fetchedAt: time.Now()}
+	importCfg := *cfg
+	importCfg.Clock = func() time.Time { return importer.fetchedAt }
+	importCfg.RetryMaxAttempts = 0
+	importCfg.MetaRefreshMaxDelay = -1
+
+	hostMng := &hostsManager{
+		identity: cfg.Identity,
+		rules:    rules,
+		queries:  newQueryPolicies(cfg.QueryPolicies),
+		traps:    newTrapDetector(db, cfg),
+		client:   &http.Client{Transport: archive},
+		now:      importCfg.now()}
+	err = hostMng.Init(db, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, hostNameRaw := range cfg.BaseHosts {
+		hostName := NormalizeHostName(hostNameRaw)
+		baseURL, ok := archive.baseURLs[hostName]
+		if hostMng.ResolveHost(hostName).Valid || !ok {
+			continue
+		}
+		statusCode, body := archive.RobotsTxt(hostName, baseURL)
+		_, err = hostMng.AddArchivedHost(db, hostName, baseURL, statusCode, body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	importer.hostMng = hostMng
+	importer.request = &request{
+		hostMng:         hostMng,
+		politeness:      newPoliteness(hostMng, 0, &importCfg),
+		retry:           newRetryPolicy(&importCfg),
+		recrawl:         newRecrawlScheduler(&importCfg),
+		limits:          newBodyLimits(&importCfg),
+		refreshMaxDelay: importCfg.MetaRefreshMaxDelay}
+	importer.request.Init(logger, archive, nil)
+
+	return importer, nil
+}
+
+// ImportWarc - import archived responses from WARC files through parser pipeline to db without network,
+// hosts from cfg.BaseHosts are mapped like in live crawl, robots.txt and base URL of new host
+// are taken from archive, targets of meta refresh are saved as links
+func ImportWarc(db *content.DBrw, logger zap.Logger, cfg *Config, files []string) error {
+	importer, err := newWarcImporter(db, logger, cfg, files)
+	if err != nil {
+		return err
+	}
+
+	var wgDB sync.WaitGroup
+	chDB := make(chan *proxy.PageData, dbQueueSize)
+	dbWorker := content.DBWorker{DB: db, ChDB: chDB}
+	wgDB.Add(1)
+	go dbWorker.Start(&wgDB)
+
+	for _, path := range files {
+		err = importer.Import(path, chDB)
+		if err != nil {
+			break
+		}
+	}
+	close(chDB)
+	wgDB.Wait()
+	log.Printf("INFO: Imported %d pages from archive, skipped %d pages of unknown hosts",
+		importer.imported, importer.skipped)
+
+	return err
+}
@@ -0,0 +1,153 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ReanGD/go-web-search/database"
+	"github.com/ReanGD/go-web-search/proxy"
+	"github.com/uber-go/zap"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func helperWarcResponse(urlStr string, response string) *warcRecord {
+	return &warcRecord{
+		recordType:  "response",
+		id:          "<urn:uuid:" + urlStr + ">",
+		contentType: "application/http;msgtype=response",
+		fields:      []warcField{{"WARC-Target-URI", urlStr}},
+		block:       []byte(response)}
+}
+
+func helperWriteWarc(path string, compress bool, records []*warcRecord) {
+	date := time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	for _, record := range records {
+		if compress {
+			gz := gzip.NewWriter(&buf)
+			_, err := gz.Write(record.Bytes(date))
+			So(err, ShouldBeNil)
+			So(gz.Close(), ShouldBeNil)
+		} else {
+			_, err := buf.Write(record.Bytes(date))
+			So(err, ShouldBeNil)
+		}
+	}
+	So(ioutil.WriteFile(path, buf.Bytes(), 0644), ShouldBeNil)
+}
+
+func helperHTMLResponse(body string) string {
+	return "HTTP/1.1 200 OK\r\nContent-Type: text/html\r\n" +
+		"Content-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n" + body
+}
+
+// TestWarcReader ...
+func TestWarcReader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	records := []*warcRecord{
+		helperWarcResponse("http://host/a", helperHTMLResponse("<html>a</html>")),
+		{recordType: "metadata", id: "<urn:uuid:2>", contentType: "application/warc-fields",
+			fields: []warcField{{"WARC-Concurrent-To", "<urn:uuid:1>"}}, block: []byte("a: b\r\n")}}
+
+	for _, compress := range []bool{false, true} {
+		Convey("Read written records", t, func() {
+			path := filepath.Join(dir, "test.warc")
+			helperWriteWarc(path, compress, records)
+			reader, err := openWarcFile(path)
+			So(err, ShouldBeNil)
+			defer reader.Close()
+
+			for _, expected := range records {
+				record, err := reader.Next()
+				So(err, ShouldBeNil)
+				So(record.recordType, ShouldEqual, expected.recordType)
+				So(record.id, ShouldEqual, expected.id)
+				So(record.contentType, ShouldEqual, expected.contentType)
+				So(string(record.block), ShouldEqual, string(expected.block))
+				So(record.Field("warc-date"), ShouldEqual, "2016-10-01T12:00:00Z")
+				for _, field := range expected.fields {
+					So(record.Field(field.name), ShouldEqual, field.value)
+				}
+			}
+			_, err = reader.Next()
+			So(err, ShouldEqual, io.EOF)
+		})
+	}
+
+	Convey("Wrong record", t, func() {
+		path := filepath.Join(dir, "wrong.warc")
+		So(ioutil.WriteFile(path, []byte("WARC/1.1\r\nContent-Length: 100\r\n\r\nshort"), 0644), ShouldBeNil)
+		reader, err := openWarcFile(path)
+		So(err, ShouldBeNil)
+		defer reader.Close()
+		_, err = reader.Next()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, ErrReadWarc)
+	})
+}
+
+// TestWarcImport ...
+func TestWarcImport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	Convey("Import archived pages with redirects and robots.txt", t, func() {
+		path := filepath.Join(dir, "import.warc.gz")
+		helperWriteWarc(path, true, []*warcRecord{
+			helperWarcResponse("http://testhost/robots.txt",
+				helperHTMLResponse("User-agent: *\nDisallow: /private\n")),
+			helperWarcResponse("http://testhost/old",
+				"HTTP/1.1 301 Moved Permanently\r\nLocation: /new\r\nContent-Length: 0\r\n\r\n"),
+			helperWarcResponse("http://testhost/new", helperHTMLResponse(
+				"<html><head><title>new</title></head><body>text <a href=\"/link\">link</a></body></html>")),
+			helperWarcResponse("http://testhost/private", helperHTMLResponse(
+				"<html><head><title>private</title></head><body>text</body></html>")),
+			helperWarcResponse("http://otherhost/page", helperHTMLResponse(
+				"<html><head><title>other</title></head><body>text</body></html>"))})
+
+		cfg := NewConfig([]string{"testhost", "missinghost"}, 0)
+		importer, err := newWarcImporter(&fakeDbHost{}, zap.NewJSON(zap.DebugLevel, zap.Output(zap.AddSync(&bytes.Buffer{}))),
+			cfg, []string{path})
+		So(err, ShouldBeNil)
+		So(importer.hostMng.GetHosts(), ShouldResemble, map[string]int64{"testhost": 1})
+
+		chDB := make(chan *proxy.PageData, 10)
+		So(importer.Import(path, chDB), ShouldBeNil)
+		close(chDB)
+		So(importer.imported, ShouldEqual, 2)
+		So(importer.skipped, ShouldEqual, 1)
+
+		page := <-chDB
+		meta := page.GetMeta()
+		So(meta.GetURL(), ShouldEqual, "http://testhost/new")
+		So(meta.GetState(), ShouldEqual, database.StateSuccess)
+		So(meta.GetContent(), ShouldNotBeNil)
+		So(meta.GetReferer().GetURL(), ShouldEqual, "http://testhost/old")
+		So(meta.GetReferer().IsPermanentRedirect(), ShouldBeTrue)
+		_, ok := page.GetURLs()["http://testhost/link"]
+		So(ok, ShouldBeTrue)
+		fetchedAt := meta.GetMeta(1).FetchedAt
+		So(fetchedAt, ShouldNotBeNil)
+		So(*fetchedAt, ShouldResemble, time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC))
+
+		page = <-chDB
+		So(page.GetMeta().GetURL(), ShouldEqual, "http://testhost/private")
+		So(page.GetMeta().GetState(), ShouldEqual, database.StateDisabledByRobotsTxt)
+	})
+}
@@ -0,0 +1,133 @@
+package crawler
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ReanGD/go-web-search/werrors"
+	"github.com/uber-go/zap"
+)
+
+// Field - get value of header field, name is case insensitive ("" - not found)
+func (r *warcRecord) Field(name string) string {
+	for _, field := range r.fields {
+		if strings.EqualFold(field.name, name) {
+			return field.value
+		}
+	}
+
+	return ""
+}
+
+// warcReader - sequential reader of records from WARC file (gzip compressed or not)
+type warcReader struct {
+	path   string
+	file   *os.File
+	reader *bufio.Reader
+}
+
+// openWarcFile - open WARC file, gzip is detected by signature
+func openWarcFile(path string) (*warcReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, werrors.NewFields(ErrReadWarc,
+			zap.String("details", err.Error()),
+			zap.String("file", path))
+	}
+
+	result := &warcReader{path: path, file: file, reader: bufio.NewReader(file)}
+	signature, err := result.reader.Peek(2)
+	if err == nil && signature[0] == 0x1f && signature[1] == 0x8b {
+		// gzip reader reads all members of file (every record is separate member usually)
+		gz, err := gzip.NewReader(result.reader)
+		if err != nil {
+			_ = file.Close()
+			return nil, werrors.NewFields(ErrReadWarc,
+				zap.String("details", err.Error()),
+				zap.String("file", path))
+		}
+		result.reader = bufio.NewReader(gz)
+	}
+
+	return result, nil
+}
+
+func (r *warcReader) newError(details string) error {
+	return werrors.NewFields(ErrReadWarc,
+		zap.String("details", details),
+		zap.String("file", r.path))
+}
+
+func (r *warcReader) readLine() (string, error) {
+	line, err := r.reader.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+// Next - read next record, returns io.EOF after last record
+func (r *warcReader) Next() (*warcRecord, error) {
+	version := ""
+	var err error
+	for version == "" {
+		version, err = r.readLine()
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, r.newError(err.Error())
+		}
+	}
+	if !strings.HasPrefix(version, "WARC/") {
+		return nil, r.newError("wrong version line: " + version)
+	}
+
+	record := &warcRecord{}
+	for {
+		line, err := r.readLine()
+		if err != nil {
+			return nil, r.newError(err.Error())
+		}
+		if line == "" {
+			break
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(record.fields) != 0 {
+			// continuation of previous field
+			record.fields[len(record.fields)-1].value += " " + strings.TrimSpace(line)
+			continue
+		}
+		pos := strings.Index(line, ":")
+		if pos < 0 {
+			return nil, r.newError("wrong header field: " + line)
+		}
+		record.fields = append(record.fields, warcField{
+			name:  strings.TrimSpace(line[:pos]),
+			value: strings.TrimSpace(line[pos+1:])})
+	}
+
+	record.recordType = record.Field("WARC-Type")
+	record.id = record.Field("WARC-Record-ID")
+	record.contentType = record.Field("Content-Type")
+	length, err := strconv.ParseInt(record.Field("Content-Length"), 10, 64)
+	if err != nil || length < 0 {
+		return nil, r.newError("wrong Content-Length of record " + record.id)
+	}
+	record.block = make([]byte, length)
+	_, err = io.ReadFull(r.reader, record.block)
+	if err != nil {
+		return nil, r.newError(err.Error())
+	}
+
+	return record, nil
+}
+
+// Close - close file
+func (r *warcReader) Close() error {
+	return r.file.Close()
+}
@@ -0,0 +1,199 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ReanGD/go-web-search/content"
+	"github.com/ReanGD/go-web-search/database"
+	"github.com/temoto/robotstxt-go"
+	"github.com/uber-go/zap"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func helperReadWarcFiles(dir string) []string {
+	files, err := filepath.Glob(filepath.Join(dir, "*.warc.gz"))
+	So(err, ShouldBeNil)
+	result := make([]string, 0, len(files))
+	for _, name := range files {
+		f, err := os.Open(name)
+		So(err, ShouldBeNil)
+		gz, err := gzip.NewReader(f)
+		So(err, ShouldBeNil)
+		data, err := ioutil.ReadAll(gz)
+		So(err, ShouldBeNil)
+		So(f.Close(), ShouldBeNil)
+		result = append(result, string(data))
+	}
+
+	return result
+}
+
+func helperWarcRequest(ts *httptest.Server, cfg *Config) *request {
+	u, err := url.Parse(ts.URL)
+	So(err, ShouldBeNil)
+	robot, err := robotstxt.FromStatusAndBytes(404, nil)
+	So(err, ShouldBeNil)
+	hostMng := &hostsManager{
+		hosts:     map[string]int64{NormalizeHostName(u.Host): 1},
+		robotsTxt: map[int64]*robotstxt.Group{1: robot.FindGroup("GoWebSearch")},
+		now:       cfg.now()}
+
+	warc, err := newWarcWriter(cfg)
+	So(err, ShouldBeNil)
+	r := &request{
+		hostMng:    hostMng,
+		politeness: newPoliteness(hostMng, 1, cfg),
+		retry:      newRetryPolicy(cfg),
+		recrawl:    newRecrawlScheduler(cfg),
+		limits:     newBodyLimits(cfg),
+		warc:       warc}
+	r.Init(zap.NewJSON(zap.DebugLevel, zap.Output(zap.AddSync(&bytes.Buffer{}))), nil, nil)
+
+	return r
+}
+
+// TestWarcWriter ...
+func TestWarcWriter(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/redirect", http.RedirectHandler("/page", http.StatusMovedPermanently))
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("X-Test", "value")
+		_, _ = w.Write([]byte("<html><head><title>page</title></head><body>text</body></html>"))
+	})
+	mux.HandleFunc("/big", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<html><head><title>big</title></head><body>" + strings.Repeat("text ", 100) + "</body></html>"))
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	Convey("WARC output is disabled by default", t, func() {
+		warc, err := newWarcWriter(NewConfig(nil, 0))
+		So(err, ShouldBeNil)
+		So(warc, ShouldBeNil)
+		So(warc.Close(), ShouldBeNil)
+	})
+
+	Convey("Write request, response and metadata records", t, func() {
+		dir, err := ioutil.TempDir("", "warc")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		cfg := NewConfig(nil, 0)
+		cfg.WarcDir = dir
+		now := time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC)
+		cfg.Clock = func() time.Time { return now }
+		r := helperWarcRequest(ts, cfg)
+
+		u, err := url.Parse(ts.URL + "/redirect")
+		So(err, ShouldBeNil)
+		data, _ := r.Process(u, &content.Task{})
+		So(r.warc.Close(), ShouldBeNil)
+		meta := data.GetMeta()
+		So(meta.GetState(), ShouldEqual, database.StateSuccess)
+		recordID := meta.GetWarcRecordID()
+		So(recordID, ShouldStartWith, "<urn:uuid:")
+		So(meta.GetMeta(1).WarcRecordID, ShouldEqual, recordID)
+		redirectID := meta.GetReferer().GetWarcRecordID()
+		So(redirectID, ShouldStartWith, "<urn:uuid:")
+		So(redirectID, ShouldNotEqual, recordID)
+
+		files := helperReadWarcFiles(dir)
+		So(len(files), ShouldEqual, 1)
+		warc := files[0]
+		So(strings.Count(warc, "WARC/1.1\r\n"), ShouldEqual, 7)
+		So(warc, ShouldContainSubstring, "WARC-Type: warcinfo\r\n")
+		So(warc, ShouldContainSubstring, "WARC-Type: response\r\nWARC-Record-ID: "+recordID+"\r\n")
+		So(warc, ShouldContainSubstring, "WARC-Date: 2016-10-01T12:00:00Z\r\n")
+		So(warc, ShouldContainSubstring, "WARC-Target-URI: "+ts.URL+"/page\r\n")
+		So(warc, ShouldContainSubstring, "HTTP/1.1 200 OK\r\n")
+		So(warc, ShouldContainSubstring, "X-Test: value\r\n")
+		So(warc, ShouldContainSubstring, "<title>page</title>")
+		So(warc, ShouldContainSubstring, "GET /page HTTP/1.1\r\n")
+		So(strings.Count(warc, "WARC-Concurrent-To: "+recordID+"\r\n"), ShouldEqual, 2)
+		So(warc, ShouldContainSubstring, "redirect: 301 "+ts.URL+"/redirect\r\n")
+
+		// redirect hop has own request and response records
+		So(warc, ShouldContainSubstring, "WARC-Type: response\r\nWARC-Record-ID: "+redirectID+"\r\n")
+		So(warc, ShouldContainSubstring, "WARC-Target-URI: "+ts.URL+"/redirect\r\n")
+		So(warc, ShouldContainSubstring, "HTTP/1.1 301 Moved Permanently\r\n")
+		So(warc, ShouldContainSubstring, "Location: /page\r\n")
+		So(warc, ShouldContainSubstring, "GET /redirect HTTP/1.1\r\n")
+		So(strings.Count(warc, "WARC-Concurrent-To: "+redirectID+"\r\n"), ShouldEqual, 2)
+		So(warc, ShouldNotContainSubstring, "WARC-Truncated")
+	})
+
+	Convey("Rotation of WARC files by size", t, func() {
+		dir, err := ioutil.TempDir("", "warc")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		cfg := NewConfig(nil, 0)
+		cfg.WarcDir = dir
+		cfg.WarcMaxFileSize = 1
+		r := helperWarcRequest(ts, cfg)
+
+		u, err := url.Parse(ts.URL + "/page")
+		So(err, ShouldBeNil)
+		first, _ := r.Process(u, &content.Task{})
+		second, _ := r.Process(u, &content.Task{})
+		So(r.warc.Close(), ShouldBeNil)
+		So(first.GetMeta().GetWarcRecordID(), ShouldNotEqual, second.GetMeta().GetWarcRecordID())
+
+		files := helperReadWarcFiles(dir)
+		So(len(files), ShouldEqual, 2)
+		for _, warc := range files {
+			So(strings.Count(warc, "WARC-Type: warcinfo\r\n"), ShouldEqual, 1)
+			So(strings.Count(warc, "WARC-Type: response\r\n"), ShouldEqual, 1)
+		}
+	})
+
+	Convey("Body cut by size limit is truncated by length", t, func() {
+		dir, err := ioutil.TempDir("", "warc")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		cfg := NewConfig(nil, 0)
+		cfg.WarcDir = dir
+		cfg.MaxBodySize = 64
+		cfg.TruncateBody = true
+		r := helperWarcRequest(ts, cfg)
+
+		u, err := url.Parse(ts.URL + "/big")
+		So(err, ShouldBeNil)
+		_, _ = r.Process(u, &content.Task{})
+		So(r.warc.Close(), ShouldBeNil)
+
+		files := helperReadWarcFiles(dir)
+		So(len(files), ShouldEqual, 1)
+		So(files[0], ShouldContainSubstring, "WARC-Truncated: length\r\n")
+	})
+
+	Convey("Credentials are not written to request record", t, func() {
+		request, err := http.NewRequest("GET", ts.URL+"/page", nil)
+		So(err, ShouldBeNil)
+		request.Header.Set("Authorization", "Basic c2VjcmV0")
+		request.Header.Set("Cookie", "session=secret")
+		request.Header.Set("Accept", "text/html")
+
+		block := string(warcRequestBlock(request))
+		So(block, ShouldNotContainSubstring, "secret")
+		So(block, ShouldNotContainSubstring, "c2VjcmV0")
+		So(block, ShouldContainSubstring, "Authorization: redacted\r\n")
+		So(block, ShouldContainSubstring, "Cookie: redacted\r\n")
+		So(block, ShouldContainSubstring, "Accept: text/html\r\n")
+		So(request.Header.Get("Cookie"), ShouldEqual, "session=secret")
+	})
+}
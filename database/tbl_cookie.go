@@ -0,0 +1,19 @@
+package database
+
+import "time"
+
+// Cookie - cookie of host, saved between runs of crawler
+// URL - URL of response with header Set-Cookie (it sets scope of cookie on restore)
+// Expires - NULL for session cookie
+type Cookie struct {
+	ID       int64  `gorm:"primary_key;not null"`
+	HostID   int64  `gorm:"type:integer REFERENCES host(id);unique_index:idx_cookie;not null"`
+	Name     string `gorm:"size:255;unique_index:idx_cookie;not null"`
+	Domain   string `gorm:"size:255;unique_index:idx_cookie;not null"`
+	Path     string `gorm:"size:255;unique_index:idx_cookie;not null"`
+	URL      string `gorm:"size:2048;not null"`
+	Value    string `gorm:"size:4096"`
+	Expires  *time.Time
+	Secure   bool
+	HTTPOnly bool `gorm:"column:http_only"`
+}
@@ -1,9 +1,26 @@
 package database
 
+import "time"
+
 // Host - host information
+// Scheme, Port - preferred origin of host (Port == 0 - default port for scheme)
+// RobotsFetchedAt - time of last download of robots.txt (NULL - unknown, need download)
 type Host struct {
 	ID               int64  `gorm:"primary_key;not null"`
 	Name             string `gorm:"size:255;unique_index;not null"`
+	Scheme           string `gorm:"size:8;not null;default:'http'"`
+	Port             int    `gorm:"not null;default:0"`
 	RobotsStatusCode int    `gorm:"not null"`
 	RobotsData       []byte
+	RobotsFetchedAt  *time.Time
+}
+
+// RobotsHistory - all downloaded versions of robots.txt for host
+// FetchedAt - time of first download of this version
+type RobotsHistory struct {
+	ID         int64 `gorm:"primary_key;not null"`
+	HostID     int64 `gorm:"type:integer REFERENCES host(id);index;not null"`
+	StatusCode int   `gorm:"not null"`
+	Data       []byte
+	FetchedAt  time.Time `gorm:"not null"`
 }
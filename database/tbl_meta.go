@@ -1,6 +1,9 @@
 package database
 
-import "database/sql"
+import (
+	"database/sql"
+	"time"
+)
 
 // State - current state of page
 type State uint8
@@ -28,14 +31,48 @@ const (
 	StateExternal = 9
 	//StateNoFollow - found meta tag nofollow (body not save)
 	StateNoFollow = 10
+	//StateTooLarge - body size exceeds limit (body not save)
+	StateTooLarge = 11
+	//StateDialTimeout - timeout of connection to server
+	StateDialTimeout = 12
+	//StateTLSTimeout - timeout of TLS handshake
+	StateTLSTimeout = 13
+	//StateResponseTimeout - timeout of waiting for response headers (time to first byte)
+	StateResponseTimeout = 14
+	//StateRequestTimeout - timeout of whole request include body reading
+	StateRequestTimeout = 15
+	//StateBodyTimeout - body data was not received during idle timeout
+	StateBodyTimeout = 16
+	//StateRedirect - temporary redirect (302, 303, 307), see table "Redirect" for target (body not save)
+	StateRedirect = 17
+	//StateRedirectLoop - redirect to URL from current redirect chain (body not save)
+	StateRedirectLoop = 18
+	//StateTooManyRedirects - redirect chain is longer than limit (body not save)
+	StateTooManyRedirects = 19
 )
 
 // Meta - meta information about processed URL
 // Origin - link to origin document (for State == CtStateDublicate)
+// Canonical - canonical URL from <link rel="canonical"> or header Link (NULL - not found),
+// if canonical URL is not equal to URL, then Origin = Canonical
+// ETag, LastModified - validators from last response for conditional request
+// FetchedAt - time of last download (include answers "304 Not Modified")
+// ChangedAt - time of last detected content change
+// NextFetchAt - planned time of recrawl (nil - not recrawled)
+// RecrawlInterval - estimated interval of content changes in seconds
+// WarcRecordID - WARC-Record-ID of response record of last download (empty - WARC output disabled)
 type Meta struct {
-	URL         int64         `gorm:"type:integer REFERENCES url(id);unique_index;not null"`
-	State       State         `gorm:"not null"`
-	Origin      sql.NullInt64 `gorm:"type:integer REFERENCES url(id)"`
-	RedirectCnt int
-	StatusCode  sql.NullInt64
+	URL             int64         `gorm:"type:integer REFERENCES url(id);unique_index;not null"`
+	State           State         `gorm:"not null"`
+	Origin          sql.NullInt64 `gorm:"type:integer REFERENCES url(id)"`
+	Canonical       sql.NullInt64 `gorm:"type:integer REFERENCES url(id);index"`
+	RedirectCnt     int
+	StatusCode      sql.NullInt64
+	ETag            string `gorm:"column:etag;size:255"`
+	LastModified    string `gorm:"size:64"`
+	FetchedAt       *time.Time
+	ChangedAt       *time.Time
+	NextFetchAt     *time.Time `gorm:"index"`
+	RecrawlInterval int64
+	WarcRecordID    string `gorm:"size:64"`
 }
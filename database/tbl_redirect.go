@@ -0,0 +1,19 @@
+package database
+
+import "database/sql"
+
+// Redirect - hop of redirect chain
+// URL - redirected URL
+// Target - URL from Location header (NULL - target is not saved, for example on redirect loop)
+// StatusCode - status code of redirect response (301, 302, 303, 307, 308 or status code of page with meta refresh)
+// Location - raw value of Location header (or target URL of meta refresh)
+// Hop - position of URL in redirect chain (0 - requested URL)
+// MetaRefresh - redirect by <meta http-equiv="refresh">
+type Redirect struct {
+	URL         int64         `gorm:"type:integer REFERENCES url(id);unique_index;not null"`
+	Target      sql.NullInt64 `gorm:"type:integer REFERENCES url(id)"`
+	StatusCode  int           `gorm:"not null"`
+	Location    string        `gorm:"size:2048;not null"`
+	Hop         int           `gorm:"not null"`
+	MetaRefresh bool          `gorm:"not null;default:false"`
+}
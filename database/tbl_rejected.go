@@ -0,0 +1,30 @@
+package database
+
+import "database/sql"
+
+// RejectReason - reason of URL rejection by host rules
+type RejectReason uint8
+
+const (
+	//RejectExcluded - URL matches exclude pattern
+	RejectExcluded RejectReason = 1
+	//RejectNotIncluded - URL does not match any include pattern
+	RejectNotIncluded = 2
+	//RejectMaxDepth - click depth of URL exceeds limit
+	RejectMaxDepth = 3
+	//RejectMaxPages - count of URLs of host exceeds limit
+	RejectMaxPages = 4
+	//RejectTrap - URL matches quarantined pattern of crawler trap
+	RejectTrap = 5
+)
+
+// Rejected - URL, that was found on page and rejected by host rules
+// Details - matched pattern or exceeded limit
+// Referer - page with link to URL
+type Rejected struct {
+	URL     string        `gorm:"size:2048;not null;unique_index"`
+	HostID  sql.NullInt64 `gorm:"type:integer REFERENCES host(id);index"`
+	Reason  RejectReason  `gorm:"not null"`
+	Details string        `gorm:"size:255"`
+	Referer int64         `gorm:"type:integer REFERENCES url(id);not null"`
+}
@@ -0,0 +1,14 @@
+package database
+
+import "time"
+
+// SitemapHint - hints for URL from sitemap.xml
+// LastMod - value of <lastmod>
+// Priority - value of <priority> (0.0 - 1.0, default 0.5)
+// ChangeFreq - value of <changefreq> (always, hourly, daily, weekly, monthly, yearly, never)
+type SitemapHint struct {
+	URL        int64 `gorm:"type:integer REFERENCES url(id);unique_index;not null"`
+	LastMod    *time.Time
+	Priority   float64
+	ChangeFreq string `gorm:"size:16"`
+}
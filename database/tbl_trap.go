@@ -0,0 +1,29 @@
+package database
+
+import "time"
+
+// TrapKind - heuristic, that found crawler trap
+type TrapKind uint8
+
+const (
+	//TrapPathRepeat - segment is repeated in path many times ("/a/b/a/b/a/b")
+	TrapPathRepeat TrapKind = 1
+	//TrapQueryVariants - too many query combinations for one path template (calendars, sorting)
+	TrapQueryVariants = 2
+	//TrapSameContent - many distinct URLs of one path template with same content (session IDs)
+	TrapSameContent = 3
+)
+
+// Trap - quarantined URL pattern of host, URLs matched pattern are rejected
+// Pattern - pattern in format of crawler.HostRules
+// Hits - count of URLs, that triggered heuristic
+// Example - one of URLs matched pattern
+type Trap struct {
+	ID        int64     `gorm:"primary_key;not null"`
+	HostID    int64     `gorm:"type:integer REFERENCES host(id);unique_index:idx_trap;not null"`
+	Pattern   string    `gorm:"size:2048;unique_index:idx_trap;not null"`
+	Kind      TrapKind  `gorm:"not null"`
+	Hits      int       `gorm:"not null"`
+	Example   string    `gorm:"size:2048;not null"`
+	CreatedAt time.Time `gorm:"not null"`
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/ReanGD/go-web-search/content"
 	"github.com/ReanGD/go-web-search/crawler"
@@ -37,8 +39,56 @@ func test() error {
 	return nil
 }
 
+// stopSignal - channel closed on SIGINT or SIGTERM
+func stopSignal() <-chan struct{} {
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		signal.Stop(signals)
+		close(stop)
+	}()
+
+	return stop
+}
+
 func run(logger zap.Logger) error {
-	return crawler.Run(logger, baseHosts, 4300)
+	cfg := crawler.NewConfig(baseHosts, 4300)
+	return crawler.Run(logger, cfg, stopSignal())
+}
+
+// reportTraps - print quarantined crawler traps in format of crawler.HostRules
+func reportTraps() error {
+	db, err := content.GetDBrw()
+	if err != nil {
+		return err
+	}
+	defer ClearClose(db)
+
+	return crawler.WriteTrapsReport(db, os.Stdout)
+}
+
+// reportQueryParams - print query parameters, that never change content, in format of crawler.QueryPolicy
+func reportQueryParams() error {
+	db, err := content.GetDBrw()
+	if err != nil {
+		return err
+	}
+	defer ClearClose(db)
+
+	return crawler.WriteQueryParamsReport(db, os.Stdout)
+}
+
+// importWarc - import pages of base hosts from WARC files
+func importWarc(logger zap.Logger, files []string) error {
+	db, err := content.GetDBrw()
+	if err != nil {
+		return err
+	}
+	defer ClearClose(db)
+
+	return crawler.ImportWarc(db, logger, crawler.NewConfig(baseHosts, 0), files)
 }
 
 func clearCloseFile(f *os.File) {
@@ -67,7 +117,20 @@ func main() {
 	log.SetOutput(f)
 
 	// runtime.GOMAXPROCS(runtime.NumCPU())
-	err = run(logger)
+	command := ""
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+	switch command {
+	case "traps":
+		err = reportTraps()
+	case "params":
+		err = reportQueryParams()
+	case "import":
+		err = importWarc(logger, os.Args[2:])
+	default:
+		err = run(logger)
+	}
 	// err = test()
 	if err != nil {
 		fmt.Printf("%s", err)
@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ReanGD/go-web-search/database"
+)
+
+// Cookie - proxy struct for database.Cookie
+type Cookie struct {
+	urlStr string
+	cookie *http.Cookie
+}
+
+// NewCookie - create Cookie
+// urlStr - URL of response with header Set-Cookie
+func NewCookie(urlStr string, cookie *http.Cookie) *Cookie {
+	return &Cookie{
+		urlStr: urlStr,
+		cookie: cookie}
+}
+
+// NewCookieFromTable - create Cookie from Db row
+func NewCookieFromTable(row *database.Cookie) *Cookie {
+	cookie := &http.Cookie{
+		Name:     row.Name,
+		Value:    row.Value,
+		Domain:   row.Domain,
+		Path:     row.Path,
+		Secure:   row.Secure,
+		HttpOnly: row.HTTPOnly}
+	if row.Expires != nil {
+		cookie.Expires = *row.Expires
+	}
+
+	return NewCookie(row.URL, cookie)
+}
+
+// GetURL - get URL of response with header Set-Cookie
+func (c *Cookie) GetURL() string {
+	return c.urlStr
+}
+
+// GetCookie - get field cookie
+func (c *Cookie) GetCookie() *http.Cookie {
+	return c.cookie
+}
+
+// IsExpired - cookie is expired and must be deleted
+func (c *Cookie) IsExpired(now time.Time) bool {
+	return !c.cookie.Expires.IsZero() && c.cookie.Expires.Before(now)
+}
+
+// GetTable - get cookie converted for Db
+func (c *Cookie) GetTable(hostID int64) *database.Cookie {
+	result := &database.Cookie{
+		HostID:   hostID,
+		Name:     c.cookie.Name,
+		Domain:   c.cookie.Domain,
+		Path:     c.cookie.Path,
+		URL:      c.urlStr,
+		Value:    c.cookie.Value,
+		Secure:   c.cookie.Secure,
+		HTTPOnly: c.cookie.HttpOnly}
+	if !c.cookie.Expires.IsZero() {
+		expires := c.cookie.Expires
+		result.Expires = &expires
+	}
+
+	return result
+}
@@ -1,12 +1,19 @@
 package proxy
 
-import "github.com/ReanGD/go-web-search/database"
+import (
+	"time"
+
+	"github.com/ReanGD/go-web-search/database"
+)
 
 // Host - proxy struct for database.Host
 type Host struct {
 	name             string
+	scheme           string
+	port             int
 	robotsStatusCode int
 	robotsData       []byte
+	robotsFetchedAt  time.Time
 }
 
 // DbHost - database interface for work with host
@@ -15,12 +22,30 @@ type DbHost interface {
 	GetHosts() (map[int64]*Host, error)
 	// AddHost - baseURL: init url for host
 	AddHost(host *Host, baseURL string) (int64, error)
+	// UpdateRobotsTxt - save new download of robots.txt for host
+	UpdateRobotsTxt(hostID int64, host *Host) error
+	// AddSitemapURLs - add URLs from sitemap with hints, loaded pages with newer <lastmod> are scheduled for recrawl
+	AddSitemapURLs(urls []*SitemapURL) error
+	// GetCookies - get saved cookies of host
+	GetCookies(hostID int64) ([]*Cookie, error)
+	// SaveCookies - add, update or delete (expired) cookies of host, now - current time by clock of crawler
+	SaveCookies(hostID int64, cookies []*Cookie, now time.Time) error
+	// GetHostURLs - get first cnt URLs of host
+	GetHostURLs(hostID int64, cnt int) ([]string, error)
+	// GetTraps - get quarantined patterns of all hosts
+	GetTraps() ([]*Trap, error)
+	// SaveTrap - add quarantined pattern or update its hits
+	SaveTrap(trap *Trap) error
+	// GetContentHashes - get map[URL]hash of content for loaded pages of host (dublicates have hash of origin)
+	GetContentHashes(hostID int64) (map[string]string, error)
 }
 
 // NewHost - create Host
 func NewHost(name string, robotsStatusCode int, robotsData []byte) *Host {
 	return &Host{
 		name:             name,
+		scheme:           "http",
+		port:             0,
 		robotsStatusCode: robotsStatusCode,
 		robotsData:       robotsData}
 }
@@ -30,15 +55,56 @@ func (h *Host) GetName() string {
 	return h.name
 }
 
+// SetOrigin - set preferred scheme and port (0 - default port for scheme)
+func (h *Host) SetOrigin(scheme string, port int) {
+	h.scheme = scheme
+	h.port = port
+}
+
+// GetOrigin - get preferred scheme and port
+func (h *Host) GetOrigin() (string, int) {
+	return h.scheme, h.port
+}
+
 // GetRobotsTxt - get data for init robots.txt
 func (h *Host) GetRobotsTxt() (int, []byte) {
 	return h.robotsStatusCode, h.robotsData
 }
 
+// SetRobotsFetchedAt - set time of robots.txt download
+func (h *Host) SetRobotsFetchedAt(value time.Time) {
+	h.robotsFetchedAt = value
+}
+
+// GetRobotsFetchedAt - get time of robots.txt download (zero - unknown)
+func (h *Host) GetRobotsFetchedAt() time.Time {
+	return h.robotsFetchedAt
+}
+
+func (h *Host) getRobotsFetchedAtPtr() *time.Time {
+	if h.robotsFetchedAt.IsZero() {
+		return nil
+	}
+	value := h.robotsFetchedAt
+	return &value
+}
+
 // GetTable - get field host converted for Db
 func (h *Host) GetTable() *database.Host {
 	return &database.Host{
 		Name:             h.name,
+		Scheme:           h.scheme,
+		Port:             h.port,
 		RobotsStatusCode: h.robotsStatusCode,
-		RobotsData:       h.robotsData}
+		RobotsData:       h.robotsData,
+		RobotsFetchedAt:  h.getRobotsFetchedAtPtr()}
+}
+
+// GetRobotsHistory - get robots.txt version converted for Db
+func (h *Host) GetRobotsHistory(hostID int64) *database.RobotsHistory {
+	return &database.RobotsHistory{
+		HostID:     hostID,
+		StatusCode: h.robotsStatusCode,
+		Data:       h.robotsData,
+		FetchedAt:  h.robotsFetchedAt}
 }
@@ -2,6 +2,7 @@ package proxy
 
 import (
 	"database/sql"
+	"time"
 
 	"github.com/ReanGD/go-web-search/database"
 )
@@ -16,10 +17,45 @@ type Meta struct {
 	urlStr          string
 	state           database.State
 	statusCode      sql.NullInt64
+	attempts        int
+	nextRetry       *time.Time
+	recrawl         bool
+	notModified     bool
+	changed         bool
+	etag            string
+	lastModified    string
+	fetchedAt       *time.Time
+	nextFetch       *time.Time
+	recrawlInterval time.Duration
+	redirect        *redirect
+	canonical       string
+	canonicalHostID sql.NullInt64
+	canonicalID     sql.NullInt64
+	depth           int
+	warcRecordID    string
+}
+
+// redirect - hop of redirect chain
+type redirect struct {
+	statusCode  int
+	location    string
+	hop         int
+	permanent   bool
+	metaRefresh bool
+}
+
+// IsPermanentRedirect - redirect with status code 301 or 308
+func IsPermanentRedirect(statusCode int) bool {
+	return statusCode == 301 || statusCode == 308
 }
 
 // NewMeta - create Meta
+// URL from redirect chain has depth of referer
 func NewMeta(hostID sql.NullInt64, urlStr string, referer *Meta) *Meta {
+	depth := 0
+	if referer != nil {
+		depth = referer.depth
+	}
 	it := referer
 	for it != nil {
 		it.redirectCnt++
@@ -34,7 +70,8 @@ func NewMeta(hostID sql.NullInt64, urlStr string, referer *Meta) *Meta {
 		hostID:          hostID,
 		urlStr:          urlStr,
 		state:           database.StateSuccess,
-		statusCode:      sql.NullInt64{Valid: false}}
+		statusCode:      sql.NullInt64{Valid: false},
+		depth:           depth}
 }
 
 // SetState - set new state
@@ -50,6 +87,98 @@ func (in *Meta) SetStatusCode(statusCode int) {
 	in.statusCode = sql.NullInt64{Int64: int64(statusCode), Valid: true}
 }
 
+// SetRetry - mark URL for new download attempt after transient error
+func (in *Meta) SetRetry(attempts int, nextRetry time.Time) {
+	in.content = nil
+	in.attempts = attempts
+	in.nextRetry = &nextRetry
+}
+
+// SetRecrawl - mark URL as loaded before
+func (in *Meta) SetRecrawl() {
+	in.recrawl = true
+}
+
+// SetNotModified - server answered "304 Not Modified" on conditional request
+func (in *Meta) SetNotModified() {
+	in.notModified = true
+}
+
+// SetValidators - set ETag and Last-Modified from response headers
+func (in *Meta) SetValidators(etag string, lastModified string) {
+	in.etag = etag
+	in.lastModified = lastModified
+}
+
+// SetSchedule - set fetch time and recrawl interval
+// changed - content was changed since previous download
+func (in *Meta) SetSchedule(fetchedAt time.Time, changed bool, interval time.Duration) {
+	nextFetch := fetchedAt.Add(interval)
+	in.fetchedAt = &fetchedAt
+	in.changed = changed
+	in.nextFetch = &nextFetch
+	in.recrawlInterval = interval
+}
+
+// SetRedirect - URL is redirected to location
+// statusCode - status code of redirect response
+// hop - position of URL in redirect chain (0 - requested URL)
+// permanent redirect makes URL dublicate of target, temporary redirect does not
+func (in *Meta) SetRedirect(statusCode int, location string, hop int) {
+	in.redirect = &redirect{
+		statusCode: statusCode,
+		location:   location,
+		hop:        hop,
+		permanent:  IsPermanentRedirect(statusCode)}
+	in.SetStatusCode(statusCode)
+	in.setRedirectState()
+}
+
+// SetMetaRefresh - URL is redirected to location by <meta http-equiv="refresh">
+// status code of response is not changed, redirect without delay is permanent
+func (in *Meta) SetMetaRefresh(location string, hop int, delay time.Duration) {
+	statusCode := 0
+	if in.statusCode.Valid {
+		statusCode = int(in.statusCode.Int64)
+	}
+	in.redirect = &redirect{
+		statusCode:  statusCode,
+		location:    location,
+		hop:         hop,
+		permanent:   delay == 0,
+		metaRefresh: true}
+	in.setRedirectState()
+}
+
+func (in *Meta) setRedirectState() {
+	if in.redirect.permanent {
+		in.SetState(database.StateDublicate)
+	} else {
+		in.SetState(database.StateRedirect)
+	}
+}
+
+// SetCanonical - set canonical URL of page ("" - not found)
+func (in *Meta) SetCanonical(urlStr string, hostID sql.NullInt64) {
+	in.canonical = urlStr
+	in.canonicalHostID = hostID
+}
+
+// SetCanonicalID - set ID of canonical URL in db
+func (in *Meta) SetCanonicalID(id sql.NullInt64) {
+	in.canonicalID = id
+}
+
+// SetWarcRecordID - set WARC-Record-ID of response record
+func (in *Meta) SetWarcRecordID(id string) {
+	in.warcRecordID = id
+}
+
+// SetDepth - set click depth of URL from seed
+func (in *Meta) SetDepth(depth int) {
+	in.depth = depth
+}
+
 // SetContent - set new content
 func (in *Meta) SetContent(content *Content) {
 	in.content = content
@@ -74,6 +203,16 @@ func (in *Meta) GetHostID() sql.NullInt64 {
 	return in.hostID
 }
 
+// GetWarcRecordID - get WARC-Record-ID of response record ("" - not written)
+func (in *Meta) GetWarcRecordID() string {
+	return in.warcRecordID
+}
+
+// GetDepth - get click depth of URL from seed
+func (in *Meta) GetDepth() int {
+	return in.depth
+}
+
 // GetContent - get field content
 func (in *Meta) GetContent() *Content {
 	return in.content
@@ -84,6 +223,31 @@ func (in *Meta) GetState() database.State {
 	return in.state
 }
 
+// GetStatusCode - get field statusCode
+func (in *Meta) GetStatusCode() sql.NullInt64 {
+	return in.statusCode
+}
+
+// NeedRetry - URL must be downloaded again later, meta is not saved
+func (in *Meta) NeedRetry() bool {
+	return in.nextRetry != nil
+}
+
+// GetRetry - get fields attempts and nextRetry
+func (in *Meta) GetRetry() (int, *time.Time) {
+	return in.attempts, in.nextRetry
+}
+
+// IsRecrawl - URL was loaded before
+func (in *Meta) IsRecrawl() bool {
+	return in.recrawl
+}
+
+// IsNotModified - server answered "304 Not Modified"
+func (in *Meta) IsNotModified() bool {
+	return in.notModified
+}
+
 // GetHash - get content hash
 func (in *Meta) GetHash() string {
 	if in.content == nil || in.state != database.StateSuccess {
@@ -93,22 +257,113 @@ func (in *Meta) GetHash() string {
 	return in.content.hash
 }
 
+// GetCanonical - get canonical URL and its hostID ("" - not found)
+func (in *Meta) GetCanonical() (string, sql.NullInt64) {
+	return in.canonical, in.canonicalHostID
+}
+
+// IsRedirect - URL is redirected
+func (in *Meta) IsRedirect() bool {
+	return in.redirect != nil
+}
+
+// IsPermanentRedirect - URL is redirected with status code 301 or 308 or by meta refresh without delay
+func (in *Meta) IsPermanentRedirect() bool {
+	return in.redirect != nil && in.redirect.permanent
+}
+
+// GetRedirect - get field redirect converted for Db (nil - URL is not redirected)
+// target - URL ID of redirect target
+func (in *Meta) GetRedirect(urlID int64, target sql.NullInt64) *database.Redirect {
+	if in.redirect == nil {
+		return nil
+	}
+
+	return &database.Redirect{
+		URL:         urlID,
+		Target:      target,
+		StatusCode:  in.redirect.statusCode,
+		Location:    in.redirect.location,
+		Hop:         in.redirect.hop,
+		MetaRefresh: in.redirect.metaRefresh}
+}
+
 // GetReferer - get field redirectReferer
 func (in *Meta) GetReferer() *Meta {
 	return in.redirectReferer
 }
 
-// NeedWaitAfterRequest - Check is need wait after request by state
-func (in *Meta) NeedWaitAfterRequest() bool {
-	return in.state != database.StateDisabledByRobotsTxt
+// DelayController - calculate delay between requests to host
+type DelayController interface {
+	// Delay - get delay before next request
+	Delay() time.Duration
+}
+
+// NeedWaitAfterRequest - get delay after request by state and host delay controller
+// 0 - not need wait
+func (in *Meta) NeedWaitAfterRequest(ctrl DelayController) time.Duration {
+	if in.state == database.StateDisabledByRobotsTxt {
+		return 0
+	}
+
+	return ctrl.Delay()
 }
 
 // GetMeta - get field meta converted for Db
 func (in *Meta) GetMeta(urlID int64) *database.Meta {
+	var changedAt *time.Time
+	if in.changed {
+		changedAt = in.fetchedAt
+	}
+
 	return &database.Meta{
-		URL:         urlID,
-		State:       in.state,
-		Origin:      in.origin,
-		RedirectCnt: in.redirectCnt,
-		StatusCode:  in.statusCode}
+		URL:             urlID,
+		State:           in.state,
+		Origin:          in.origin,
+		Canonical:       in.canonicalID,
+		RedirectCnt:     in.redirectCnt,
+		StatusCode:      in.statusCode,
+		ETag:            in.etag,
+		LastModified:    in.lastModified,
+		FetchedAt:       in.fetchedAt,
+		ChangedAt:       changedAt,
+		NextFetchAt:     in.nextFetch,
+		RecrawlInterval: int64(in.recrawlInterval / time.Second),
+		WarcRecordID:    in.warcRecordID}
+}
+
+// GetScheduleFields - get changed fields for update meta after recrawl
+func (in *Meta) GetScheduleFields() map[string]interface{} {
+	result := map[string]interface{}{
+		"fetched_at":       in.fetchedAt,
+		"next_fetch_at":    in.nextFetch,
+		"recrawl_interval": int64(in.recrawlInterval / time.Second)}
+	if in.changed {
+		result["changed_at"] = in.fetchedAt
+	}
+	if in.etag != "" {
+		result["etag"] = in.etag
+	}
+	if in.lastModified != "" {
+		result["last_modified"] = in.lastModified
+	}
+	if in.warcRecordID != "" {
+		result["warc_record_id"] = in.warcRecordID
+	}
+
+	return result
+}
+
+// GetUpdateFields - get all fields for update meta after recrawl
+func (in *Meta) GetUpdateFields() map[string]interface{} {
+	result := in.GetScheduleFields()
+	result["state"] = in.state
+	result["origin"] = in.origin
+	result["canonical"] = in.canonicalID
+	result["redirect_cnt"] = in.redirectCnt
+	result["status_code"] = in.statusCode
+	result["etag"] = in.etag
+	result["last_modified"] = in.lastModified
+
+	return result
 }
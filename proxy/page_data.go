@@ -7,6 +7,7 @@ type PageData struct {
 	meta *Meta
 	// map[URL]HostName
 	urls      map[string]sql.NullInt64
+	rejected  map[string]*RejectedURL
 	parentURL int64
 }
 
@@ -22,6 +23,11 @@ func (in *PageData) SetParentURL(parentURL int64) {
 	in.parentURL = parentURL
 }
 
+// SetRejected - set URLs rejected by host rules
+func (in *PageData) SetRejected(rejected map[string]*RejectedURL) {
+	in.rejected = rejected
+}
+
 // GetMeta - get field meta
 func (in *PageData) GetMeta() *Meta {
 	return in.meta
@@ -32,6 +38,11 @@ func (in *PageData) GetURLs() map[string]sql.NullInt64 {
 	return in.urls
 }
 
+// GetRejected - get field rejected
+func (in *PageData) GetRejected() map[string]*RejectedURL {
+	return in.rejected
+}
+
 // GetParentURL - get field parentURL
 func (in *PageData) GetParentURL() int64 {
 	return in.parentURL
@@ -0,0 +1,45 @@
+package proxy
+
+import (
+	"database/sql"
+
+	"github.com/ReanGD/go-web-search/database"
+)
+
+// RejectedURL - proxy struct for database.Rejected
+type RejectedURL struct {
+	urlStr  string
+	hostID  sql.NullInt64
+	reason  database.RejectReason
+	details string
+}
+
+// NewRejectedURL - create RejectedURL
+func NewRejectedURL(urlStr string, hostID sql.NullInt64, reason database.RejectReason, details string) *RejectedURL {
+	return &RejectedURL{
+		urlStr:  urlStr,
+		hostID:  hostID,
+		reason:  reason,
+		details: details}
+}
+
+// GetURL - get field urlStr
+func (in *RejectedURL) GetURL() string {
+	return in.urlStr
+}
+
+// GetReason - get fields reason and details
+func (in *RejectedURL) GetReason() (database.RejectReason, string) {
+	return in.reason, in.details
+}
+
+// GetTable - get RejectedURL converted for Db
+// referer - ID of page with link to URL
+func (in *RejectedURL) GetTable(referer int64) *database.Rejected {
+	return &database.Rejected{
+		URL:     in.urlStr,
+		HostID:  in.hostID,
+		Reason:  in.reason,
+		Details: in.details,
+		Referer: referer}
+}
@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/ReanGD/go-web-search/database"
+)
+
+// SitemapURL - proxy struct for database.SitemapHint
+type SitemapURL struct {
+	urlStr     string
+	hostID     sql.NullInt64
+	lastMod    *time.Time
+	priority   float64
+	changeFreq string
+}
+
+// NewSitemapURL - create SitemapURL
+func NewSitemapURL(urlStr string, hostID sql.NullInt64, lastMod *time.Time, priority float64, changeFreq string) *SitemapURL {
+	return &SitemapURL{
+		urlStr:     urlStr,
+		hostID:     hostID,
+		lastMod:    lastMod,
+		priority:   priority,
+		changeFreq: changeFreq}
+}
+
+// GetURL - get field urlStr
+func (in *SitemapURL) GetURL() string {
+	return in.urlStr
+}
+
+// GetHostID - get field hostID
+func (in *SitemapURL) GetHostID() sql.NullInt64 {
+	return in.hostID
+}
+
+// GetPriority - get field priority
+func (in *SitemapURL) GetPriority() float64 {
+	return in.priority
+}
+
+// GetHint - get hint converted for Db
+func (in *SitemapURL) GetHint(urlID int64) *database.SitemapHint {
+	return &database.SitemapHint{
+		URL:        urlID,
+		LastMod:    in.lastMod,
+		Priority:   in.priority,
+		ChangeFreq: in.changeFreq}
+}
@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"time"
+
+	"github.com/ReanGD/go-web-search/database"
+)
+
+// Trap - proxy struct for database.Trap
+type Trap struct {
+	hostID  int64
+	pattern string
+	kind    database.TrapKind
+	hits    int
+	example string
+}
+
+// NewTrap - create Trap
+func NewTrap(hostID int64, pattern string, kind database.TrapKind, hits int, example string) *Trap {
+	return &Trap{
+		hostID:  hostID,
+		pattern: pattern,
+		kind:    kind,
+		hits:    hits,
+		example: example}
+}
+
+// NewTrapFromTable - create Trap from Db row
+func NewTrapFromTable(row *database.Trap) *Trap {
+	return NewTrap(row.HostID, row.Pattern, row.Kind, row.Hits, row.Example)
+}
+
+// GetHostID - get field hostID
+func (in *Trap) GetHostID() int64 {
+	return in.hostID
+}
+
+// GetPattern - get field pattern
+func (in *Trap) GetPattern() string {
+	return in.pattern
+}
+
+// GetKind - get field kind
+func (in *Trap) GetKind() database.TrapKind {
+	return in.kind
+}
+
+// GetHits - get field hits
+func (in *Trap) GetHits() int {
+	return in.hits
+}
+
+// GetExample - get field example
+func (in *Trap) GetExample() string {
+	return in.example
+}
+
+// GetTable - get Trap converted for Db
+func (in *Trap) GetTable() *database.Trap {
+	return &database.Trap{
+		HostID:    in.hostID,
+		Pattern:   in.pattern,
+		Kind:      in.kind,
+		Hits:      in.hits,
+		Example:   in.example,
+		CreatedAt: time.Now()}
+}